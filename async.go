@@ -0,0 +1,85 @@
+package db
+
+// WriteHandle is returned by asynchronous writes, to wait for them to be durable.
+type WriteHandle interface {
+	// Wait blocks until the write is durable, and returns its error. It must be called for every
+	// handle, as it may release resources held by the write, and can be called several times.
+	Wait() error
+}
+
+// AsyncWriter is implemented by databases which can make writes durable in the background, e.g.
+// to overlap the execution of a block with the commit of the previous one. The writes are
+// ordered like synchronous writes, and WriteHandle.Wait waits for them to be durable, as if they
+// were written with SetSync and DeleteSync.
+//
+// PebbleDB applies the writes before returning, so they are visible to reads right away, and only
+// waits for the WAL to be synced in Wait. GroupCommitDB queues them for the next group commit, and
+// makes reads of their keys wait for them. goleveldb and RocksDB don't implement it, and only get
+// the synchronous fallback of SetAsync, DeleteAsync and WriteAsync.
+type AsyncWriter interface {
+	// SetAsync sets the value for the given key, and returns a handle to wait for it to be
+	// durable.
+	// CONTRACT: key, value readonly []byte
+	SetAsync(key, value []byte) (WriteHandle, error)
+
+	// DeleteAsync deletes the key, and returns a handle to wait for it to be durable.
+	// CONTRACT: key readonly []byte
+	DeleteAsync(key []byte) (WriteHandle, error)
+}
+
+// AsyncBatch is implemented by batches which can be written durably in the background, see
+// AsyncWriter. Like WriteSync, WriteAsync releases the batch.
+type AsyncBatch interface {
+	Batch
+
+	// WriteAsync writes the batch atomically, like WriteSync, and returns a handle to wait for it
+	// to be durable. If it fails to be written, none of its operations is applied.
+	WriteAsync() (WriteHandle, error)
+}
+
+// SetAsync sets the value for the given key in db, and returns a handle to wait for it to be
+// durable. If db does not implement AsyncWriter, it uses SetSync, and the returned handle is
+// already complete. Wrapping such a database in a GroupCommitDB commits the writes in the
+// background instead.
+func SetAsync(db DB, key, value []byte) (WriteHandle, error) {
+	if writer, ok := db.(AsyncWriter); ok {
+		return writer.SetAsync(key, value)
+	}
+	if err := db.SetSync(key, value); err != nil {
+		return nil, err
+	}
+	return completedWrite{}, nil
+}
+
+// DeleteAsync deletes the key from db, and returns a handle to wait for it to be durable. If db
+// does not implement AsyncWriter, it uses DeleteSync, and the returned handle is already
+// complete.
+func DeleteAsync(db DB, key []byte) (WriteHandle, error) {
+	if writer, ok := db.(AsyncWriter); ok {
+		return writer.DeleteAsync(key)
+	}
+	if err := db.DeleteSync(key); err != nil {
+		return nil, err
+	}
+	return completedWrite{}, nil
+}
+
+// WriteAsync writes batch, and returns a handle to wait for it to be durable. If batch does not
+// implement AsyncBatch, it uses WriteSync, and the returned handle is already complete.
+func WriteAsync(batch Batch) (WriteHandle, error) {
+	if batch, ok := batch.(AsyncBatch); ok {
+		return batch.WriteAsync()
+	}
+	if err := batch.WriteSync(); err != nil {
+		return nil, err
+	}
+	return completedWrite{}, nil
+}
+
+// completedWrite is the handle of a write which is already durable.
+type completedWrite struct{}
+
+// Wait implements WriteHandle.
+func (completedWrite) Wait() error {
+	return nil
+}
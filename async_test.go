@@ -0,0 +1,121 @@
+package db
+
+import (
+	"os"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestAsyncWrites(t *testing.T) {
+	for backend := range backends {
+		t.Run(string(backend), func(t *testing.T) {
+			db, dir := newTempDB(t, backend)
+			defer os.RemoveAll(dir)
+			defer db.Close()
+
+			testAsyncWrites(t, db)
+
+			// Writes are applied before returning on PebbleDB.
+			if _, ok := db.(*PebbleDB); ok {
+				handle, err := SetAsync(db, []byte("visible"), []byte{1})
+				require.NoError(t, err)
+				checkValue(t, db, []byte("visible"), []byte{1})
+				require.NoError(t, handle.Wait())
+			}
+		})
+	}
+}
+
+func TestGroupCommitDBAsyncWrites(t *testing.T) {
+	gdb := NewGroupCommitDB(NewMemDB())
+	testAsyncWrites(t, gdb)
+
+	// Async writes are committed in order, also mixed with sync writes.
+	handles := make([]WriteHandle, 0, 100)
+	for i := 0; i < 100; i++ {
+		handle, err := gdb.SetAsync([]byte("key"), []byte{byte(i)})
+		require.NoError(t, err)
+		handles = append(handles, handle)
+		if i%10 == 0 {
+			require.NoError(t, gdb.SetSync([]byte("sync"), []byte{byte(i)}))
+		}
+	}
+	for _, handle := range handles {
+		require.NoError(t, handle.Wait())
+	}
+	checkValue(t, gdb, []byte("key"), []byte{99})
+	checkValue(t, gdb, []byte("sync"), []byte{90})
+
+	// Async writes are visible to reads right away, and ordered with later writes.
+	handle, err := gdb.SetAsync([]byte("mixed"), []byte{1})
+	require.NoError(t, err)
+	checkValue(t, gdb, []byte("mixed"), []byte{1})
+	handle2, err := gdb.SetAsync([]byte("mixed"), []byte{2})
+	require.NoError(t, err)
+	require.NoError(t, gdb.Set([]byte("mixed"), []byte{3}))
+	require.NoError(t, handle.Wait())
+	require.NoError(t, handle2.Wait())
+	checkValue(t, gdb, []byte("mixed"), []byte{3})
+
+	// Keys and values can be reused once queued.
+	key, value := []byte("reused"), []byte{1}
+	batch := gdb.NewBatch()
+	require.NoError(t, batch.Set(key, value))
+	handle, err = WriteAsync(batch)
+	require.NoError(t, err)
+	require.NoError(t, batch.Close())
+	key[0], value[0] = 'x', 2
+	handle2, err = gdb.DeleteAsync([]byte("mixed"))
+	require.NoError(t, err)
+	checkValue(t, gdb, []byte("mixed"), nil)
+	require.NoError(t, handle.Wait())
+	require.NoError(t, handle2.Wait())
+	checkValue(t, gdb, []byte("reused"), []byte{1})
+	checkValue(t, gdb, []byte("xeused"), nil)
+
+	// Commit errors are returned by Wait, and the writes are then not applied.
+	fdb := NewFaultDB(NewMemDB())
+	fdb.AddFault(Fault{Ops: FaultBatchWrite, Err: errTestFault})
+	gdb = NewGroupCommitDB(fdb)
+	handle, err = gdb.SetAsync([]byte("key"), []byte{1})
+	require.NoError(t, err)
+	require.Equal(t, errTestFault, handle.Wait())
+	checkValue(t, gdb, []byte("key"), nil)
+}
+
+// testAsyncWrites tests the asynchronous writes of a database, through the helpers.
+func testAsyncWrites(t *testing.T, db DB) {
+	require.NoError(t, db.Set([]byte("deleted"), []byte{1}))
+
+	setHandle, err := SetAsync(db, []byte("set"), []byte{1})
+	require.NoError(t, err)
+	deleteHandle, err := DeleteAsync(db, []byte("deleted"))
+	require.NoError(t, err)
+
+	batch := db.NewBatch()
+	require.NoError(t, batch.Set([]byte("batch/a"), []byte{2}))
+	require.NoError(t, batch.Set([]byte("batch/b"), []byte{}))
+	require.NoError(t, batch.Delete([]byte("set")))
+	batchHandle, err := WriteAsync(batch)
+	require.NoError(t, err)
+	_, err = WriteAsync(batch)
+	require.Equal(t, errBatchClosed, err)
+	require.NoError(t, batch.Close())
+
+	for _, handle := range []WriteHandle{setHandle, deleteHandle, batchHandle} {
+		require.NoError(t, handle.Wait())
+		require.NoError(t, handle.Wait())
+	}
+	checkValue(t, db, []byte("set"), nil)
+	checkValue(t, db, []byte("deleted"), nil)
+	checkValue(t, db, []byte("batch/a"), []byte{2})
+	checkValue(t, db, []byte("batch/b"), []byte{})
+
+	_, err = SetAsync(db, nil, []byte{1})
+	require.Equal(t, errKeyEmpty, err)
+	_, err = SetAsync(db, []byte("key"), nil)
+	require.Equal(t, errValueNil, err)
+	_, err = DeleteAsync(db, nil)
+	require.Equal(t, errKeyEmpty, err)
+}
@@ -0,0 +1,305 @@
+package db
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+)
+
+var (
+	// ErrAtomicCommitUnknownDB is returned when using a database unknown to an AtomicCommitter.
+	ErrAtomicCommitUnknownDB = errors.New("unknown database")
+
+	// ErrAtomicCommitPending is returned when an atomic commit could not be applied after writing
+	// its intent, which is durable and will be applied by the recovery.
+	ErrAtomicCommitPending = errors.New("atomic commit is durable but pending, it will be applied on recovery")
+)
+
+// AtomicCommitter commits batches to several independent databases atomically, e.g. to the
+// application state and the block store, so that a crash can't leave them inconsistent.
+//
+// A commit first writes an intent with all the operations to a journal, then writes them to each
+// database, and finally deletes the intent, all durably. Once the intent is written, the commit
+// takes effect: failing writes to the databases are retried a few times with a backoff, and if
+// they still fail, the commit returns an error wrapping ErrAtomicCommitPending, as the intent will
+// be applied later. Intents left in the journal by a crash or such a commit are replayed when
+// opening the committer, and before the next commit. Until then, readers may see the commit
+// partly applied. The journal can be any database, e.g. a PrefixDB of one of the committed databases.
+//
+// Replaying an intent sets and deletes its keys again, so writes made to the same keys outside of
+// the committer, concurrently with a commit that fails, may be overwritten by the replay. Merges
+// are not supported, as they can't be replayed.
+type AtomicCommitter struct {
+	journal DB
+	dbs     map[string]DB
+
+	mtx     sync.Mutex // serializes commits
+	seq     uint64     // sequence number of the next intent
+	pending bool       // whether the journal may have intents to replay
+}
+
+// NewAtomicCommitter creates a new AtomicCommitter for the given databases by name, replaying any
+// intents left in the journal.
+func NewAtomicCommitter(journal DB, dbs map[string]DB) (*AtomicCommitter, error) {
+	c := &AtomicCommitter{
+		journal: journal,
+		dbs:     dbs,
+		pending: true,
+	}
+	if err := c.recover(); err != nil {
+		return nil, err
+	}
+	return c, nil
+}
+
+// NewBatch creates a new batch spanning the databases of the committer.
+func (c *AtomicCommitter) NewBatch() *AtomicBatch {
+	return &AtomicBatch{
+		c:   c,
+		ops: make(map[string][]operation),
+	}
+}
+
+// recover replays and deletes the intents left in the journal. The caller must hold mtx, unless
+// the committer is being created.
+func (c *AtomicCommitter) recover() error {
+	if !c.pending {
+		return nil
+	}
+	// Read the intents first, as the iterator may block writes to the journal.
+	var keys, intents [][]byte
+	itr, err := c.journal.Iterator(nil, nil)
+	if err != nil {
+		return err
+	}
+	for ; itr.Valid(); itr.Next() {
+		keys = append(keys, cp(itr.Key()))
+		intents = append(intents, cp(itr.Value()))
+	}
+	err = itr.Error()
+	itr.Close()
+	if err != nil {
+		return err
+	}
+
+	for i, key := range keys {
+		if len(key) != 8 {
+			return fmt.Errorf("%w: invalid key %X", errAtomicCommitIntentCorrupted, key)
+		}
+		if err := c.apply(key, intents[i]); err != nil {
+			return err
+		}
+		c.seq = binary.BigEndian.Uint64(key) + 1
+	}
+	c.pending = false
+	return nil
+}
+
+const (
+	// atomicCommitAttempts is the number of times a commit tries to apply its intent before
+	// returning ErrAtomicCommitPending.
+	atomicCommitAttempts = 3
+
+	// atomicCommitBackoff is the delay before retrying to apply an intent, doubled after each
+	// attempt.
+	atomicCommitBackoff = 10 * time.Millisecond
+)
+
+// commit writes an intent to the journal, and then applies it.
+func (c *AtomicCommitter) commit(ops map[string][]operation) error {
+	c.mtx.Lock()
+	defer c.mtx.Unlock()
+
+	if err := c.recover(); err != nil {
+		return err
+	}
+	key := make([]byte, 8)
+	binary.BigEndian.PutUint64(key, c.seq)
+	c.seq++
+	intent := encodeIntent(ops)
+	if err := c.journal.SetSync(key, intent); err != nil {
+		return err
+	}
+	// The intent is durable, so the commit can no longer fail: retry applying it, and otherwise
+	// leave it to the recovery.
+	backoff := atomicCommitBackoff
+	for attempt := 1; ; attempt++ {
+		err := c.apply(key, intent)
+		if err == nil {
+			return nil
+		}
+		if attempt == atomicCommitAttempts {
+			c.pending = true
+			return fmt.Errorf("%w: %v", ErrAtomicCommitPending, err)
+		}
+		time.Sleep(backoff)
+		backoff *= 2
+	}
+}
+
+// apply writes the operations of an intent to the databases, and then deletes it from the
+// journal.
+func (c *AtomicCommitter) apply(key, intent []byte) error {
+	err := decodeIntent(intent, func(name string, data []byte) error {
+		db, ok := c.dbs[name]
+		if !ok {
+			return fmt.Errorf("%w %q in intent %X", ErrAtomicCommitUnknownDB, name, key)
+		}
+		batch, err := NewBatchFromData(db, data)
+		if err != nil {
+			return err
+		}
+		defer batch.Close()
+		return batch.WriteSync()
+	})
+	if err != nil {
+		return err
+	}
+	return c.journal.DeleteSync(key)
+}
+
+// encodeIntent serializes the operations of an intent: for each database, in name order, its
+// varint length-prefixed name and batch data.
+func encodeIntent(ops map[string][]operation) []byte {
+	names := make([]string, 0, len(ops))
+	for name := range ops {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	var intent []byte
+	for _, name := range names {
+		data := encodeBatchOps(ops[name])
+		intent = binary.AppendUvarint(intent, uint64(len(name)))
+		intent = append(intent, name...)
+		intent = binary.AppendUvarint(intent, uint64(len(data)))
+		intent = append(intent, data...)
+	}
+	return intent
+}
+
+// decodeIntent calls fn with the name and batch data of each database of an intent.
+func decodeIntent(intent []byte, fn func(name string, data []byte) error) error {
+	for len(intent) > 0 {
+		name, rest, ok := decodeBatchField(intent)
+		if !ok {
+			return fmt.Errorf("%w: invalid name", errAtomicCommitIntentCorrupted)
+		}
+		data, rest, ok := decodeBatchField(rest)
+		if !ok {
+			return fmt.Errorf("%w: invalid data for %q", errAtomicCommitIntentCorrupted, name)
+		}
+		if err := fn(string(name), data); err != nil {
+			return err
+		}
+		intent = rest
+	}
+	return nil
+}
+
+// AtomicBatch is a batch spanning the databases of an AtomicCommitter, written atomically by
+// Write. Operations are added through the views returned by Batch. An AtomicBatch is not safe
+// for concurrent use.
+type AtomicBatch struct {
+	c   *AtomicCommitter
+	ops map[string][]operation // nil once written or closed
+}
+
+// Batch returns a view of the batch for the database with the given name. Views cannot be
+// written, and closing them has no effect: the caller writes and closes the AtomicBatch.
+func (b *AtomicBatch) Batch(name string) (Batch, error) {
+	if _, ok := b.c.dbs[name]; !ok {
+		return nil, fmt.Errorf("%w %q", ErrAtomicCommitUnknownDB, name)
+	}
+	return atomicBatchView{batch: b, name: name}, nil
+}
+
+// Write writes the batch durably to all of its databases, atomically. The batch cannot be used
+// afterwards. An error wrapping ErrAtomicCommitPending means the batch was committed, but not
+// applied yet: it will be applied before the next commit, or when opening the committer, and the
+// batch is closed too, so that it can't be committed twice. Other errors leave the batch open, to
+// retry writing it.
+func (b *AtomicBatch) Write() error {
+	if b.ops == nil {
+		return errBatchClosed
+	}
+	if err := b.c.commit(b.ops); err != nil {
+		if errors.Is(err, ErrAtomicCommitPending) {
+			b.ops = nil
+		}
+		return err
+	}
+	return b.Close()
+}
+
+// Close discards the batch, if it was not written.
+func (b *AtomicBatch) Close() error {
+	b.ops = nil
+	return nil
+}
+
+// atomicBatchView adds operations for one database to an AtomicBatch.
+type atomicBatchView struct {
+	batch *AtomicBatch
+	name  string
+}
+
+var _ Batch = atomicBatchView{}
+
+// add adds an operation to the batch.
+func (v atomicBatchView) add(op operation) error {
+	if v.batch.ops == nil {
+		return errBatchClosed
+	}
+	v.batch.ops[v.name] = append(v.batch.ops[v.name], op)
+	return nil
+}
+
+// Set implements Batch.
+func (v atomicBatchView) Set(key, value []byte) error {
+	if len(key) == 0 {
+		return errKeyEmpty
+	}
+	if value == nil {
+		return errValueNil
+	}
+	return v.add(operation{opTypeSet, key, value})
+}
+
+// Delete implements Batch.
+func (v atomicBatchView) Delete(key []byte) error {
+	if len(key) == 0 {
+		return errKeyEmpty
+	}
+	return v.add(operation{opTypeDelete, key, nil})
+}
+
+// Write implements Batch. Views cannot be written.
+func (v atomicBatchView) Write() error {
+	return errBatchViewWrite
+}
+
+// WriteSync implements Batch. Views cannot be written.
+func (v atomicBatchView) WriteSync() error {
+	return errBatchViewWrite
+}
+
+// Close implements Batch. It has no effect, the AtomicBatch is closed by its owner.
+func (v atomicBatchView) Close() error {
+	return nil
+}
+
+// GetByteSize implements Batch, returning the size of the operations for the database.
+func (v atomicBatchView) GetByteSize() (int, error) {
+	if v.batch.ops == nil {
+		return 0, errBatchClosed
+	}
+	size := 0
+	for _, op := range v.batch.ops[v.name] {
+		size += len(op.key) + len(op.value)
+	}
+	return size, nil
+}
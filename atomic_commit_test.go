@@ -0,0 +1,149 @@
+package db
+
+import (
+	"errors"
+	"os"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestAtomicCommitter(t *testing.T) {
+	for backend := range backends {
+		t.Run(string(backend), func(t *testing.T) {
+			state, dir := newTempDB(t, backend)
+			defer os.RemoveAll(dir)
+			defer state.Close()
+			blocks := NewMemDB()
+			journal := NewPrefixDB(state, []byte("journal/"))
+
+			c, err := NewAtomicCommitter(journal, map[string]DB{"state": state, "blocks": blocks})
+			require.NoError(t, err)
+			require.NoError(t, blocks.Set([]byte("deleted"), []byte{1}))
+
+			batch := c.NewBatch()
+			stateBatch, err := batch.Batch("state")
+			require.NoError(t, err)
+			blocksBatch, err := batch.Batch("blocks")
+			require.NoError(t, err)
+			_, err = batch.Batch("unknown")
+			require.True(t, errors.Is(err, ErrAtomicCommitUnknownDB))
+
+			require.NoError(t, stateBatch.Set([]byte("key"), []byte{1}))
+			require.NoError(t, blocksBatch.Set([]byte("block"), []byte{2}))
+			require.NoError(t, blocksBatch.Delete([]byte("deleted")))
+			require.Equal(t, errKeyEmpty, stateBatch.Set(nil, []byte{1}))
+			require.Equal(t, errValueNil, stateBatch.Set([]byte("key"), nil))
+			require.Equal(t, errBatchViewWrite, stateBatch.Write())
+			require.Equal(t, errBatchViewWrite, blocksBatch.WriteSync())
+			size, err := blocksBatch.GetByteSize()
+			require.NoError(t, err)
+			require.Equal(t, len("block")+1+len("deleted"), size)
+
+			require.NoError(t, batch.Write())
+			require.Equal(t, errBatchClosed, batch.Write())
+			require.Equal(t, errBatchClosed, stateBatch.Set([]byte("key"), []byte{2}))
+			require.NoError(t, batch.Close())
+
+			checkValue(t, state, []byte("key"), []byte{1})
+			checkValue(t, blocks, []byte("block"), []byte{2})
+			checkValue(t, blocks, []byte("deleted"), nil)
+			require.Zero(t, countIntents(t, journal))
+		})
+	}
+}
+
+func TestAtomicCommitterRecovery(t *testing.T) {
+	state := NewMemDB()
+	blocks := NewFaultDB(NewMemDB())
+	journal := NewMemDB()
+	dbs := map[string]DB{"state": state, "blocks": blocks}
+
+	c, err := NewAtomicCommitter(journal, dbs)
+	require.NoError(t, err)
+
+	// Fail the write to the second database, as if crashing in the middle of the commit.
+	blocks.AddFault(Fault{Ops: FaultBatchWrite, Err: errTestFault})
+	batch := c.NewBatch()
+	stateBatch, err := batch.Batch("state")
+	require.NoError(t, err)
+	blocksBatch, err := batch.Batch("blocks")
+	require.NoError(t, err)
+	require.NoError(t, stateBatch.Set([]byte("key"), []byte{1}))
+	require.NoError(t, blocksBatch.Set([]byte("block"), []byte{1}))
+	err = batch.Write()
+	require.True(t, errors.Is(err, ErrAtomicCommitPending))
+	require.Contains(t, err.Error(), errTestFault.Error())
+	require.NoError(t, batch.Close())
+	checkValue(t, blocks, []byte("block"), nil)
+	require.Equal(t, 1, countIntents(t, journal))
+
+	// Recovery fails while the database does, and completes the commit once it works.
+	_, err = NewAtomicCommitter(journal, dbs)
+	require.Equal(t, errTestFault, err)
+	blocks.ClearFaults()
+	_, err = NewAtomicCommitter(journal, dbs)
+	require.NoError(t, err)
+	checkValue(t, state, []byte("key"), []byte{1})
+	checkValue(t, blocks, []byte("block"), []byte{1})
+	require.Zero(t, countIntents(t, journal))
+
+	// A transient failure is retried by the commit itself.
+	blocks.AddFault(Fault{Ops: FaultBatchWrite, Nth: 1, Err: errTestFault})
+	batch = c.NewBatch()
+	blocksBatch, err = batch.Batch("blocks")
+	require.NoError(t, err)
+	require.NoError(t, blocksBatch.Set([]byte("block"), []byte{2}))
+	require.NoError(t, batch.Write())
+	checkValue(t, blocks, []byte("block"), []byte{2})
+	require.Zero(t, countIntents(t, journal))
+
+	// A pending commit is completed before the next commit.
+	blocks.AddFault(Fault{Ops: FaultBatchWrite, Err: errTestFault})
+	batch = c.NewBatch()
+	blocksBatch, err = batch.Batch("blocks")
+	require.NoError(t, err)
+	require.NoError(t, blocksBatch.Set([]byte("block"), []byte{3}))
+	require.True(t, errors.Is(batch.Write(), ErrAtomicCommitPending))
+	checkValue(t, blocks, []byte("block"), []byte{2})
+
+	// The batch is closed once its intent is durable, so that retrying doesn't commit it twice.
+	require.Equal(t, errBatchClosed, batch.Write())
+	require.Equal(t, errBatchClosed, blocksBatch.Set([]byte("block"), []byte{4}))
+	require.Equal(t, 1, countIntents(t, journal))
+	blocks.ClearFaults()
+
+	batch = c.NewBatch()
+	stateBatch, err = batch.Batch("state")
+	require.NoError(t, err)
+	require.NoError(t, stateBatch.Set([]byte("key"), []byte{3}))
+	require.NoError(t, batch.Write())
+	checkValue(t, blocks, []byte("block"), []byte{3})
+	checkValue(t, state, []byte("key"), []byte{3})
+	require.Zero(t, countIntents(t, journal))
+
+	// Intents for unknown databases, or corrupted ones, fail the recovery.
+	require.NoError(t, journal.Set([]byte{0, 0, 0, 0, 0, 0, 0, 9}, encodeIntent(map[string][]operation{
+		"unknown": {{opTypeSet, []byte("key"), []byte{1}}},
+	})))
+	_, err = NewAtomicCommitter(journal, dbs)
+	require.True(t, errors.Is(err, ErrAtomicCommitUnknownDB))
+	require.NoError(t, journal.Set([]byte{0, 0, 0, 0, 0, 0, 0, 9}, []byte{0xff}))
+	_, err = NewAtomicCommitter(journal, dbs)
+	require.True(t, errors.Is(err, errAtomicCommitIntentCorrupted))
+}
+
+// countIntents returns the number of intents in a journal.
+func countIntents(t *testing.T, journal DB) int {
+	t.Helper()
+
+	itr, err := journal.Iterator(nil, nil)
+	require.NoError(t, err)
+	defer itr.Close()
+	count := 0
+	for ; itr.Valid(); itr.Next() {
+		count++
+	}
+	require.NoError(t, itr.Error())
+	return count
+}
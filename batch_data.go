@@ -0,0 +1,261 @@
+package db
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+)
+
+const (
+	// The size of the header of serialized batches: a sequence number, always zero, and the
+	// number of operations, both little-endian.
+	batchHeaderLen = 8 + 4
+)
+
+// errBatchDataCorrupted is returned when decoding invalid batch data.
+var errBatchDataCorrupted = errors.New("batch data is corrupted")
+
+// BatchOpType is the type of a BatchOp. The values are the record kinds of the batch data.
+type BatchOpType byte
+
+const (
+	// BatchOpDelete deletes a key.
+	BatchOpDelete BatchOpType = 0
+	// BatchOpSet sets a key.
+	BatchOpSet BatchOpType = 1
+	// BatchOpMerge merges an operand into a key, see Merger.
+	BatchOpMerge BatchOpType = 2
+)
+
+// BatchOp is an operation of a batch.
+type BatchOp struct {
+	Type  BatchOpType
+	Key   []byte
+	Value []byte // nil for deletes
+}
+
+// SerializableBatch is implemented by batches which can serialize their pending operations, e.g.
+// to ship them to another process or write them to an audit log before applying them.
+//
+// The data is in the batch format of LevelDB, RocksDB and pebble: a 12-byte header with a zero
+// sequence number and the number of operations, followed by one record per operation with its
+// type, and its varint length-prefixed key and value. It is the same for all backends, so data
+// serialized by one backend can be loaded by another.
+type SerializableBatch interface {
+	// Data returns the pending operations of the batch, serialized.
+	Data() ([]byte, error)
+
+	// SetData replaces the pending operations of the batch with the serialized ones in data. On
+	// errors, the batch is left unchanged.
+	SetData(data []byte) error
+
+	// Replay calls fn with each pending operation of the batch, in order, until fn returns an
+	// error. The keys and values must not be modified, and are only valid until the batch is
+	// modified.
+	Replay(fn func(op BatchOp) error) error
+}
+
+// NewBatchFromData creates a new batch for db with the operations serialized in data, e.g. by
+// SerializableBatch.Data. If the batch does not implement SerializableBatch, the operations are
+// added one by one.
+func NewBatchFromData(db DB, data []byte) (Batch, error) {
+	batch := db.NewBatch()
+	var err error
+	if sbatch, ok := batch.(SerializableBatch); ok {
+		err = sbatch.SetData(data)
+	} else {
+		err = ReplayBatchData(data, func(op BatchOp) error {
+			return applyBatchOp(batch, op)
+		})
+	}
+	if err != nil {
+		batch.Close()
+		return nil, err
+	}
+	return batch, nil
+}
+
+// ReplayBatchData calls fn with each operation serialized in data, in order, until fn returns an
+// error. The keys and values point into data.
+func ReplayBatchData(data []byte, fn func(op BatchOp) error) error {
+	if len(data) < batchHeaderLen {
+		return fmt.Errorf("%w: too short", errBatchDataCorrupted)
+	}
+	count := binary.LittleEndian.Uint32(data[8:batchHeaderLen])
+	data = data[batchHeaderLen:]
+
+	for i := uint32(0); i < count; i++ {
+		if len(data) == 0 {
+			return fmt.Errorf("%w: expected %d operations, got %d", errBatchDataCorrupted, count, i)
+		}
+		op := BatchOp{Type: BatchOpType(data[0])}
+		data = data[1:]
+
+		var ok bool
+		op.Key, data, ok = decodeBatchField(data)
+		if !ok || len(op.Key) == 0 {
+			return fmt.Errorf("%w: invalid key in operation %d", errBatchDataCorrupted, i)
+		}
+		switch op.Type {
+		case BatchOpDelete:
+		case BatchOpSet, BatchOpMerge:
+			op.Value, data, ok = decodeBatchField(data)
+			if !ok {
+				return fmt.Errorf("%w: invalid value in operation %d", errBatchDataCorrupted, i)
+			}
+		default:
+			return fmt.Errorf("%w: unknown type %d of operation %d", errBatchDataCorrupted, op.Type, i)
+		}
+		if err := fn(op); err != nil {
+			return err
+		}
+	}
+	if len(data) > 0 {
+		return fmt.Errorf("%w: %d trailing bytes", errBatchDataCorrupted, len(data))
+	}
+	return nil
+}
+
+// decodeBatchField decodes a varint length-prefixed field, returning it and the rest of data.
+func decodeBatchField(data []byte) ([]byte, []byte, bool) {
+	size, n := binary.Uvarint(data)
+	if n <= 0 || size > uint64(len(data)-n) {
+		return nil, nil, false
+	}
+	field := data[n : n+int(size)]
+	if field == nil {
+		field = []byte{}
+	}
+	return field, data[n+int(size):], true
+}
+
+// encodeBatchOps serializes operations in the batch data format.
+func encodeBatchOps(ops []operation) []byte {
+	size := batchHeaderLen
+	for _, op := range ops {
+		size += 1 + 2*binary.MaxVarintLen32 + len(op.key) + len(op.value)
+	}
+	data := make([]byte, batchHeaderLen, size)
+	binary.LittleEndian.PutUint32(data[8:], uint32(len(ops)))
+	for _, op := range ops {
+		batchOp := op.batchOp()
+		data = append(data, byte(batchOp.Type))
+		data = binary.AppendUvarint(data, uint64(len(op.key)))
+		data = append(data, op.key...)
+		if batchOp.Type != BatchOpDelete {
+			data = binary.AppendUvarint(data, uint64(len(op.value)))
+			data = append(data, op.value...)
+		}
+	}
+	return data
+}
+
+// applyBatchOp adds an operation to a batch.
+func applyBatchOp(batch Batch, op BatchOp) error {
+	switch op.Type {
+	case BatchOpSet:
+		return batch.Set(op.Key, op.Value)
+	case BatchOpDelete:
+		return batch.Delete(op.Key)
+	case BatchOpMerge:
+		merger, ok := batch.(Merger)
+		if !ok {
+			return errMergeOperatorMissing
+		}
+		return merger.Merge(op.Key, op.Value)
+	default:
+		return fmt.Errorf("unknown batch operation type %d", op.Type)
+	}
+}
+
+// newOperation returns a BatchOp as an operation.
+func newOperation(op BatchOp) operation {
+	switch op.Type {
+	case BatchOpDelete:
+		return operation{opTypeDelete, op.Key, nil}
+	case BatchOpMerge:
+		return operation{opTypeMerge, op.Key, op.Value}
+	default:
+		return operation{opTypeSet, op.Key, op.Value}
+	}
+}
+
+// batchOp returns the operation as a BatchOp.
+func (op operation) batchOp() BatchOp {
+	if op.opType == opTypeDelete {
+		return BatchOp{Type: BatchOpDelete, Key: op.key}
+	}
+	value := op.value
+	if value == nil {
+		// goleveldb replays empty values as nil.
+		value = []byte{}
+	}
+	if op.opType == opTypeMerge {
+		return BatchOp{Type: BatchOpMerge, Key: op.key, Value: value}
+	}
+	return BatchOp{Type: BatchOpSet, Key: op.key, Value: value}
+}
+
+// recordingBatch wraps a batch and records its operations, for database wrappers which act on the
+// operations of batches when they are written, such as HookDB, ChangeFeedDB and GroupCommitDB. The
+// wrappers embed it and implement Write and WriteSync, which must call reset once the batch is
+// written.
+type recordingBatch struct {
+	Batch
+	ops    []operation
+	closed bool // set once the batch is written or closed, after which it can't be written again
+}
+
+var _ Merger = (*recordingBatch)(nil)
+
+// Set implements Batch.
+func (b *recordingBatch) Set(key, value []byte) error {
+	if err := b.Batch.Set(key, value); err != nil {
+		return err
+	}
+	b.ops = append(b.ops, operation{opTypeSet, key, value})
+	return nil
+}
+
+// Delete implements Batch.
+func (b *recordingBatch) Delete(key []byte) error {
+	if err := b.Batch.Delete(key); err != nil {
+		return err
+	}
+	b.ops = append(b.ops, operation{opTypeDelete, key, nil})
+	return nil
+}
+
+// Merge implements Merger, if the underlying batch does.
+func (b *recordingBatch) Merge(key, operand []byte) error {
+	merger, ok := b.Batch.(Merger)
+	if !ok {
+		return errMergeOperatorMissing
+	}
+	if err := merger.Merge(key, operand); err != nil {
+		return err
+	}
+	b.ops = append(b.ops, operation{opTypeMerge, key, operand})
+	return nil
+}
+
+// keys returns the keys of the recorded operations.
+func (b *recordingBatch) keys() [][]byte {
+	keys := make([][]byte, 0, len(b.ops))
+	for _, op := range b.ops {
+		keys = append(keys, op.key)
+	}
+	return keys
+}
+
+// reset forgets the recorded operations, once the batch is written or closed.
+func (b *recordingBatch) reset() {
+	b.ops = nil
+	b.closed = true
+}
+
+// Close implements Batch.
+func (b *recordingBatch) Close() error {
+	b.reset()
+	return b.Batch.Close()
+}
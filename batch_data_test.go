@@ -0,0 +1,156 @@
+package db
+
+import (
+	"errors"
+	"os"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestSerializableBatch(t *testing.T) {
+	// The data of a MemDB batch, which all backends must produce too.
+	mbatch := NewMemDB().NewBatch()
+	require.NoError(t, mbatch.Set([]byte("a"), []byte{1}))
+	require.NoError(t, mbatch.Delete([]byte("b")))
+	require.NoError(t, mbatch.Set([]byte("c"), []byte{}))
+	expectData, err := mbatch.(SerializableBatch).Data()
+	require.NoError(t, err)
+	require.Equal(t, []byte{
+		0, 0, 0, 0, 0, 0, 0, 0, 3, 0, 0, 0, // header
+		1, 1, 'a', 1, 1, // set a
+		0, 1, 'b', // delete b
+		1, 1, 'c', 0, // set c
+	}, expectData)
+	expectOps := []BatchOp{
+		{Type: BatchOpSet, Key: []byte("a"), Value: []byte{1}},
+		{Type: BatchOpDelete, Key: []byte("b")},
+		{Type: BatchOpSet, Key: []byte("c"), Value: []byte{}},
+	}
+
+	for backend := range backends {
+		backend := backend
+		t.Run(string(backend), func(t *testing.T) {
+			db, dir := newTempDB(t, backend)
+			defer os.RemoveAll(dir)
+			defer db.Close()
+
+			require.NoError(t, db.Set([]byte("b"), []byte{2}))
+
+			batch := db.NewBatch()
+			defer batch.Close()
+			sbatch, ok := batch.(SerializableBatch)
+			require.True(t, ok)
+			data, err := sbatch.Data()
+			require.NoError(t, err)
+			require.Equal(t, make([]byte, batchHeaderLen), data)
+
+			require.NoError(t, batch.Set([]byte("a"), []byte{1}))
+			require.NoError(t, batch.Delete([]byte("b")))
+			require.NoError(t, batch.Set([]byte("c"), []byte{}))
+			data, err = sbatch.Data()
+			require.NoError(t, err)
+			require.Equal(t, expectData, data)
+			require.Equal(t, expectOps, replayOps(t, sbatch))
+
+			// Invalid data leaves the batch unchanged.
+			err = sbatch.SetData(data[:len(data)-1])
+			require.True(t, errors.Is(err, errBatchDataCorrupted), err)
+			require.Equal(t, expectOps, replayOps(t, sbatch))
+
+			// Data replaces the pending operations.
+			other, err := NewBatchFromData(db, expectData)
+			require.NoError(t, err)
+			require.NoError(t, other.Set([]byte("d"), []byte{4}))
+			otherData, err := other.(SerializableBatch).Data()
+			require.NoError(t, err)
+			require.NoError(t, other.Close())
+			require.NoError(t, sbatch.SetData(otherData))
+			require.Equal(t, append(expectOps, BatchOp{Type: BatchOpSet, Key: []byte("d"), Value: []byte{4}}),
+				replayOps(t, sbatch))
+
+			require.NoError(t, batch.Write())
+			checkValue(t, db, []byte("a"), []byte{1})
+			checkValue(t, db, []byte("b"), nil)
+			checkValue(t, db, []byte("c"), []byte{})
+			checkValue(t, db, []byte("d"), []byte{4})
+
+			_, err = sbatch.Data()
+			require.Equal(t, errBatchClosed, err)
+			require.Equal(t, errBatchClosed, sbatch.SetData(expectData))
+			require.Equal(t, errBatchClosed, sbatch.Replay(func(BatchOp) error { return nil }))
+		})
+	}
+}
+
+func TestSerializableBatchMerge(t *testing.T) {
+	db := NewMemDBWithMergeOperator(counterMergeOperator{})
+	batch := db.NewBatch()
+	require.NoError(t, batch.Set([]byte("a"), counterValue(1)))
+	require.NoError(t, batch.(Merger).Merge([]byte("a"), counterValue(2)))
+	data, err := batch.(SerializableBatch).Data()
+	require.NoError(t, err)
+	require.NoError(t, batch.Close())
+
+	batch, err = NewBatchFromData(db, data)
+	require.NoError(t, err)
+	require.Equal(t, []BatchOp{
+		{Type: BatchOpSet, Key: []byte("a"), Value: counterValue(1)},
+		{Type: BatchOpMerge, Key: []byte("a"), Value: counterValue(2)},
+	}, replayOps(t, batch.(SerializableBatch)))
+	require.NoError(t, batch.Write())
+	checkValue(t, db, []byte("a"), counterValue(3))
+
+	_, err = NewBatchFromData(NewMemDB(), data)
+	require.Equal(t, errMergeOperatorMissing, err)
+}
+
+func TestPrefixDBSerializableBatch(t *testing.T) {
+	mdb := NewMemDB()
+	pdb := NewPrefixDB(mdb, []byte("p/"))
+
+	batch := pdb.NewBatch()
+	require.NoError(t, batch.Set([]byte("a"), []byte{1}))
+	data, err := batch.(SerializableBatch).Data()
+	require.NoError(t, err)
+	require.NoError(t, batch.Close())
+
+	// The data has unprefixed keys, so it can be loaded into another PrefixDB.
+	batch, err = NewBatchFromData(NewPrefixDB(mdb, []byte("q/")), data)
+	require.NoError(t, err)
+	require.Equal(t, []BatchOp{{Type: BatchOpSet, Key: []byte("a"), Value: []byte{1}}},
+		replayOps(t, batch.(SerializableBatch)))
+	require.NoError(t, batch.Write())
+	checkValue(t, mdb, []byte("q/a"), []byte{1})
+}
+
+func TestReplayBatchData(t *testing.T) {
+	for name, data := range map[string][]byte{
+		"short header":  {0, 0, 0},
+		"missing op":    {0, 0, 0, 0, 0, 0, 0, 0, 1, 0, 0, 0},
+		"unknown type":  {0, 0, 0, 0, 0, 0, 0, 0, 1, 0, 0, 0, 9, 1, 'a'},
+		"empty key":     {0, 0, 0, 0, 0, 0, 0, 0, 1, 0, 0, 0, 0, 0},
+		"short key":     {0, 0, 0, 0, 0, 0, 0, 0, 1, 0, 0, 0, 0, 2, 'a'},
+		"missing value": {0, 0, 0, 0, 0, 0, 0, 0, 1, 0, 0, 0, 1, 1, 'a'},
+		"trailing":      {0, 0, 0, 0, 0, 0, 0, 0, 1, 0, 0, 0, 0, 1, 'a', 0},
+	} {
+		err := ReplayBatchData(data, func(BatchOp) error { return nil })
+		require.True(t, errors.Is(err, errBatchDataCorrupted), name)
+	}
+}
+
+// replayOps returns copies of the pending operations of a batch.
+func replayOps(t *testing.T, batch SerializableBatch) []BatchOp {
+	t.Helper()
+
+	var ops []BatchOp
+	require.NoError(t, batch.Replay(func(op BatchOp) error {
+		copied := BatchOp{Type: op.Type, Key: cp(op.Key)}
+		if op.Value != nil {
+			copied.Value = cp(op.Value)
+		}
+		ops = append(ops, copied)
+		return nil
+	}))
+	return ops
+}
@@ -0,0 +1,64 @@
+package db
+
+import (
+	"os"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestReusableBatch(t *testing.T) {
+	for backend := range backends {
+		backend := backend
+		t.Run(string(backend), func(t *testing.T) {
+			db, dir := newTempDB(t, backend)
+			defer os.RemoveAll(dir)
+			defer db.Close()
+
+			batch := db.NewBatch()
+			defer batch.Close()
+			rbatch, ok := batch.(ReusableBatch)
+			require.True(t, ok)
+
+			count, err := rbatch.Count()
+			require.NoError(t, err)
+			require.Zero(t, count)
+			require.NoError(t, batch.Set([]byte("a"), []byte{1}))
+			require.NoError(t, batch.Delete([]byte("b")))
+			count, err = rbatch.Count()
+			require.NoError(t, err)
+			require.Equal(t, 2, count)
+
+			// Reset discards the pending operations.
+			require.NoError(t, rbatch.Reset())
+			count, err = rbatch.Count()
+			require.NoError(t, err)
+			require.Zero(t, count)
+			require.NoError(t, batch.Set([]byte("c"), []byte{3}))
+			require.NoError(t, batch.Write())
+			checkValue(t, db, []byte("a"), nil)
+			checkValue(t, db, []byte("c"), []byte{3})
+
+			// Written batches can't be used until they are reset.
+			_, err = rbatch.Count()
+			require.Equal(t, errBatchClosed, err)
+			require.Equal(t, errBatchClosed, batch.Set([]byte("d"), []byte{4}))
+			for i := byte(0); i < 3; i++ {
+				require.NoError(t, rbatch.Reset())
+				require.NoError(t, batch.Set([]byte("d"), []byte{i}))
+				count, err = rbatch.Count()
+				require.NoError(t, err)
+				require.Equal(t, 1, count)
+				require.NoError(t, batch.WriteSync())
+				checkValue(t, db, []byte("d"), []byte{i})
+			}
+
+			// So can closed batches.
+			require.NoError(t, batch.Close())
+			require.NoError(t, rbatch.Reset())
+			require.NoError(t, batch.Set([]byte("e"), []byte{5}))
+			require.NoError(t, batch.Write())
+			checkValue(t, db, []byte("e"), []byte{5})
+		})
+	}
+}
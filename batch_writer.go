@@ -0,0 +1,163 @@
+package db
+
+const (
+	// The default MaxByteSize of BatchWriterOptions.
+	defaultBatchWriterMaxByteSize = 16 << 20
+)
+
+// BatchWriterOptions configures a BatchWriter.
+type BatchWriterOptions struct {
+	// MaxByteSize is the size of the batches, as given by Batch.GetByteSize, at which they are
+	// written. Zero uses a default of 16 MiB, and a negative value is unlimited.
+	MaxByteSize int
+
+	// MaxOps is the number of operations of the batches at which they are written. Zero is
+	// unlimited.
+	MaxOps int
+
+	// SyncFlush writes the last batch with WriteSync on Flush, so all the writes are durable once
+	// Flush returns. The batches written when crossing a threshold are never synced.
+	SyncFlush bool
+}
+
+// BatchWriter writes a stream of operations to a database in bounded batches, e.g. for
+// migrations and pruning. A batch is written, and a new one started, whenever it reaches the
+// size or operation count thresholds, so the operations are not atomic as a whole. Flush must be
+// called to write the last batch. A BatchWriter is not safe for concurrent use.
+//
+// If writing a batch fails, the batch is kept with its operations, and writing it is retried by
+// the next operation or Flush.
+type BatchWriter struct {
+	db     DB
+	opts   BatchWriterOptions
+	batch  Batch
+	ops    int
+	closed bool
+}
+
+// NewBatchWriter creates a new BatchWriter writing to db.
+func NewBatchWriter(db DB, opts BatchWriterOptions) *BatchWriter {
+	if opts.MaxByteSize == 0 {
+		opts.MaxByteSize = defaultBatchWriterMaxByteSize
+	}
+	return &BatchWriter{
+		db:   db,
+		opts: opts,
+	}
+}
+
+// Set sets a key, writing the pending batch first if it is full. If that write fails, the key is
+// not set.
+// CONTRACT: key, value readonly []byte
+func (w *BatchWriter) Set(key, value []byte) error {
+	if err := w.prepare(); err != nil {
+		return err
+	}
+	if err := w.batch.Set(key, value); err != nil {
+		return err
+	}
+	w.ops++
+	return nil
+}
+
+// Delete deletes a key, writing the pending batch first if it is full. If that write fails, the
+// key is not deleted.
+// CONTRACT: key readonly []byte
+func (w *BatchWriter) Delete(key []byte) error {
+	if err := w.prepare(); err != nil {
+		return err
+	}
+	if err := w.batch.Delete(key); err != nil {
+		return err
+	}
+	w.ops++
+	return nil
+}
+
+// prepare makes a batch ready for an operation. Full batches are only written when the next
+// operation comes, so that Flush always has a batch to sync if there were any operations.
+func (w *BatchWriter) prepare() error {
+	if w.closed {
+		return errBatchClosed
+	}
+	if w.batch == nil {
+		w.batch = w.db.NewBatch()
+		return nil
+	}
+	full, err := w.full()
+	if err != nil || !full {
+		return err
+	}
+	if err := w.batch.Write(); err != nil {
+		return err
+	}
+	w.ops = 0
+	// Reuse the batch if possible, which may not be the case e.g. for PrefixDB batches over
+	// batches without reuse.
+	if batch, ok := w.batch.(ReusableBatch); ok && batch.Reset() == nil {
+		return nil
+	}
+	_ = w.batch.Close()
+	w.batch = w.db.NewBatch()
+	return nil
+}
+
+// full returns whether the pending batch reached a threshold.
+func (w *BatchWriter) full() (bool, error) {
+	if w.opts.MaxOps > 0 && w.ops >= w.opts.MaxOps {
+		return true, nil
+	}
+	if w.opts.MaxByteSize < 0 {
+		return false, nil
+	}
+	size, err := w.batch.GetByteSize()
+	if err != nil {
+		return false, err
+	}
+	return size >= w.opts.MaxByteSize, nil
+}
+
+// Flush writes the pending batch, if any, with WriteSync if SyncFlush is set. The writer can
+// still be used afterwards. If the write fails, the batch is kept, so that Flush can be retried.
+func (w *BatchWriter) Flush() error {
+	if w.closed {
+		return errBatchClosed
+	}
+	if w.batch == nil {
+		return nil
+	}
+	var err error
+	if w.opts.SyncFlush {
+		err = w.batch.WriteSync()
+	} else {
+		err = w.batch.Write()
+	}
+	if err != nil {
+		return err
+	}
+	w.reset()
+	return nil
+}
+
+// Close discards the pending batch, without writing it. The writer can't be used afterwards.
+func (w *BatchWriter) Close() error {
+	if w.closed {
+		return nil
+	}
+	w.closed = true
+	if w.batch == nil {
+		return nil
+	}
+	err := w.batch.Close()
+	w.reset()
+	return err
+}
+
+// reset releases the pending batch.
+func (w *BatchWriter) reset() {
+	if w.batch != nil {
+		_ = w.batch.Close()
+	}
+	w.batch = nil
+	w.ops = 0
+}
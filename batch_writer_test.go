@@ -0,0 +1,92 @@
+package db
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestBatchWriter(t *testing.T) {
+	for backend := range backends {
+		backend := backend
+		t.Run(string(backend), func(t *testing.T) {
+			db, dir := newTempDB(t, backend)
+			defer os.RemoveAll(dir)
+			defer db.Close()
+
+			require.NoError(t, db.Set([]byte("deleted"), []byte{1}))
+
+			w := NewBatchWriter(db, BatchWriterOptions{MaxOps: 10})
+			defer w.Close()
+			for i := 0; i < 100; i++ {
+				require.NoError(t, w.Set([]byte(fmt.Sprintf("key%03d", i)), []byte{byte(i)}))
+			}
+			require.NoError(t, w.Delete([]byte("deleted")))
+
+			// Full batches are written when the next operation comes, so the last one is pending.
+			checkValue(t, db, []byte("key099"), []byte{99})
+			checkValue(t, db, []byte("deleted"), []byte{1})
+			require.NoError(t, w.Flush())
+			checkValue(t, db, []byte("deleted"), nil)
+
+			// The writer can be used after Flush, but not after Close.
+			require.NoError(t, w.Set([]byte("after"), []byte{1}))
+			require.NoError(t, w.Flush())
+			require.NoError(t, w.Flush())
+			checkValue(t, db, []byte("after"), []byte{1})
+
+			require.NoError(t, w.Set([]byte("discarded"), []byte{1}))
+			require.NoError(t, w.Close())
+			checkValue(t, db, []byte("discarded"), nil)
+			require.Equal(t, errBatchClosed, w.Set([]byte("closed"), []byte{1}))
+			require.Equal(t, errBatchClosed, w.Flush())
+
+			require.Equal(t, errKeyEmpty, NewBatchWriter(db, BatchWriterOptions{}).Set(nil, []byte{1}))
+		})
+	}
+}
+
+func TestBatchWriterRetry(t *testing.T) {
+	fdb := NewFaultDB(NewMemDB())
+	w := NewBatchWriter(fdb, BatchWriterOptions{MaxOps: 2})
+	defer w.Close()
+
+	// A full batch failing to be written is kept, and written by the next operation.
+	fdb.AddFault(Fault{Ops: FaultBatchWrite, Nth: 1, Err: errTestFault})
+	require.NoError(t, w.Set([]byte("a"), []byte{1}))
+	require.NoError(t, w.Set([]byte("b"), []byte{2}))
+	require.Equal(t, errTestFault, w.Set([]byte("c"), []byte{3}))
+	checkValue(t, fdb, []byte("a"), nil)
+	require.NoError(t, w.Set([]byte("c"), []byte{3}))
+	checkValue(t, fdb, []byte("a"), []byte{1})
+	checkValue(t, fdb, []byte("b"), []byte{2})
+
+	// A batch failing to be flushed is kept, and flushed again.
+	fdb.ClearFaults()
+	fdb.AddFault(Fault{Ops: FaultBatchWrite, Nth: 1, Err: errTestFault})
+	require.Equal(t, errTestFault, w.Flush())
+	checkValue(t, fdb, []byte("c"), nil)
+	require.NoError(t, w.Flush())
+	checkValue(t, fdb, []byte("c"), []byte{3})
+}
+
+func TestBatchWriterMaxByteSize(t *testing.T) {
+	var trace bytes.Buffer
+	db := NewTraceDB(NewMemDB(), &trace, TraceOptions{})
+
+	w := NewBatchWriter(db, BatchWriterOptions{MaxByteSize: 100, SyncFlush: true})
+	for i := 0; i < 10; i++ {
+		require.NoError(t, w.Set([]byte(fmt.Sprintf("key%d", i)), make([]byte, 40)))
+	}
+	require.NoError(t, w.Flush())
+
+	// Batches are written once they reach 100 bytes, i.e. every three pairs, and the last one is
+	// synced.
+	require.Equal(t, 3, strings.Count(trace.String(), `"op":"batch_write"`))
+	require.Equal(t, 1, strings.Count(trace.String(), `"op":"batch_write_sync"`))
+	checkValue(t, db, []byte("key9"), make([]byte, 40))
+}
@@ -0,0 +1,109 @@
+package db
+
+import (
+	"io"
+	"os"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestBidirectionalIterator(t *testing.T) {
+	for backend := range backends {
+		backend := backend
+		t.Run(string(backend), func(t *testing.T) {
+			db, dir := newTempDB(t, backend)
+			defer os.RemoveAll(dir)
+			defer db.Close()
+
+			for _, key := range []string{"a", "b", "c", "d", "e"} {
+				require.NoError(t, db.Set([]byte(key), []byte(key)))
+			}
+
+			testCases := map[string]struct {
+				start, end []byte
+				opts       IteratorOptions
+				moves      string
+				expect     []string
+			}{
+				"forward":              {[]byte("b"), []byte("e"), IteratorOptions{}, "NPNNPN", []string{"b", "c", "b", "c", "d", "c", "d"}},
+				"forward past start":   {[]byte("b"), []byte("e"), IteratorOptions{}, "NPP", []string{"b", "c", "b"}},
+				"forward past end":     {[]byte("b"), []byte("e"), IteratorOptions{}, "NNN", []string{"b", "c", "d"}},
+				"reverse":              {[]byte("b"), []byte("e"), IteratorOptions{Reverse: true}, "NPNNP", []string{"d", "c", "d", "c", "b", "c"}},
+				"reverse past end":     {[]byte("b"), []byte("e"), IteratorOptions{Reverse: true}, "P", []string{"d"}},
+				"unbounded":            {nil, nil, IteratorOptions{}, "NNNPPP", []string{"a", "b", "c", "d", "c", "b", "a"}},
+				"unbounded reverse":    {nil, nil, IteratorOptions{Reverse: true}, "NNPPP", []string{"e", "d", "c", "d", "e"}},
+				"key only":             {[]byte("c"), nil, IteratorOptions{KeyOnly: true}, "NNPP", []string{"c", "d", "e", "d", "c"}},
+				"unsafe":               {[]byte("c"), nil, IteratorOptions{Unsafe: true}, "NPNN", []string{"c", "d", "c", "d", "e"}},
+				"prefix same as start": {[]byte("c"), nil, IteratorOptions{PrefixSameAsStart: true, Reverse: true}, "P", []string{"c"}},
+			}
+			for name, tc := range testCases {
+				itr, err := IteratorWithOptions(db, tc.start, tc.end, tc.opts)
+				require.NoError(t, err, name)
+				bitr, ok := itr.(BidirectionalIterator)
+				require.True(t, ok, name)
+
+				require.True(t, bitr.Valid(), name)
+				keys := []string{string(bitr.Key())}
+				for _, move := range tc.moves {
+					if move == 'N' {
+						bitr.Next()
+					} else {
+						bitr.Prev()
+					}
+					if !bitr.Valid() {
+						break
+					}
+					keys = append(keys, string(bitr.Key()))
+					if tc.opts.KeyOnly {
+						require.Nil(t, bitr.Value(), name)
+					} else {
+						require.Equal(t, bitr.Key(), bitr.Value(), name)
+					}
+				}
+				require.Equal(t, tc.expect, keys, name)
+
+				// Iterators stay invalid once they run out of their domain, in either direction.
+				for bitr.Valid() {
+					bitr.Next()
+				}
+				require.False(t, bitr.Valid(), name)
+				require.Panics(t, func() { bitr.Prev() }, name)
+				require.NoError(t, bitr.Error(), name)
+				require.NoError(t, bitr.Close(), name)
+			}
+		})
+	}
+}
+
+func TestPrefixDBBidirectionalIterator(t *testing.T) {
+	mdb := NewMemDB()
+	require.NoError(t, mdb.Set([]byte("k"), []byte{0}))
+	require.NoError(t, mdb.Set([]byte("ka"), []byte{1}))
+	require.NoError(t, mdb.Set([]byte("kb"), []byte{2}))
+	require.NoError(t, mdb.Set([]byte("l"), []byte{3}))
+	pdb := NewPrefixDB(mdb, []byte("k"))
+
+	itr, err := pdb.Iterator(nil, nil)
+	require.NoError(t, err)
+	defer itr.Close()
+	bitr, ok := itr.(BidirectionalIterator)
+	require.True(t, ok)
+	require.Equal(t, []byte("a"), bitr.Key())
+	bitr.Next()
+	require.Equal(t, []byte("b"), bitr.Key())
+	bitr.Prev()
+	require.Equal(t, []byte("a"), bitr.Key())
+	// The key matching the prefix exactly is skipped, and the underlying iterator leaves the
+	// prefix.
+	bitr.Prev()
+	require.False(t, bitr.Valid())
+
+	// Iterators over databases without bidirectional iterators don't implement it.
+	tdb := NewPrefixDB(NewTraceDB(mdb, io.Discard, TraceOptions{}), []byte("k"))
+	itr, err = tdb.Iterator(nil, nil)
+	require.NoError(t, err)
+	defer itr.Close()
+	_, ok = itr.(BidirectionalIterator)
+	require.False(t, ok)
+}
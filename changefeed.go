@@ -0,0 +1,325 @@
+package db
+
+import (
+	"bytes"
+	"sync"
+	"sync/atomic"
+)
+
+// ChangeSet is a committed write, or batch of writes, delivered by a ChangeFeedDB.
+type ChangeSet struct {
+	// Seq is the sequence number of the commit, starting at 1 for the first commit through the
+	// ChangeFeedDB.
+	Seq uint64
+
+	// Ops are the operations of the commit matching the subscription, in order. Merges have the
+	// merge operand as value, not the merged value.
+	Ops []BatchOp
+}
+
+// ChangeFeedDB wraps a database and delivers its committed writes to subscribers, e.g. streaming
+// indexers, as they happen. Each Set, Delete, or batch write is delivered after it is committed as
+// a ChangeSet, with the operations on keys with the prefix of the subscription. Failed writes are
+// not delivered.
+//
+// While there are subscribers, writes are serialized, so that changes are delivered in commit
+// order, and subscribers are called before the write returns: slow subscribers slow down writes,
+// and subscribers must not write to the database. They can subscribe and cancel subscriptions,
+// including their own. Without subscribers, writes are not serialized.
+//
+// Merges and conditional writes are forwarded to the underlying database if it supports them.
+// Conditional writes are only delivered if they are applied, as the set or delete they make.
+// ChangeFeedDB does not implement Ingester, so that Ingest falls back to writing the files in
+// batches, which are delivered.
+type ChangeFeedDB struct {
+	db DB
+
+	writeMtx sync.Mutex // serializes writes while there are subscribers
+	seq      uint64     // sequence number of the last commit, accessed atomically
+	nsubs    int32      // number of subscribers, accessed atomically
+
+	mtx  sync.Mutex // guards subs
+	subs map[*changeFeedSub]struct{}
+}
+
+// changeFeedSub is a subscription to a ChangeFeedDB.
+type changeFeedSub struct {
+	prefix []byte
+	fn     func(ChangeSet)
+}
+
+var (
+	_ DB                  = (*ChangeFeedDB)(nil)
+	_ Merger              = (*ChangeFeedDB)(nil)
+	_ ConditionalWriter   = (*ChangeFeedDB)(nil)
+	_ MultiGetter         = (*ChangeFeedDB)(nil)
+	_ IterableWithOptions = (*ChangeFeedDB)(nil)
+)
+
+// NewChangeFeedDB creates a new ChangeFeedDB wrapping db.
+func NewChangeFeedDB(db DB) *ChangeFeedDB {
+	return &ChangeFeedDB{
+		db:   db,
+		subs: make(map[*changeFeedSub]struct{}),
+	}
+}
+
+// Subscribe calls fn with the changes to keys with the given prefix, until the returned cancel
+// function is called. An empty prefix subscribes to all changes. fn is called after the write is
+// committed, before it returns, and can retain the change set. A write in progress may still call
+// fn once after cancel returns.
+func (cdb *ChangeFeedDB) Subscribe(prefix []byte, fn func(ChangeSet)) (cancel func()) {
+	sub := &changeFeedSub{prefix: cp(prefix), fn: fn}
+	cdb.mtx.Lock()
+	cdb.subs[sub] = struct{}{}
+	atomic.AddInt32(&cdb.nsubs, 1)
+	cdb.mtx.Unlock()
+
+	var once sync.Once
+	return func() {
+		once.Do(func() {
+			cdb.mtx.Lock()
+			delete(cdb.subs, sub)
+			atomic.AddInt32(&cdb.nsubs, -1)
+			cdb.mtx.Unlock()
+		})
+	}
+}
+
+// SubscribeChan delivers the changes to keys with the given prefix to a channel with the given
+// buffer size, until the returned cancel function is called, which closes the channel. Writes
+// block while the buffer is full.
+func (cdb *ChangeFeedDB) SubscribeChan(prefix []byte, size int) (<-chan ChangeSet, func()) {
+	ch := make(chan ChangeSet, size)
+	done := make(chan struct{})
+	var mtx sync.Mutex // held by deliveries, so that ch is not closed during one
+	closed := false
+	cancel := cdb.Subscribe(prefix, func(changes ChangeSet) {
+		mtx.Lock()
+		defer mtx.Unlock()
+		if closed {
+			return
+		}
+		select {
+		case ch <- changes:
+		case <-done:
+		}
+	})
+
+	var once sync.Once
+	return ch, func() {
+		once.Do(func() {
+			// Unblock a pending delivery first, as it holds mtx.
+			close(done)
+			cancel()
+			mtx.Lock()
+			closed = true
+			close(ch)
+			mtx.Unlock()
+		})
+	}
+}
+
+// write runs a write, and delivers its operations to the subscribers once it succeeds.
+func (cdb *ChangeFeedDB) write(ops []operation, apply func() error) error {
+	_, err := cdb.writeIf(ops, func() (bool, error) {
+		return true, apply()
+	})
+	return err
+}
+
+// writeIf runs a write which may not be applied, i.e. a conditional write, and delivers its
+// operations to the subscribers if it is.
+func (cdb *ChangeFeedDB) writeIf(ops []operation, apply func() (bool, error)) (bool, error) {
+	if atomic.LoadInt32(&cdb.nsubs) == 0 {
+		applied, err := apply()
+		if err == nil && applied {
+			atomic.AddUint64(&cdb.seq, 1)
+		}
+		return applied, err
+	}
+
+	cdb.writeMtx.Lock()
+	defer cdb.writeMtx.Unlock()
+
+	applied, err := apply()
+	if err != nil || !applied {
+		return applied, err
+	}
+	seq := atomic.AddUint64(&cdb.seq, 1)
+
+	// Deliver without holding mtx, so that subscribers can cancel their subscription.
+	cdb.mtx.Lock()
+	subs := make([]*changeFeedSub, 0, len(cdb.subs))
+	for sub := range cdb.subs {
+		subs = append(subs, sub)
+	}
+	cdb.mtx.Unlock()
+	for _, sub := range subs {
+		changes := ChangeSet{Seq: seq}
+		for _, op := range ops {
+			if !bytes.HasPrefix(op.key, sub.prefix) {
+				continue
+			}
+			batchOp := op.batchOp()
+			batchOp.Key = cp(batchOp.Key)
+			if batchOp.Value != nil {
+				batchOp.Value = cp(batchOp.Value)
+			}
+			changes.Ops = append(changes.Ops, batchOp)
+		}
+		if len(changes.Ops) > 0 {
+			sub.fn(changes)
+		}
+	}
+	return true, nil
+}
+
+// Get implements DB.
+func (cdb *ChangeFeedDB) Get(key []byte) ([]byte, error) {
+	return cdb.db.Get(key)
+}
+
+// Has implements DB.
+func (cdb *ChangeFeedDB) Has(key []byte) (bool, error) {
+	return cdb.db.Has(key)
+}
+
+// Set implements DB.
+func (cdb *ChangeFeedDB) Set(key, value []byte) error {
+	return cdb.write([]operation{{opTypeSet, key, value}}, func() error {
+		return cdb.db.Set(key, value)
+	})
+}
+
+// SetSync implements DB.
+func (cdb *ChangeFeedDB) SetSync(key, value []byte) error {
+	return cdb.write([]operation{{opTypeSet, key, value}}, func() error {
+		return cdb.db.SetSync(key, value)
+	})
+}
+
+// Delete implements DB.
+func (cdb *ChangeFeedDB) Delete(key []byte) error {
+	return cdb.write([]operation{{opTypeDelete, key, nil}}, func() error {
+		return cdb.db.Delete(key)
+	})
+}
+
+// DeleteSync implements DB.
+func (cdb *ChangeFeedDB) DeleteSync(key []byte) error {
+	return cdb.write([]operation{{opTypeDelete, key, nil}}, func() error {
+		return cdb.db.DeleteSync(key)
+	})
+}
+
+// Merge implements Merger, if the underlying database supports merges.
+func (cdb *ChangeFeedDB) Merge(key, operand []byte) error {
+	merger, ok := cdb.db.(Merger)
+	if !ok {
+		return errMergeOperatorMissing
+	}
+	return cdb.write([]operation{{opTypeMerge, key, operand}}, func() error {
+		return merger.Merge(key, operand)
+	})
+}
+
+// CompareAndSwap implements ConditionalWriter, if the underlying database supports it.
+func (cdb *ChangeFeedDB) CompareAndSwap(key, oldValue, newValue []byte) (bool, error) {
+	writer, ok := cdb.db.(ConditionalWriter)
+	if !ok {
+		return false, errConditionalWritesUnsupported
+	}
+	op := operation{opTypeSet, key, newValue}
+	if newValue == nil {
+		op = operation{opTypeDelete, key, nil}
+	}
+	return cdb.writeIf([]operation{op}, func() (bool, error) {
+		return writer.CompareAndSwap(key, oldValue, newValue)
+	})
+}
+
+// SetIfAbsent implements ConditionalWriter, if the underlying database supports it.
+func (cdb *ChangeFeedDB) SetIfAbsent(key, value []byte) (bool, error) {
+	writer, ok := cdb.db.(ConditionalWriter)
+	if !ok {
+		return false, errConditionalWritesUnsupported
+	}
+	return cdb.writeIf([]operation{{opTypeSet, key, value}}, func() (bool, error) {
+		return writer.SetIfAbsent(key, value)
+	})
+}
+
+// MultiGet implements MultiGetter.
+func (cdb *ChangeFeedDB) MultiGet(keys [][]byte) ([][]byte, error) {
+	return MultiGet(cdb.db, keys)
+}
+
+// Iterator implements DB.
+func (cdb *ChangeFeedDB) Iterator(start, end []byte) (Iterator, error) {
+	return cdb.db.Iterator(start, end)
+}
+
+// ReverseIterator implements DB.
+func (cdb *ChangeFeedDB) ReverseIterator(start, end []byte) (Iterator, error) {
+	return cdb.db.ReverseIterator(start, end)
+}
+
+// IteratorWithOptions implements IterableWithOptions.
+func (cdb *ChangeFeedDB) IteratorWithOptions(start, end []byte, opts IteratorOptions) (Iterator, error) {
+	return IteratorWithOptions(cdb.db, start, end, opts)
+}
+
+// Close implements DB.
+func (cdb *ChangeFeedDB) Close() error {
+	return cdb.db.Close()
+}
+
+// NewBatch implements DB.
+func (cdb *ChangeFeedDB) NewBatch() Batch {
+	return &changeFeedBatch{recordingBatch: recordingBatch{Batch: cdb.db.NewBatch()}, cdb: cdb}
+}
+
+// NewBatchWithSize implements DB.
+func (cdb *ChangeFeedDB) NewBatchWithSize(size int) Batch {
+	return &changeFeedBatch{recordingBatch: recordingBatch{Batch: cdb.db.NewBatchWithSize(size)}, cdb: cdb}
+}
+
+// Print implements DB.
+func (cdb *ChangeFeedDB) Print() error {
+	return cdb.db.Print()
+}
+
+// Stats implements DB.
+func (cdb *ChangeFeedDB) Stats() map[string]string {
+	return cdb.db.Stats()
+}
+
+// changeFeedBatch keeps track of the operations of a batch, to deliver them once written.
+type changeFeedBatch struct {
+	recordingBatch
+	cdb *ChangeFeedDB
+}
+
+var (
+	_ Batch  = (*changeFeedBatch)(nil)
+	_ Merger = (*changeFeedBatch)(nil)
+)
+
+// Write implements Batch.
+func (b *changeFeedBatch) Write() error {
+	return b.write(b.Batch.Write)
+}
+
+// WriteSync implements Batch.
+func (b *changeFeedBatch) WriteSync() error {
+	return b.write(b.Batch.WriteSync)
+}
+
+func (b *changeFeedBatch) write(apply func() error) error {
+	if err := b.cdb.write(b.ops, apply); err != nil {
+		return err
+	}
+	b.reset()
+	return nil
+}
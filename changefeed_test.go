@@ -0,0 +1,177 @@
+package db
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestChangeFeedDB(t *testing.T) {
+	for backend := range backends {
+		t.Run(string(backend), func(t *testing.T) {
+			db, dir := newTempDB(t, backend)
+			defer os.RemoveAll(dir)
+			cdb := NewChangeFeedDB(db)
+			defer cdb.Close()
+
+			var changes []ChangeSet
+			cancel := cdb.Subscribe([]byte("a/"), func(cs ChangeSet) {
+				changes = append(changes, cs)
+			})
+			ch, cancelChan := cdb.SubscribeChan(nil, 16)
+
+			require.NoError(t, cdb.Set([]byte("a/1"), []byte{1}))
+			require.NoError(t, cdb.SetSync([]byte("b/1"), []byte{1}))
+			require.NoError(t, cdb.DeleteSync([]byte("a/1")))
+			require.Equal(t, errKeyEmpty, cdb.Set(nil, []byte{1}))
+
+			batch := cdb.NewBatch()
+			require.NoError(t, batch.Set([]byte("a/2"), []byte{2}))
+			require.NoError(t, batch.Set([]byte("b/2"), []byte{}))
+			require.NoError(t, batch.Delete([]byte("a/3")))
+			require.NoError(t, batch.Write())
+			require.Equal(t, errBatchClosed, batch.Write())
+			require.NoError(t, batch.Close())
+
+			// Closed batches are not delivered.
+			batch = cdb.NewBatch()
+			require.NoError(t, batch.Set([]byte("a/4"), []byte{4}))
+			require.NoError(t, batch.Close())
+
+			require.Equal(t, []ChangeSet{
+				{Seq: 1, Ops: []BatchOp{{Type: BatchOpSet, Key: []byte("a/1"), Value: []byte{1}}}},
+				{Seq: 3, Ops: []BatchOp{{Type: BatchOpDelete, Key: []byte("a/1")}}},
+				{Seq: 4, Ops: []BatchOp{
+					{Type: BatchOpSet, Key: []byte("a/2"), Value: []byte{2}},
+					{Type: BatchOpDelete, Key: []byte("a/3")},
+				}},
+			}, changes)
+
+			require.Len(t, ch, 4)
+			require.Equal(t, uint64(1), (<-ch).Seq)
+			require.Equal(t, ChangeSet{
+				Seq: 2,
+				Ops: []BatchOp{{Type: BatchOpSet, Key: []byte("b/1"), Value: []byte{1}}},
+			}, <-ch)
+			require.Equal(t, uint64(3), (<-ch).Seq)
+			require.Len(t, (<-ch).Ops, 3)
+
+			// Canceled subscriptions are not delivered to, and their channels are closed.
+			cancel()
+			cancelChan()
+			cancelChan()
+			require.NoError(t, cdb.Set([]byte("a/5"), []byte{5}))
+			require.Len(t, changes, 3)
+			_, ok := <-ch
+			require.False(t, ok)
+		})
+	}
+}
+
+func TestChangeFeedDBMerge(t *testing.T) {
+	cdb := NewChangeFeedDB(NewMemDBWithMergeOperator(counterMergeOperator{}))
+	ch, cancel := cdb.SubscribeChan(nil, 1)
+	defer cancel()
+
+	batch := cdb.NewBatch()
+	require.NoError(t, batch.(Merger).Merge([]byte("counter"), counterValue(2)))
+	require.NoError(t, batch.WriteSync())
+	require.Equal(t, ChangeSet{
+		Seq: 1,
+		Ops: []BatchOp{{Type: BatchOpMerge, Key: []byte("counter"), Value: counterValue(2)}},
+	}, <-ch)
+}
+
+func TestChangeFeedDBOptionalInterfaces(t *testing.T) {
+	cdb := NewChangeFeedDB(NewMemDBWithMergeOperator(counterMergeOperator{}))
+	ch, cancel := cdb.SubscribeChan(nil, 8)
+	defer cancel()
+
+	// Merges and applied conditional writes are delivered, others are not.
+	require.NoError(t, cdb.Merge([]byte("counter"), counterValue(2)))
+	swapped, err := cdb.CompareAndSwap([]byte("key"), nil, []byte{1})
+	require.NoError(t, err)
+	require.True(t, swapped)
+	swapped, err = cdb.SetIfAbsent([]byte("key"), []byte{2})
+	require.NoError(t, err)
+	require.False(t, swapped)
+	swapped, err = cdb.CompareAndSwap([]byte("key"), []byte{1}, nil)
+	require.NoError(t, err)
+	require.True(t, swapped)
+
+	// Ingestion falls back to batches, which are delivered.
+	path := filepath.Join(t.TempDir(), "ingest.sst")
+	writer, err := NewSSTWriter(cdb, path)
+	require.NoError(t, err)
+	require.NoError(t, writer.Set([]byte("ingested"), []byte{3}))
+	require.NoError(t, writer.Finish())
+	require.NoError(t, Ingest(cdb, []string{path}))
+
+	require.Equal(t, ChangeSet{
+		Seq: 1,
+		Ops: []BatchOp{{Type: BatchOpMerge, Key: []byte("counter"), Value: counterValue(2)}},
+	}, <-ch)
+	require.Equal(t, ChangeSet{
+		Seq: 2,
+		Ops: []BatchOp{{Type: BatchOpSet, Key: []byte("key"), Value: []byte{1}}},
+	}, <-ch)
+	require.Equal(t, ChangeSet{Seq: 3, Ops: []BatchOp{{Type: BatchOpDelete, Key: []byte("key")}}}, <-ch)
+	require.Equal(t, ChangeSet{
+		Seq: 4,
+		Ops: []BatchOp{{Type: BatchOpSet, Key: []byte("ingested"), Value: []byte{3}}},
+	}, <-ch)
+	require.Len(t, ch, 0)
+
+	values, err := cdb.MultiGet([][]byte{[]byte("counter"), []byte("key"), []byte("ingested")})
+	require.NoError(t, err)
+	require.Equal(t, [][]byte{counterValue(2), nil, {3}}, values)
+	itr, err := cdb.IteratorWithOptions(nil, nil, IteratorOptions{Reverse: true})
+	require.NoError(t, err)
+	require.Equal(t, [][2][]byte{{[]byte("ingested"), {3}}, {[]byte("counter"), counterValue(2)}},
+		collectFuzzPairs(t, itr))
+}
+
+func TestChangeFeedDBBlockedCancel(t *testing.T) {
+	cdb := NewChangeFeedDB(NewMemDB())
+	ch, cancel := cdb.SubscribeChan(nil, 0)
+
+	// Canceling unblocks a write waiting for the subscriber.
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		require.NoError(t, cdb.Set([]byte("key"), []byte{1}))
+	}()
+	time.Sleep(50 * time.Millisecond)
+	cancel()
+	<-done
+	_, ok := <-ch
+	require.False(t, ok)
+	checkValue(t, cdb, []byte("key"), []byte{1})
+}
+
+func TestChangeFeedDBCancelFromSubscriber(t *testing.T) {
+	cdb := NewChangeFeedDB(NewMemDB())
+
+	// Writes without subscribers are still counted.
+	require.NoError(t, cdb.Set([]byte("a"), []byte{1}))
+
+	// A subscriber can cancel its own subscription, and subscribe again.
+	var seqs []uint64
+	var cancel func()
+	cancel = cdb.Subscribe(nil, func(cs ChangeSet) {
+		seqs = append(seqs, cs.Seq)
+		cancel()
+		cancel = cdb.Subscribe([]byte("c"), func(cs ChangeSet) {
+			seqs = append(seqs, cs.Seq)
+		})
+	})
+	require.NoError(t, cdb.Set([]byte("b"), []byte{2}))
+	require.NoError(t, cdb.Set([]byte("b"), []byte{3}))
+	require.NoError(t, cdb.Set([]byte("c"), []byte{4}))
+	cancel()
+	require.NoError(t, cdb.Set([]byte("c"), []byte{5}))
+	require.Equal(t, []uint64{2, 4}, seqs)
+}
@@ -5,6 +5,7 @@ import (
 	"encoding/binary"
 	"math/rand"
 	"os"
+	"sync"
 	"testing"
 
 	"github.com/stretchr/testify/require"
@@ -186,6 +187,61 @@ func benchmarkRandomReadsWrites(b *testing.B, db DB) {
 	}
 }
 
+// benchmarkCASWithSyncWrites measures conditional writes to a key, while other goroutines
+// continuously make synced writes to other keys, which should not hold them up.
+func benchmarkCASWithSyncWrites(b *testing.B, db DB) {
+	b.Helper()
+
+	writer, ok := db.(ConditionalWriter)
+	if !ok {
+		b.Skip("conditional writes are not supported")
+	}
+	done := make(chan struct{})
+	var wg sync.WaitGroup
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for {
+				select {
+				case <-done:
+					return
+				default:
+				}
+				key := int642Bytes(rand.Int63()) //nolint:gosec // the keys only need to be spread out
+				if err := db.SetSync(key, key); err != nil {
+					b.Error(err)
+					return
+				}
+			}
+		}()
+	}
+	defer func() {
+		close(done)
+		wg.Wait()
+	}()
+
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		value := int642Bytes(int64(i))
+		swapped, err := writer.CompareAndSwap([]byte("cas"), nil, value)
+		if err != nil {
+			// require.NoError() is very expensive (according to profiler), so check manually
+			b.Fatal(err)
+		}
+		if !swapped {
+			b.Fatal("compare-and-swap failed")
+		}
+		swapped, err = writer.CompareAndSwap([]byte("cas"), value, nil)
+		if err != nil {
+			b.Fatal(err)
+		}
+		if !swapped {
+			b.Fatal("compare-and-swap failed")
+		}
+	}
+}
+
 func int642Bytes(i int64) []byte {
 	buf := make([]byte, 8)
 	binary.BigEndian.PutUint64(buf, uint64(i))
@@ -0,0 +1,48 @@
+package db
+
+import "bytes"
+
+// ConditionalWriter is implemented by databases supporting atomic conditional writes, e.g. for
+// leases or idempotency records. The condition is checked and the write applied atomically with
+// respect to all other writes to the database, including those of other goroutines. Like Set,
+// conditional writes are not flushed to storage before returning.
+//
+// Since not all databases support conditional writes, callers should check for this interface.
+type ConditionalWriter interface {
+	// CompareAndSwap sets key to newValue if its current value is oldValue, and reports whether
+	// it did. A nil oldValue means that the key must not exist, and a nil newValue deletes the
+	// key.
+	// CONTRACT: key, oldValue, newValue readonly []byte
+	CompareAndSwap(key, oldValue, newValue []byte) (bool, error)
+
+	// SetIfAbsent sets key to value if the key does not exist, and reports whether it did.
+	// CONTRACT: key, value readonly []byte
+	SetIfAbsent(key, value []byte) (bool, error)
+}
+
+// compareAndSwap implements CompareAndSwap on top of get, set and del. The caller must prevent
+// concurrent writes.
+func compareAndSwap(
+	key, oldValue, newValue []byte,
+	get func(key []byte) ([]byte, error),
+	set func(key, value []byte) error,
+	del func(key []byte) error,
+) (bool, error) {
+	if len(key) == 0 {
+		return false, errKeyEmpty
+	}
+	existing, err := get(key)
+	if err != nil {
+		return false, err
+	}
+	if (existing == nil) != (oldValue == nil) || !bytes.Equal(existing, oldValue) {
+		return false, nil
+	}
+	if newValue == nil {
+		if existing == nil {
+			return true, nil
+		}
+		return true, del(key)
+	}
+	return true, set(key, newValue)
+}
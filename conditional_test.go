@@ -0,0 +1,141 @@
+package db
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestConditionalWrites(t *testing.T) {
+	for backend := range backends {
+		backend := backend
+		t.Run(string(backend), func(t *testing.T) {
+			db, dir := newTempDB(t, backend)
+			defer os.RemoveAll(dir)
+			defer db.Close()
+			writer, ok := db.(ConditionalWriter)
+			require.True(t, ok)
+
+			ok, err := writer.SetIfAbsent([]byte("a"), []byte{1})
+			require.NoError(t, err)
+			require.True(t, ok)
+			ok, err = writer.SetIfAbsent([]byte("a"), []byte{2})
+			require.NoError(t, err)
+			require.False(t, ok)
+			checkValue(t, db, []byte("a"), []byte{1})
+
+			ok, err = writer.CompareAndSwap([]byte("a"), []byte{2}, []byte{3})
+			require.NoError(t, err)
+			require.False(t, ok)
+			ok, err = writer.CompareAndSwap([]byte("a"), nil, []byte{3})
+			require.NoError(t, err)
+			require.False(t, ok)
+			ok, err = writer.CompareAndSwap([]byte("a"), []byte{1}, []byte{3})
+			require.NoError(t, err)
+			require.True(t, ok)
+			checkValue(t, db, []byte("a"), []byte{3})
+
+			// An empty value is not the same as a missing key.
+			require.NoError(t, db.Set([]byte("b"), []byte{}))
+			ok, err = writer.CompareAndSwap([]byte("b"), nil, []byte{1})
+			require.NoError(t, err)
+			require.False(t, ok)
+			ok, err = writer.SetIfAbsent([]byte("b"), []byte{1})
+			require.NoError(t, err)
+			require.False(t, ok)
+			ok, err = writer.CompareAndSwap([]byte("c"), []byte{}, []byte{1})
+			require.NoError(t, err)
+			require.False(t, ok)
+
+			// A nil new value deletes the key.
+			ok, err = writer.CompareAndSwap([]byte("a"), []byte{3}, nil)
+			require.NoError(t, err)
+			require.True(t, ok)
+			checkValue(t, db, []byte("a"), nil)
+			ok, err = writer.CompareAndSwap([]byte("a"), nil, nil)
+			require.NoError(t, err)
+			require.True(t, ok)
+
+			_, err = writer.CompareAndSwap(nil, nil, []byte{1})
+			require.Equal(t, errKeyEmpty, err)
+			_, err = writer.SetIfAbsent([]byte("a"), nil)
+			require.Equal(t, errValueNil, err)
+		})
+	}
+}
+
+func TestConditionalWritesConcurrent(t *testing.T) {
+	for backend := range backends {
+		backend := backend
+		t.Run(string(backend), func(t *testing.T) {
+			db, dir := newTempDB(t, backend)
+			defer os.RemoveAll(dir)
+			defer db.Close()
+			writer := db.(ConditionalWriter)
+
+			// Exactly one of the concurrent SetIfAbsent calls wins, and all goroutines increment
+			// the counter with a CompareAndSwap loop, concurrently with unrelated writes.
+			require.NoError(t, db.Set([]byte("counter"), []byte("0")))
+			var (
+				wg   sync.WaitGroup
+				mtx  sync.Mutex
+				wins int
+			)
+			for i := 0; i < 8; i++ {
+				i := i
+				wg.Add(1)
+				go func() {
+					defer wg.Done()
+					ok, err := writer.SetIfAbsent([]byte("lease"), []byte{byte(i)})
+					require.NoError(t, err)
+					if ok {
+						mtx.Lock()
+						wins++
+						mtx.Unlock()
+					}
+
+					for j := 0; j < 50; j++ {
+						require.NoError(t, db.Set([]byte(fmt.Sprintf("other/%d", i)), []byte{byte(j)}))
+						for {
+							value, err := db.Get([]byte("counter"))
+							require.NoError(t, err)
+							n, err := strconv.Atoi(string(value))
+							require.NoError(t, err)
+							ok, err := writer.CompareAndSwap([]byte("counter"), value, []byte(strconv.Itoa(n+1)))
+							require.NoError(t, err)
+							if ok {
+								break
+							}
+						}
+					}
+				}()
+			}
+			wg.Wait()
+
+			require.Equal(t, 1, wins)
+			checkValue(t, db, []byte("counter"), []byte("400"))
+		})
+	}
+}
+
+func TestPrefixDBConditionalWrites(t *testing.T) {
+	mdb := NewMemDB()
+	pdb := NewPrefixDB(mdb, []byte("p/"))
+
+	ok, err := pdb.SetIfAbsent([]byte("a"), []byte{1})
+	require.NoError(t, err)
+	require.True(t, ok)
+	ok, err = pdb.CompareAndSwap([]byte("a"), []byte{1}, []byte{2})
+	require.NoError(t, err)
+	require.True(t, ok)
+	checkValue(t, mdb, []byte("p/a"), []byte{2})
+
+	pdb = NewPrefixDB(NewTraceDB(mdb, io.Discard, TraceOptions{}), []byte("p/"))
+	_, err = pdb.SetIfAbsent([]byte("a"), []byte{1})
+	require.Equal(t, errConditionalWritesUnsupported, err)
+}
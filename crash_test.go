@@ -0,0 +1,432 @@
+package db
+
+import (
+	"bytes"
+	"fmt"
+	"math/rand"
+	"os"
+	"sort"
+	"sync"
+	"testing"
+
+	"github.com/cockroachdb/pebble"
+	"github.com/cockroachdb/pebble/vfs"
+	"github.com/stretchr/testify/require"
+	"github.com/syndtr/goleveldb/leveldb/storage"
+)
+
+// crashStorage is an in-memory goleveldb storage which, like pebble's strict vfs.MemFS, only
+// retains the synced contents of files when crashed. Metadata changes (file creation, removal,
+// renames and SetMeta) are considered durable immediately.
+type crashStorage struct {
+	mtx         sync.Mutex
+	files       map[storage.FileDesc]*crashFile
+	meta        storage.FileDesc
+	locked      bool
+	ignoreSyncs bool
+}
+
+var _ storage.Storage = (*crashStorage)(nil)
+
+type crashFile struct {
+	data   []byte
+	synced int
+}
+
+func newCrashStorage() *crashStorage {
+	return &crashStorage{files: make(map[storage.FileDesc]*crashFile)}
+}
+
+// setIgnoreSyncs makes syncs no-ops, so that nothing written from now on survives a crash.
+func (cs *crashStorage) setIgnoreSyncs(ignore bool) {
+	cs.mtx.Lock()
+	defer cs.mtx.Unlock()
+	cs.ignoreSyncs = ignore
+}
+
+// resetToSyncedState drops all unsynced data.
+func (cs *crashStorage) resetToSyncedState() {
+	cs.mtx.Lock()
+	defer cs.mtx.Unlock()
+	for _, f := range cs.files {
+		f.data = f.data[:f.synced]
+	}
+}
+
+type crashStorageLock struct {
+	cs *crashStorage
+}
+
+func (l crashStorageLock) Unlock() {
+	l.cs.mtx.Lock()
+	defer l.cs.mtx.Unlock()
+	l.cs.locked = false
+}
+
+func (cs *crashStorage) Lock() (storage.Locker, error) {
+	cs.mtx.Lock()
+	defer cs.mtx.Unlock()
+	if cs.locked {
+		return nil, storage.ErrLocked
+	}
+	cs.locked = true
+	return crashStorageLock{cs: cs}, nil
+}
+
+func (*crashStorage) Log(string) {}
+
+func (cs *crashStorage) SetMeta(fd storage.FileDesc) error {
+	cs.mtx.Lock()
+	defer cs.mtx.Unlock()
+	cs.meta = fd
+	return nil
+}
+
+func (cs *crashStorage) GetMeta() (storage.FileDesc, error) {
+	cs.mtx.Lock()
+	defer cs.mtx.Unlock()
+	if _, ok := cs.files[cs.meta]; !ok {
+		return storage.FileDesc{}, os.ErrNotExist
+	}
+	return cs.meta, nil
+}
+
+func (cs *crashStorage) List(ft storage.FileType) ([]storage.FileDesc, error) {
+	cs.mtx.Lock()
+	defer cs.mtx.Unlock()
+	var fds []storage.FileDesc
+	for fd := range cs.files {
+		if fd.Type&ft != 0 {
+			fds = append(fds, fd)
+		}
+	}
+	return fds, nil
+}
+
+func (cs *crashStorage) Open(fd storage.FileDesc) (storage.Reader, error) {
+	cs.mtx.Lock()
+	defer cs.mtx.Unlock()
+	f, ok := cs.files[fd]
+	if !ok {
+		return nil, os.ErrNotExist
+	}
+	return crashReader{bytes.NewReader(cp(f.data))}, nil
+}
+
+func (cs *crashStorage) Create(fd storage.FileDesc) (storage.Writer, error) {
+	cs.mtx.Lock()
+	defer cs.mtx.Unlock()
+	f := &crashFile{}
+	cs.files[fd] = f
+	return &crashWriter{cs: cs, f: f}, nil
+}
+
+func (cs *crashStorage) Remove(fd storage.FileDesc) error {
+	cs.mtx.Lock()
+	defer cs.mtx.Unlock()
+	if _, ok := cs.files[fd]; !ok {
+		return os.ErrNotExist
+	}
+	delete(cs.files, fd)
+	return nil
+}
+
+func (cs *crashStorage) Rename(oldfd, newfd storage.FileDesc) error {
+	cs.mtx.Lock()
+	defer cs.mtx.Unlock()
+	f, ok := cs.files[oldfd]
+	if !ok {
+		return os.ErrNotExist
+	}
+	delete(cs.files, oldfd)
+	cs.files[newfd] = f
+	return nil
+}
+
+func (*crashStorage) Close() error {
+	return nil
+}
+
+type crashReader struct {
+	*bytes.Reader
+}
+
+func (crashReader) Close() error {
+	return nil
+}
+
+type crashWriter struct {
+	cs *crashStorage
+	f  *crashFile
+}
+
+func (w *crashWriter) Write(p []byte) (int, error) {
+	w.cs.mtx.Lock()
+	defer w.cs.mtx.Unlock()
+	w.f.data = append(w.f.data, p...)
+	return len(p), nil
+}
+
+func (w *crashWriter) Sync() error {
+	w.cs.mtx.Lock()
+	defer w.cs.mtx.Unlock()
+	if !w.cs.ignoreSyncs {
+		w.f.synced = len(w.f.data)
+	}
+	return nil
+}
+
+func (*crashWriter) Close() error {
+	return nil
+}
+
+// crashEngine opens a database on simulated storage, and can crash it, i.e. close it while
+// dropping everything that was not synced.
+type crashEngine struct {
+	open  func() (DB, error)
+	crash func(db DB)
+}
+
+func crashEngines() map[string]func() crashEngine {
+	return map[string]func() crashEngine{
+		"pebbledb": func() crashEngine {
+			fs := vfs.NewStrictMem()
+			// pebble does not sync the parent of the directory it creates, so create it durably
+			// up front, or a crash would lose the whole database.
+			if err := fs.MkdirAll("crash"+DBFileSuffix, 0o755); err != nil {
+				panic(err)
+			}
+			root, err := fs.OpenDir("")
+			if err != nil {
+				panic(err)
+			}
+			if err := root.Sync(); err != nil {
+				panic(err)
+			}
+			_ = root.Close()
+			return crashEngine{
+				open: func() (DB, error) {
+					db, err := newPebbleDBWithOpts("crash", "", &pebble.Options{FS: fs, Logger: &fatalLogger{}})
+					if err != nil {
+						return nil, err
+					}
+					return db, nil
+				},
+				crash: func(db DB) {
+					fs.SetIgnoreSyncs(true)
+					_ = db.Close()
+					fs.ResetToSyncedState()
+					fs.SetIgnoreSyncs(false)
+				},
+			}
+		},
+		"goleveldb": func() crashEngine {
+			stor := newCrashStorage()
+			return crashEngine{
+				open: func() (DB, error) {
+					db, err := newGoLevelDBWithStorage(stor, nil)
+					if err != nil {
+						return nil, err
+					}
+					return db, nil
+				},
+				crash: func(db DB) {
+					stor.setIgnoreSyncs(true)
+					_ = db.Close()
+					stor.resetToSyncedState()
+					stor.setIgnoreSyncs(false)
+				},
+			}
+		},
+	}
+}
+
+// crashOp is one write of a crash test workload.
+type crashOp struct {
+	sync  bool
+	batch []operation
+}
+
+func randomCrashOps(rng *rand.Rand, n int) []crashOp {
+	ops := make([]crashOp, n)
+	for i := range ops {
+		size := 1
+		if rng.Intn(3) == 0 {
+			size = 1 + rng.Intn(10)
+		}
+		op := crashOp{sync: rng.Intn(4) == 0}
+		for j := 0; j < size; j++ {
+			key := []byte(fmt.Sprintf("key%03d", rng.Intn(50)))
+			if rng.Intn(4) == 0 {
+				op.batch = append(op.batch, operation{opTypeDelete, key, nil})
+			} else {
+				op.batch = append(op.batch, operation{opTypeSet, key, []byte(fmt.Sprintf("value%d", i))})
+			}
+		}
+		ops[i] = op
+	}
+	return ops
+}
+
+// applyCrashOp applies op to db, with single-operation writes going through Set or Delete and
+// larger ones through a batch.
+func applyCrashOp(t *testing.T, db DB, op crashOp) {
+	t.Helper()
+
+	if len(op.batch) == 1 {
+		o := op.batch[0]
+		switch {
+		case o.opType == opTypeSet && op.sync:
+			require.NoError(t, db.SetSync(o.key, o.value))
+		case o.opType == opTypeSet:
+			require.NoError(t, db.Set(o.key, o.value))
+		case op.sync:
+			require.NoError(t, db.DeleteSync(o.key))
+		default:
+			require.NoError(t, db.Delete(o.key))
+		}
+		return
+	}
+
+	batch := db.NewBatch()
+	defer batch.Close()
+	for _, o := range op.batch {
+		if o.opType == opTypeSet {
+			require.NoError(t, batch.Set(o.key, o.value))
+		} else {
+			require.NoError(t, batch.Delete(o.key))
+		}
+	}
+	if op.sync {
+		require.NoError(t, batch.WriteSync())
+	} else {
+		require.NoError(t, batch.Write())
+	}
+}
+
+// crashStates returns the expected database contents after each prefix of ops, as sorted
+// "key=value" lists.
+func crashStates(ops []crashOp) [][]string {
+	model := make(map[string]string)
+	states := make([][]string, 0, len(ops)+1)
+	snapshot := func() {
+		state := make([]string, 0, len(model))
+		for k, v := range model {
+			state = append(state, k+"="+v)
+		}
+		sort.Strings(state)
+		states = append(states, state)
+	}
+	snapshot()
+	for _, op := range ops {
+		for _, o := range op.batch {
+			if o.opType == opTypeSet {
+				model[string(o.key)] = string(o.value)
+			} else {
+				delete(model, string(o.key))
+			}
+		}
+		snapshot()
+	}
+	return states
+}
+
+func readCrashState(t *testing.T, db DB) []string {
+	t.Helper()
+
+	itr, err := db.Iterator(nil, nil)
+	require.NoError(t, err)
+	defer itr.Close()
+	state := []string{}
+	for ; itr.Valid(); itr.Next() {
+		state = append(state, string(itr.Key())+"="+string(itr.Value()))
+	}
+	require.NoError(t, itr.Error())
+	return state
+}
+
+// TestCrashConsistency runs random workloads against real engines on simulated storage, crashes
+// them and reopens them. Since a synced write also persists all writes before it, the recovered
+// contents must be the result of a prefix of the workload that includes the last synced write.
+// Unsynced writes after it may or may not survive, but never partially, nor out of order.
+func TestCrashConsistency(t *testing.T) {
+	for name, newEngine := range crashEngines() {
+		newEngine := newEngine
+		t.Run(name, func(t *testing.T) {
+			for seed := int64(1); seed <= 10; seed++ {
+				rng := rand.New(rand.NewSource(seed)) //nolint:gosec // deterministic workload is intended
+				ops := randomCrashOps(rng, 200)
+				states := crashStates(ops)
+
+				engine := newEngine()
+				db, err := engine.open()
+				require.NoError(t, err)
+				lastSync := 0
+				for i, op := range ops {
+					applyCrashOp(t, db, op)
+					if op.sync {
+						lastSync = i + 1
+					}
+				}
+				engine.crash(db)
+
+				db, err = engine.open()
+				require.NoError(t, err)
+				recovered := readCrashState(t, db)
+				require.NoError(t, db.Close())
+
+				found := false
+				for _, state := range states[lastSync:] {
+					if fmt.Sprint(state) == fmt.Sprint(recovered) {
+						found = true
+						break
+					}
+				}
+				require.True(t, found, "seed %d: recovered state does not match any state after op %d", seed, lastSync)
+			}
+		})
+	}
+}
+
+// TestCrashConsistencyUnsynced checks that the crash harness does lose unsynced writes, which is
+// what makes TestCrashConsistency meaningful.
+func TestCrashConsistencyUnsynced(t *testing.T) {
+	for name, newEngine := range crashEngines() {
+		newEngine := newEngine
+		t.Run(name, func(t *testing.T) {
+			engine := newEngine()
+			db, err := engine.open()
+			require.NoError(t, err)
+			require.NoError(t, db.SetSync([]byte("a"), []byte{1}))
+			require.NoError(t, db.Set([]byte("b"), []byte{2}))
+			engine.crash(db)
+
+			db, err = engine.open()
+			require.NoError(t, err)
+			defer db.Close()
+			require.Equal(t, []string{"a=\x01"}, readCrashState(t, db))
+		})
+	}
+}
+
+// TestCrashConsistencyForceSync checks that with ForceSync, PebbleDB persists writes made with
+// Set, Delete and Batch.Write as well.
+func TestCrashConsistencyForceSync(t *testing.T) {
+	engine := crashEngines()["pebbledb"]()
+	db, err := engine.open()
+	require.NoError(t, err)
+	db.(*PebbleDB).forceSync = true
+	require.NoError(t, db.Set([]byte("a"), []byte{1}))
+	require.NoError(t, db.Set([]byte("b"), []byte{2}))
+	require.NoError(t, db.Delete([]byte("a")))
+	batch := db.NewBatch()
+	require.NoError(t, batch.Set([]byte("c"), []byte{3}))
+	require.NoError(t, batch.Write())
+	require.NoError(t, batch.Close())
+	engine.crash(db)
+
+	db, err = engine.open()
+	require.NoError(t, err)
+	defer db.Close()
+	require.Equal(t, []string{"b=\x02", "c=\x03"}, readCrashState(t, db))
+}
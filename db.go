@@ -24,6 +24,12 @@ const (
 	//   - requires gcc
 	//   - use rocksdb build tag (go build -tags rocksdb)
 	RocksDBBackend BackendType = "rocksdb"
+	// GoLevelDBMemBackend represents goleveldb running on an in-memory storage. Data is lost when
+	// the database is closed, and the dir argument is ignored. Mostly used for testing.
+	GoLevelDBMemBackend BackendType = "goleveldb-mem"
+	// PebbleDBMemBackend represents pebble running on an in-memory filesystem. Data is lost when
+	// the database is closed, and the dir argument is ignored. Mostly used for testing.
+	PebbleDBMemBackend BackendType = "pebbledb-mem"
 )
 
 type (
@@ -0,0 +1,147 @@
+package db
+
+const (
+	// The number of keys sampled by estimateKeyCount to find the average on-disk size of a key.
+	estimateSampleSize = 1000
+
+	// The number of keys estimateKeyCount samples at most, when the first sample is not on disk.
+	estimateMaxSampleSize = 10000
+)
+
+// SizeEstimator is implemented by databases which can estimate the size of a range of keys from
+// their metadata, without scanning it.
+type SizeEstimator interface {
+	// EstimateSize returns the approximate size of the keys and values in [start, end), in bytes.
+	// For disk databases, this is the compressed size on disk, which does not include recent
+	// writes not yet flushed to disk. A nil start or end is unbounded.
+	// CONTRACT: start, end readonly []byte
+	EstimateSize(start, end []byte) (uint64, error)
+
+	// EstimateKeyCount returns the approximate number of keys in [start, end). A nil start or
+	// end is unbounded.
+	// CONTRACT: start, end readonly []byte
+	EstimateKeyCount(start, end []byte) (uint64, error)
+}
+
+// EstimateSize returns the approximate size of the keys and values of db in [start, end), in
+// bytes. If db does not implement SizeEstimator, it falls back to scanning the range and summing
+// the exact sizes of the keys and values.
+func EstimateSize(db DB, start, end []byte) (uint64, error) {
+	if estimator, ok := db.(SizeEstimator); ok {
+		return estimator.EstimateSize(start, end)
+	}
+	itr, err := IteratorUnsafe(db, start, end)
+	if err != nil {
+		return 0, err
+	}
+	defer itr.Close()
+
+	var size uint64
+	for ; itr.Valid(); itr.Next() {
+		size += uint64(len(itr.Key()) + len(itr.Value()))
+	}
+	return size, itr.Error()
+}
+
+// EstimateKeyCount returns the approximate number of keys of db in [start, end). If db does not
+// implement SizeEstimator, it falls back to scanning the range and counting the keys exactly.
+func EstimateKeyCount(db DB, start, end []byte) (uint64, error) {
+	if estimator, ok := db.(SizeEstimator); ok {
+		return estimator.EstimateKeyCount(start, end)
+	}
+	itr, err := IteratorWithOptions(db, start, end, IteratorOptions{KeyOnly: true, Unsafe: true})
+	if err != nil {
+		return 0, err
+	}
+	defer itr.Close()
+
+	var count uint64
+	for ; itr.Valid(); itr.Next() {
+		count++
+	}
+	return count, itr.Error()
+}
+
+// estimateKeyCount estimates the number of keys of db in [start, end), for disk databases which
+// can estimate the on-disk size of a range with sizeOf but do not keep key counts. It counts the
+// first keys of the range, and extrapolates from their share of the on-disk size of the range.
+// Ranges with up to estimateMaxSampleSize keys are counted exactly.
+//
+// If the sample is not flushed to disk yet, its on-disk size is 0, so the sample is enlarged to
+// estimateMaxSampleSize keys. If it still isn't on disk, the keys after the sample are estimated
+// from the on-disk size of the rest of the range, divided by the average uncompressed size of the
+// sampled keys and values. This undercounts compressed data, and doesn't count keys which are not
+// on disk. The range is never scanned beyond the sample.
+func estimateKeyCount(db DB, start, end []byte, sizeOf func(start, end []byte) (uint64, error)) (uint64, error) {
+	itr, err := IteratorWithOptions(db, start, end, IteratorOptions{Unsafe: true})
+	if err != nil {
+		return 0, err
+	}
+	defer itr.Close()
+
+	var count, entriesSize uint64
+	limit := uint64(estimateSampleSize)
+	for {
+		for ; itr.Valid() && count < limit; itr.Next() {
+			count++
+			entriesSize += uint64(len(itr.Key()) + len(itr.Value()))
+		}
+		if !itr.Valid() {
+			return count, itr.Error()
+		}
+
+		// The sample is [start, sampleEnd), with sampleEnd the first key after it.
+		sampleEnd := cp(itr.Key())
+		sampleSize, err := sizeOf(start, sampleEnd)
+		if err != nil {
+			return 0, err
+		}
+		if sampleSize > 0 {
+			size, err := sizeOf(start, end)
+			if err != nil {
+				return 0, err
+			}
+			estimate := count * size / sampleSize
+			if estimate <= count {
+				// There is at least the key after the sample.
+				estimate = count + 1
+			}
+			return estimate, nil
+		}
+		if limit < estimateMaxSampleSize {
+			limit = estimateMaxSampleSize
+			continue
+		}
+
+		// The sample isn't on disk yet, so only the average size of its entries says something
+		// about the rest of the range.
+		rest, err := sizeOf(sampleEnd, end)
+		if err != nil {
+			return 0, err
+		}
+		estimate := rest * count / entriesSize
+		if estimate == 0 {
+			// There is at least the key after the sample.
+			estimate = 1
+		}
+		return count + estimate, nil
+	}
+}
+
+// estimateEnd returns the end of [start, end) to pass to engines which can't estimate unbounded
+// ranges: end itself, or the first key after the last key of db in the range if end is nil. It
+// returns nil if end is nil and the range is empty.
+func estimateEnd(db DB, start, end []byte) ([]byte, error) {
+	if end != nil {
+		return end, nil
+	}
+	itr, err := IteratorWithOptions(db, start, nil, IteratorOptions{Reverse: true, KeyOnly: true, Unsafe: true})
+	if err != nil {
+		return nil, err
+	}
+	defer itr.Close()
+	if !itr.Valid() {
+		return nil, itr.Error()
+	}
+	return append(cp(itr.Key()), 0x00), nil
+}
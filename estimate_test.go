@@ -0,0 +1,125 @@
+package db
+
+import (
+	"bytes"
+	"crypto/rand"
+	"fmt"
+	"io"
+	"os"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestSizeEstimator(t *testing.T) {
+	for backend := range backends {
+		backend := backend
+		t.Run(string(backend), func(t *testing.T) {
+			db, dir := newTempDB(t, backend)
+			defer os.RemoveAll(dir)
+			defer db.Close()
+			_, ok := db.(SizeEstimator)
+			require.True(t, ok)
+			testSizeEstimator(t, db)
+		})
+	}
+}
+
+func TestSizeEstimatorFallback(t *testing.T) {
+	testSizeEstimator(t, NewTraceDB(NewMemDB(), io.Discard, TraceOptions{}))
+}
+
+func testSizeEstimator(t *testing.T, db DB) {
+	t.Helper()
+
+	const count = 3000
+	batch := db.NewBatch()
+	for i := 0; i < count; i++ {
+		value := make([]byte, 100)
+		_, err := rand.Read(value)
+		require.NoError(t, err)
+		require.NoError(t, batch.Set([]byte(fmt.Sprintf("a%05d", i)), value))
+	}
+	for i := 0; i < 10; i++ {
+		require.NoError(t, batch.Set([]byte(fmt.Sprintf("b%d", i)), []byte{1}))
+	}
+	require.NoError(t, batch.Write())
+
+	check := func() {
+		t.Helper()
+
+		// Ranges with few keys are counted exactly.
+		keys, err := EstimateKeyCount(db, []byte("b"), nil)
+		require.NoError(t, err)
+		require.EqualValues(t, 10, keys)
+		keys, err = EstimateKeyCount(db, []byte("c"), nil)
+		require.NoError(t, err)
+		require.Zero(t, keys)
+		size, err := EstimateSize(db, []byte("c"), nil)
+		require.NoError(t, err)
+		require.Zero(t, size)
+
+		keys, err = EstimateKeyCount(db, []byte("a"), []byte("b"))
+		require.NoError(t, err)
+		require.InDelta(t, count, keys, count/5)
+		keys, err = EstimateKeyCount(db, nil, nil)
+		require.NoError(t, err)
+		require.InDelta(t, count+10, keys, count/5)
+	}
+	check()
+
+	// Flush the data to disk, for the backends which only estimate from it.
+	switch d := db.(type) {
+	case *GoLevelDB:
+		require.NoError(t, d.ForceCompact(nil, nil))
+	case *PebbleDB:
+		require.NoError(t, d.DB().Flush())
+	}
+	check()
+
+	size, err := EstimateSize(db, []byte("a"), []byte("b"))
+	require.NoError(t, err)
+	require.InDelta(t, count*106, size, count*106/5)
+	total, err := EstimateSize(db, nil, nil)
+	require.NoError(t, err)
+	require.GreaterOrEqual(t, total, size)
+
+	_, err = EstimateSize(db, []byte{}, nil)
+	require.Equal(t, errKeyEmpty, err)
+	_, err = EstimateKeyCount(db, nil, []byte{})
+	require.Equal(t, errKeyEmpty, err)
+}
+
+func TestEstimateKeyCountUnflushed(t *testing.T) {
+	// 30000 entries of 10 bytes, of which only the keys after the sample are on disk, at 5 bytes
+	// per entry.
+	db := NewMemDB()
+	for i := 0; i < 30000; i++ {
+		require.NoError(t, db.Set([]byte(fmt.Sprintf("k%05d", i)), []byte("abcd")))
+	}
+	sampleEnd := []byte(fmt.Sprintf("k%05d", estimateMaxSampleSize))
+	sizeOf := func(start, end []byte) (uint64, error) {
+		if bytes.Equal(start, sampleEnd) && end == nil {
+			return 20000 * 5, nil
+		}
+		return 0, nil
+	}
+
+	// The sample is enlarged, but the range is not scanned any further. The keys after it are
+	// compressed to half their size on disk, so only half of them are estimated.
+	keys, err := estimateKeyCount(db, nil, nil, sizeOf)
+	require.NoError(t, err)
+	require.EqualValues(t, estimateMaxSampleSize+10000, keys)
+
+	// Without anything on disk, there is at least the key after the sample.
+	keys, err = estimateKeyCount(db, nil, nil, func(start, end []byte) (uint64, error) {
+		return 0, nil
+	})
+	require.NoError(t, err)
+	require.EqualValues(t, estimateMaxSampleSize+1, keys)
+
+	// Smaller ranges are still counted exactly.
+	keys, err = estimateKeyCount(db, []byte("k25000"), nil, sizeOf)
+	require.NoError(t, err)
+	require.EqualValues(t, 5000, keys)
+}
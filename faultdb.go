@@ -0,0 +1,436 @@
+package db
+
+import (
+	"bytes"
+	"errors"
+	"sync"
+	"time"
+)
+
+// FaultOp is a set of operations a Fault applies to.
+type FaultOp uint32
+
+const (
+	// FaultGet matches Get.
+	FaultGet FaultOp = 1 << iota
+	// FaultHas matches Has.
+	FaultHas
+	// FaultSet matches Set and SetSync.
+	FaultSet
+	// FaultDelete matches Delete and DeleteSync.
+	FaultDelete
+	// FaultBatchWrite matches Batch.Write and Batch.WriteSync.
+	FaultBatchWrite
+	// FaultIterator matches Iterator and ReverseIterator.
+	FaultIterator
+	// FaultIteratorNext matches Iterator.Next. A failing Next makes the iterator invalid, and the
+	// error is returned by Iterator.Error.
+	FaultIteratorNext
+
+	// FaultRead matches all read operations.
+	FaultRead = FaultGet | FaultHas | FaultIterator | FaultIteratorNext
+	// FaultWrite matches all write operations.
+	FaultWrite = FaultSet | FaultDelete | FaultBatchWrite
+)
+
+// Fault programs a FaultDB to fail or delay matching operations.
+type Fault struct {
+	// Ops is the set of operations the fault applies to.
+	Ops FaultOp
+
+	// KeyPrefix restricts the fault to operations on keys with this prefix. A batch write matches
+	// if any of its keys match, an iterator matches on its start bound, and Iterator.Next matches
+	// on the key it moves away from. An empty prefix matches everything.
+	KeyPrefix []byte
+
+	// Nth triggers the fault only on the nth matching operation, counting from 1. Zero triggers
+	// it on every matching operation.
+	Nth int
+
+	// Latency is added to triggered operations before they run.
+	Latency time.Duration
+
+	// Err is returned by triggered operations, which then have no effect. If nil, triggered
+	// operations only suffer Latency.
+	Err error
+}
+
+// ErrFaultCrashed is returned by operations on batches and iterators created before a call to
+// FaultDB.Crash.
+var ErrFaultCrashed = errors.New("database crashed")
+
+// undoEntry restores a key to its value before an unsynced write. A nil value deletes it.
+type undoEntry struct {
+	key   []byte
+	value []byte
+}
+
+// FaultDB wraps a database and injects programmable faults into its operations, to test how
+// applications handle storage errors, slow storage and crashes. Faults are added with AddFault.
+//
+// FaultDB also keeps track of writes that have not been synced, i.e. all writes since the last
+// SetSync, DeleteSync or Batch.WriteSync, and Crash reverts them to simulate losing them in a
+// power failure. All writes are serialized to do so, which makes FaultDB unsuitable for
+// benchmarks.
+type FaultDB struct {
+	db DB
+
+	mtx    sync.Mutex // guards all fields below, and serializes writes
+	faults []*faultState
+	undo   []undoEntry
+	epoch  uint64 // incremented by Crash, to invalidate older batches and iterators
+}
+
+var _ DB = (*FaultDB)(nil)
+
+// faultState is a Fault along with the number of operations it has matched so far.
+type faultState struct {
+	Fault
+	matched int
+}
+
+// NewFaultDB wraps db with fault injection. It injects no faults until AddFault is called.
+func NewFaultDB(db DB) *FaultDB {
+	return &FaultDB{db: db}
+}
+
+// AddFault programs a fault. Operations matching several faults trigger all of them, in the order
+// they were added.
+func (fdb *FaultDB) AddFault(fault Fault) {
+	fdb.mtx.Lock()
+	defer fdb.mtx.Unlock()
+	fdb.faults = append(fdb.faults, &faultState{Fault: fault})
+}
+
+// ClearFaults removes all programmed faults.
+func (fdb *FaultDB) ClearFaults() {
+	fdb.mtx.Lock()
+	defer fdb.mtx.Unlock()
+	fdb.faults = nil
+}
+
+// Crash simulates a crash followed by a restart, by reverting all writes made since the last
+// synced write. Batches and iterators created before the crash return ErrFaultCrashed, and
+// must still be closed. The database can be used normally afterwards.
+func (fdb *FaultDB) Crash() error {
+	fdb.mtx.Lock()
+	defer fdb.mtx.Unlock()
+
+	for i := len(fdb.undo) - 1; i >= 0; i-- {
+		entry := fdb.undo[i]
+		var err error
+		if entry.value == nil {
+			err = fdb.db.Delete(entry.key)
+		} else {
+			err = fdb.db.Set(entry.key, entry.value)
+		}
+		if err != nil {
+			return err
+		}
+	}
+	fdb.undo = nil
+	fdb.epoch++
+	return nil
+}
+
+// inject checks op against the programmed faults, sleeps for the latency of the triggered ones,
+// and returns the first triggered error. keys are the keys the operation applies to.
+func (fdb *FaultDB) inject(op FaultOp, keys ...[]byte) error {
+	fdb.mtx.Lock()
+	latency, err := fdb.triggerLocked(op, keys)
+	fdb.mtx.Unlock()
+
+	if latency > 0 {
+		time.Sleep(latency)
+	}
+	return err
+}
+
+// triggerLocked returns the total latency and first error of the faults triggered by op.
+func (fdb *FaultDB) triggerLocked(op FaultOp, keys [][]byte) (time.Duration, error) {
+	var (
+		latency time.Duration
+		err     error
+	)
+	for _, f := range fdb.faults {
+		if f.Ops&op == 0 || !f.matches(keys) {
+			continue
+		}
+		f.matched++
+		if f.Nth > 0 && f.matched != f.Nth {
+			continue
+		}
+		latency += f.Latency
+		if err == nil {
+			err = f.Err
+		}
+	}
+	return latency, err
+}
+
+func (f *faultState) matches(keys [][]byte) bool {
+	if len(f.KeyPrefix) == 0 {
+		return true
+	}
+	for _, key := range keys {
+		if bytes.HasPrefix(key, f.KeyPrefix) {
+			return true
+		}
+	}
+	return false
+}
+
+// write injects faults for op and applies ops to the database, tracking them for Crash unless
+// sync is set.
+func (fdb *FaultDB) write(op FaultOp, ops []operation, sync bool, apply func() error) error {
+	keys := make([][]byte, len(ops))
+	for i, o := range ops {
+		keys[i] = o.key
+	}
+	if err := fdb.inject(op, keys...); err != nil {
+		return err
+	}
+
+	fdb.mtx.Lock()
+	defer fdb.mtx.Unlock()
+
+	var undo []undoEntry
+	if !sync {
+		undo = make([]undoEntry, 0, len(ops))
+		for _, o := range ops {
+			value, err := fdb.db.Get(o.key)
+			if err != nil {
+				return err
+			}
+			undo = append(undo, undoEntry{key: o.key, value: value})
+		}
+	}
+	if err := apply(); err != nil {
+		return err
+	}
+	if sync {
+		// A synced write also persists all writes before it.
+		fdb.undo = nil
+	} else {
+		fdb.undo = append(fdb.undo, undo...)
+	}
+	return nil
+}
+
+// Get implements DB.
+func (fdb *FaultDB) Get(key []byte) ([]byte, error) {
+	if err := fdb.inject(FaultGet, key); err != nil {
+		return nil, err
+	}
+	return fdb.db.Get(key)
+}
+
+// Has implements DB.
+func (fdb *FaultDB) Has(key []byte) (bool, error) {
+	if err := fdb.inject(FaultHas, key); err != nil {
+		return false, err
+	}
+	return fdb.db.Has(key)
+}
+
+// Set implements DB.
+func (fdb *FaultDB) Set(key, value []byte) error {
+	if len(key) == 0 {
+		return errKeyEmpty
+	}
+	if value == nil {
+		return errValueNil
+	}
+	return fdb.write(FaultSet, []operation{{opTypeSet, key, value}}, false, func() error {
+		return fdb.db.Set(key, value)
+	})
+}
+
+// SetSync implements DB.
+func (fdb *FaultDB) SetSync(key, value []byte) error {
+	if len(key) == 0 {
+		return errKeyEmpty
+	}
+	if value == nil {
+		return errValueNil
+	}
+	return fdb.write(FaultSet, []operation{{opTypeSet, key, value}}, true, func() error {
+		return fdb.db.SetSync(key, value)
+	})
+}
+
+// Delete implements DB.
+func (fdb *FaultDB) Delete(key []byte) error {
+	if len(key) == 0 {
+		return errKeyEmpty
+	}
+	return fdb.write(FaultDelete, []operation{{opTypeDelete, key, nil}}, false, func() error {
+		return fdb.db.Delete(key)
+	})
+}
+
+// DeleteSync implements DB.
+func (fdb *FaultDB) DeleteSync(key []byte) error {
+	if len(key) == 0 {
+		return errKeyEmpty
+	}
+	return fdb.write(FaultDelete, []operation{{opTypeDelete, key, nil}}, true, func() error {
+		return fdb.db.DeleteSync(key)
+	})
+}
+
+// Iterator implements DB.
+func (fdb *FaultDB) Iterator(start, end []byte) (Iterator, error) {
+	return fdb.newIterator(start, end, fdb.db.Iterator)
+}
+
+// ReverseIterator implements DB.
+func (fdb *FaultDB) ReverseIterator(start, end []byte) (Iterator, error) {
+	return fdb.newIterator(start, end, fdb.db.ReverseIterator)
+}
+
+func (fdb *FaultDB) newIterator(start, end []byte, fn func(start, end []byte) (Iterator, error)) (Iterator, error) {
+	if err := fdb.inject(FaultIterator, start); err != nil {
+		return nil, err
+	}
+	itr, err := fn(start, end)
+	if err != nil {
+		return nil, err
+	}
+	return &faultDBIterator{Iterator: itr, fdb: fdb, epoch: fdb.currentEpoch()}, nil
+}
+
+func (fdb *FaultDB) currentEpoch() uint64 {
+	fdb.mtx.Lock()
+	defer fdb.mtx.Unlock()
+	return fdb.epoch
+}
+
+// Close implements DB.
+func (fdb *FaultDB) Close() error {
+	return fdb.db.Close()
+}
+
+// NewBatch implements DB.
+func (fdb *FaultDB) NewBatch() Batch {
+	return &faultDBBatch{Batch: fdb.db.NewBatch(), fdb: fdb, epoch: fdb.currentEpoch()}
+}
+
+// NewBatchWithSize implements DB.
+func (fdb *FaultDB) NewBatchWithSize(size int) Batch {
+	return &faultDBBatch{Batch: fdb.db.NewBatchWithSize(size), fdb: fdb, epoch: fdb.currentEpoch()}
+}
+
+// Print implements DB.
+func (fdb *FaultDB) Print() error {
+	return fdb.db.Print()
+}
+
+// Stats implements DB.
+func (fdb *FaultDB) Stats() map[string]string {
+	return fdb.db.Stats()
+}
+
+// faultDBBatch keeps track of the operations of a batch, so that FaultDB can match faults on their
+// keys and revert them on Crash.
+type faultDBBatch struct {
+	Batch
+	fdb   *FaultDB
+	ops   []operation
+	epoch uint64
+}
+
+var _ Batch = (*faultDBBatch)(nil)
+
+// Set implements Batch.
+func (b *faultDBBatch) Set(key, value []byte) error {
+	if err := b.Batch.Set(key, value); err != nil {
+		return err
+	}
+	b.ops = append(b.ops, operation{opTypeSet, key, value})
+	return nil
+}
+
+// Delete implements Batch.
+func (b *faultDBBatch) Delete(key []byte) error {
+	if err := b.Batch.Delete(key); err != nil {
+		return err
+	}
+	b.ops = append(b.ops, operation{opTypeDelete, key, nil})
+	return nil
+}
+
+// Write implements Batch.
+func (b *faultDBBatch) Write() error {
+	return b.write(false, b.Batch.Write)
+}
+
+// WriteSync implements Batch.
+func (b *faultDBBatch) WriteSync() error {
+	return b.write(true, b.Batch.WriteSync)
+}
+
+func (b *faultDBBatch) write(sync bool, apply func() error) error {
+	if b.epoch != b.fdb.currentEpoch() {
+		return ErrFaultCrashed
+	}
+	if err := b.fdb.write(FaultBatchWrite, b.ops, sync, apply); err != nil {
+		return err
+	}
+	b.ops = nil
+	return nil
+}
+
+// faultDBIterator injects faults into Next, and becomes invalid when one triggers.
+type faultDBIterator struct {
+	Iterator
+	fdb   *FaultDB
+	epoch uint64
+	err   error
+}
+
+var _ Iterator = (*faultDBIterator)(nil)
+
+// Valid implements Iterator.
+func (itr *faultDBIterator) Valid() bool {
+	if itr.err == nil && itr.epoch != itr.fdb.currentEpoch() {
+		itr.err = ErrFaultCrashed
+	}
+	return itr.err == nil && itr.Iterator.Valid()
+}
+
+// Next implements Iterator.
+func (itr *faultDBIterator) Next() {
+	itr.assertIsValid()
+	if err := itr.fdb.inject(FaultIteratorNext, itr.Iterator.Key()); err != nil {
+		itr.err = err
+		return
+	}
+	itr.Iterator.Next()
+}
+
+// Key implements Iterator.
+func (itr *faultDBIterator) Key() []byte {
+	itr.assertIsValid()
+	return itr.Iterator.Key()
+}
+
+// Value implements Iterator.
+func (itr *faultDBIterator) Value() []byte {
+	itr.assertIsValid()
+	return itr.Iterator.Value()
+}
+
+// Error implements Iterator.
+func (itr *faultDBIterator) Error() error {
+	if itr.err != nil {
+		return itr.err
+	}
+	return itr.Iterator.Error()
+}
+
+func (itr *faultDBIterator) assertIsValid() {
+	if !itr.Valid() {
+		panic("iterator is invalid")
+	}
+}
@@ -0,0 +1,110 @@
+package db
+
+import (
+	"errors"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+var errTestFault = errors.New("injected fault")
+
+func TestFaultDBFaults(t *testing.T) {
+	fdb := NewFaultDB(NewMemDB())
+
+	// Fail the second write to a key under "a/".
+	fdb.AddFault(Fault{Ops: FaultWrite, KeyPrefix: []byte("a/"), Nth: 2, Err: errTestFault})
+	require.NoError(t, fdb.Set([]byte("a/1"), []byte{1}))
+	require.NoError(t, fdb.Set([]byte("b/1"), []byte{1}))
+	require.Equal(t, errTestFault, fdb.Set([]byte("a/2"), []byte{2}))
+	require.NoError(t, fdb.Set([]byte("a/3"), []byte{3}))
+	checkValue(t, fdb, []byte("a/2"), nil)
+
+	// Fail every batch write containing a key under "c/".
+	fdb.ClearFaults()
+	fdb.AddFault(Fault{Ops: FaultBatchWrite, KeyPrefix: []byte("c/"), Err: errTestFault})
+	batch := fdb.NewBatch()
+	require.NoError(t, batch.Set([]byte("b/2"), []byte{2}))
+	require.NoError(t, batch.Delete([]byte("c/1")))
+	require.Equal(t, errTestFault, batch.Write())
+	require.NoError(t, batch.Close())
+	checkValue(t, fdb, []byte("b/2"), nil)
+
+	batch = fdb.NewBatch()
+	require.NoError(t, batch.Set([]byte("b/2"), []byte{2}))
+	require.NoError(t, batch.WriteSync())
+	require.NoError(t, batch.Close())
+	checkValue(t, fdb, []byte("b/2"), []byte{2})
+
+	// Reads can be delayed, and fail.
+	fdb.ClearFaults()
+	fdb.AddFault(Fault{Ops: FaultGet, Latency: 50 * time.Millisecond})
+	fdb.AddFault(Fault{Ops: FaultHas, Err: errTestFault})
+	start := time.Now()
+	checkValue(t, fdb, []byte("a/1"), []byte{1})
+	require.GreaterOrEqual(t, time.Since(start), 50*time.Millisecond)
+	_, err := fdb.Has([]byte("a/1"))
+	require.Equal(t, errTestFault, err)
+
+	// Iterators fail on creation, or on Next.
+	fdb.ClearFaults()
+	fdb.AddFault(Fault{Ops: FaultIterator, KeyPrefix: []byte("z"), Err: errTestFault})
+	fdb.AddFault(Fault{Ops: FaultIteratorNext, KeyPrefix: []byte("a/3"), Err: errTestFault})
+	_, err = fdb.Iterator([]byte("z"), nil)
+	require.Equal(t, errTestFault, err)
+
+	itr, err := fdb.Iterator(nil, nil)
+	require.NoError(t, err)
+	checkItem(t, itr, []byte("a/1"), []byte{1})
+	checkNext(t, itr, true)
+	checkItem(t, itr, []byte("a/3"), []byte{3})
+	checkNext(t, itr, false)
+	checkInvalid(t, itr)
+	require.Equal(t, errTestFault, itr.Error())
+	require.NoError(t, itr.Close())
+}
+
+func TestFaultDBCrash(t *testing.T) {
+	for dbType := range backends {
+		t.Run(string(dbType), func(t *testing.T) {
+			db, dir := newTempDB(t, dbType)
+			defer os.RemoveAll(dir)
+			defer db.Close()
+			fdb := NewFaultDB(db)
+
+			require.NoError(t, fdb.Set([]byte("a"), []byte{1}))
+			require.NoError(t, fdb.Set([]byte("b"), []byte{1}))
+			require.NoError(t, fdb.SetSync([]byte("c"), []byte{1}))
+
+			// Writes after the last sync are lost, including overwrites and deletes.
+			require.NoError(t, fdb.Set([]byte("a"), []byte{2}))
+			require.NoError(t, fdb.Delete([]byte("b")))
+			batch := fdb.NewBatch()
+			require.NoError(t, batch.Set([]byte("a"), []byte{3}))
+			require.NoError(t, batch.Set([]byte("d"), []byte{3}))
+			require.NoError(t, batch.Write())
+			require.NoError(t, batch.Close())
+
+			stale := fdb.NewBatch()
+			require.NoError(t, stale.Set([]byte("e"), []byte{4}))
+
+			require.NoError(t, fdb.Crash())
+			assertKeyValues(t, fdb, map[string][]byte{"a": {1}, "b": {1}, "c": {1}})
+			require.Equal(t, ErrFaultCrashed, stale.Write())
+			require.NoError(t, stale.Close())
+
+			// A synced batch persists earlier writes too.
+			require.NoError(t, fdb.Delete([]byte("a")))
+			batch = fdb.NewBatch()
+			require.NoError(t, batch.Set([]byte("d"), []byte{5}))
+			require.NoError(t, batch.WriteSync())
+			require.NoError(t, batch.Close())
+			require.NoError(t, fdb.Set([]byte("e"), []byte{5}))
+
+			require.NoError(t, fdb.Crash())
+			assertKeyValues(t, fdb, map[string][]byte{"b": {1}, "c": {1}, "d": {5}})
+		})
+	}
+}
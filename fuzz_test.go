@@ -0,0 +1,340 @@
+package db
+
+import (
+	"bytes"
+	"fmt"
+	"math/rand"
+	"sort"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+// fuzzKeyAlphabet is the set of bytes fuzzed keys are built from. It is kept small so that
+// operations collide often, and contains 0x00 and 0xFF to exercise cpIncr and bound handling.
+var fuzzKeyAlphabet = []byte{0x00, 0x01, 'a', 'b', 0xfe, 0xff}
+
+const (
+	fuzzOpSet byte = iota
+	fuzzOpDelete
+	fuzzOpBatch
+	fuzzOpIterator
+	fuzzOpReverseIterator
+	fuzzOpGet
+	fuzzOpCount
+)
+
+// fuzzReader decodes fuzzer input into operations. Once the input is exhausted it returns zeros,
+// which is fine since the caller stops as soon as done returns true.
+type fuzzReader struct {
+	data []byte
+}
+
+func (r *fuzzReader) done() bool {
+	return len(r.data) == 0
+}
+
+func (r *fuzzReader) byte() byte {
+	if len(r.data) == 0 {
+		return 0
+	}
+	b := r.data[0]
+	r.data = r.data[1:]
+	return b
+}
+
+func (r *fuzzReader) key() []byte {
+	key := make([]byte, 1+int(r.byte())%3)
+	for i := range key {
+		key[i] = fuzzKeyAlphabet[int(r.byte())%len(fuzzKeyAlphabet)]
+	}
+	return key
+}
+
+// bound returns a key, or nil in roughly one out of four cases.
+func (r *fuzzReader) bound() []byte {
+	if r.byte()%4 == 0 {
+		return nil
+	}
+	return r.key()
+}
+
+func (r *fuzzReader) value() []byte {
+	value := make([]byte, int(r.byte())%4)
+	for i := range value {
+		value[i] = r.byte()
+	}
+	return value
+}
+
+// fuzzOp is a single decoded operation, applied identically to every database under test.
+type fuzzOp struct {
+	kind       byte
+	key, value []byte
+	start, end []byte
+	batch      []fuzzOp
+}
+
+func (op fuzzOp) String() string {
+	switch op.kind {
+	case fuzzOpSet:
+		return fmt.Sprintf("Set(%x, %x)", op.key, op.value)
+	case fuzzOpDelete:
+		return fmt.Sprintf("Delete(%x)", op.key)
+	case fuzzOpBatch:
+		return fmt.Sprintf("Batch(%v)", op.batch)
+	case fuzzOpIterator:
+		return fmt.Sprintf("Iterator(%x, %x)", op.start, op.end)
+	case fuzzOpReverseIterator:
+		return fmt.Sprintf("ReverseIterator(%x, %x)", op.start, op.end)
+	default:
+		return fmt.Sprintf("Get(%x)", op.key)
+	}
+}
+
+func decodeFuzzOps(data []byte) []fuzzOp {
+	r := &fuzzReader{data: data}
+	var ops []fuzzOp
+	for !r.done() {
+		ops = append(ops, decodeFuzzOp(r, true))
+	}
+	return ops
+}
+
+func decodeFuzzOp(r *fuzzReader, allowBatch bool) fuzzOp {
+	op := fuzzOp{kind: r.byte() % fuzzOpCount}
+	switch op.kind {
+	case fuzzOpSet:
+		op.key, op.value = r.key(), r.value()
+	case fuzzOpDelete, fuzzOpGet:
+		op.key = r.key()
+	case fuzzOpBatch:
+		if !allowBatch {
+			op.kind = fuzzOpDelete
+			op.key = r.key()
+			break
+		}
+		n := int(r.byte()) % 8
+		for i := 0; i < n; i++ {
+			bop := decodeFuzzOp(r, false)
+			if bop.kind == fuzzOpSet || bop.kind == fuzzOpDelete {
+				op.batch = append(op.batch, bop)
+			}
+		}
+	case fuzzOpIterator, fuzzOpReverseIterator:
+		op.start, op.end = r.bound(), r.bound()
+	}
+	return op
+}
+
+// fuzzResult is the observable outcome of a fuzzOp.
+type fuzzResult struct {
+	Found bool
+	Value []byte
+	Pairs [][2][]byte
+}
+
+func applyFuzzOp(t *testing.T, db DB, op fuzzOp) fuzzResult {
+	t.Helper()
+
+	switch op.kind {
+	case fuzzOpSet:
+		require.NoError(t, db.Set(op.key, op.value))
+	case fuzzOpDelete:
+		require.NoError(t, db.Delete(op.key))
+	case fuzzOpBatch:
+		batch := db.NewBatch()
+		for _, bop := range op.batch {
+			if bop.kind == fuzzOpSet {
+				require.NoError(t, batch.Set(bop.key, bop.value))
+			} else {
+				require.NoError(t, batch.Delete(bop.key))
+			}
+		}
+		require.NoError(t, batch.Write())
+		require.NoError(t, batch.Close())
+	case fuzzOpGet:
+		value, err := db.Get(op.key)
+		require.NoError(t, err)
+		return fuzzResult{Found: value != nil, Value: cp(value)}
+	case fuzzOpIterator, fuzzOpReverseIterator:
+		var (
+			itr Iterator
+			err error
+		)
+		if op.kind == fuzzOpIterator {
+			itr, err = db.Iterator(op.start, op.end)
+		} else {
+			itr, err = db.ReverseIterator(op.start, op.end)
+		}
+		require.NoError(t, err)
+		return fuzzResult{Pairs: collectFuzzPairs(t, itr)}
+	}
+	return fuzzResult{}
+}
+
+func collectFuzzPairs(t *testing.T, itr Iterator) [][2][]byte {
+	t.Helper()
+
+	var pairs [][2][]byte
+	for ; itr.Valid(); itr.Next() {
+		pairs = append(pairs, [2][]byte{cp(itr.Key()), cp(itr.Value())})
+	}
+	require.NoError(t, itr.Error())
+	require.NoError(t, itr.Close())
+	return pairs
+}
+
+// fuzzSeeds returns a few deterministic pseudo-random inputs, so that the targets exercise
+// non-trivial sequences even when run as plain tests without -fuzz.
+func fuzzSeeds() [][]byte {
+	rng := rand.New(rand.NewSource(42)) //nolint:gosec // deterministic seeds are intended
+	seeds := [][]byte{
+		{},
+		{fuzzOpSet, 0, 2, 1, 7, fuzzOpReverseIterator, 1, 0, 1, 0, 0},
+		{fuzzOpSet, 1, 5, 5, 0, fuzzOpIterator, 0, 0, fuzzOpReverseIterator, 1, 1, 5, 5, 0},
+	}
+	for i := 0; i < 16; i++ {
+		seed := make([]byte, 64+rng.Intn(192))
+		rng.Read(seed)
+		seeds = append(seeds, seed)
+	}
+	return seeds
+}
+
+// FuzzBackends applies random sequences of writes, batches and iterations to every registered
+// backend and to a MemDB reference, and requires all of them to observe identical results.
+func FuzzBackends(f *testing.F) {
+	for _, seed := range fuzzSeeds() {
+		f.Add(seed)
+	}
+
+	f.Fuzz(func(t *testing.T, data []byte) {
+		ops := decodeFuzzOps(data)
+		model := NewMemDB()
+
+		dbs := make(map[BackendType]DB)
+		for backend := range backends {
+			if backend == MemDBBackend {
+				continue
+			}
+			db, err := NewDB("fuzz", backend, t.TempDir())
+			require.NoError(t, err)
+			defer db.Close()
+			dbs[backend] = db
+		}
+
+		for i, op := range ops {
+			expected := applyFuzzOp(t, model, op)
+			for backend, db := range dbs {
+				actual := applyFuzzOp(t, db, op)
+				require.Equal(t, expected, actual, "backend %s, op %d: %v", backend, i, op)
+			}
+		}
+	})
+}
+
+// FuzzPrefixDB writes random keys both through a PrefixDB, including in batches, and directly to
+// its parent, including keys equal to the prefix itself, and checks that PrefixDB reads and
+// iteration match the parent's contents filtered by prefix.
+func FuzzPrefixDB(f *testing.F) {
+	for _, seed := range fuzzSeeds() {
+		f.Add(seed)
+	}
+
+	f.Fuzz(func(t *testing.T, data []byte) {
+		r := &fuzzReader{data: data}
+		prefix := r.key()
+		ops := decodeFuzzOps(r.data)
+
+		for backend := range backends {
+			if backend == "prefixdb" {
+				continue
+			}
+			parent, err := NewDB("fuzz", backend, t.TempDir())
+			require.NoError(t, err)
+			defer parent.Close()
+			pdb := NewPrefixDB(parent, prefix)
+			model := make(map[string][]byte)
+
+			for i, op := range ops {
+				switch op.kind {
+				case fuzzOpSet:
+					// Odd-length keys go to the parent unprefixed, which also produces keys that
+					// are exactly equal to the prefix.
+					if len(op.key)%2 == 1 {
+						require.NoError(t, parent.Set(op.key, op.value))
+						model[string(op.key)] = op.value
+					} else {
+						require.NoError(t, pdb.Set(op.key, op.value))
+						model[string(prefix)+string(op.key)] = op.value
+					}
+				case fuzzOpDelete:
+					require.NoError(t, pdb.Delete(op.key))
+					delete(model, string(prefix)+string(op.key))
+				case fuzzOpBatch:
+					batch := pdb.NewBatch()
+					for _, bop := range op.batch {
+						if bop.kind == fuzzOpSet {
+							require.NoError(t, batch.Set(bop.key, bop.value))
+						} else {
+							require.NoError(t, batch.Delete(bop.key))
+						}
+					}
+					require.NoError(t, batch.Write())
+					require.NoError(t, batch.Close())
+					for _, bop := range op.batch {
+						if bop.kind == fuzzOpSet {
+							model[string(prefix)+string(bop.key)] = bop.value
+						} else {
+							delete(model, string(prefix)+string(bop.key))
+						}
+					}
+				case fuzzOpGet:
+					value, err := pdb.Get(op.key)
+					require.NoError(t, err)
+					expected, ok := model[string(prefix)+string(op.key)]
+					require.Equal(t, fuzzResult{Found: ok, Value: cp(expected)},
+						fuzzResult{Found: value != nil, Value: cp(value)},
+						"backend %s, prefix %x, op %d: %v", backend, prefix, i, op)
+				case fuzzOpIterator, fuzzOpReverseIterator:
+					var itr Iterator
+					if op.kind == fuzzOpIterator {
+						itr, err = pdb.Iterator(op.start, op.end)
+					} else {
+						itr, err = pdb.ReverseIterator(op.start, op.end)
+					}
+					require.NoError(t, err)
+					expected := expectedPrefixPairs(model, prefix, op.start, op.end, op.kind == fuzzOpReverseIterator)
+					require.Equal(t, expected, collectFuzzPairs(t, itr), "backend %s, prefix %x, op %d: %v",
+						backend, prefix, i, op)
+				}
+			}
+		}
+	})
+}
+
+func expectedPrefixPairs(model map[string][]byte, prefix, start, end []byte, reverse bool) [][2][]byte {
+	var keys [][]byte
+	for k := range model {
+		key := []byte(k)
+		if len(key) <= len(prefix) || !bytes.HasPrefix(key, prefix) {
+			continue
+		}
+		if IsKeyInDomain(key[len(prefix):], start, end) {
+			keys = append(keys, key)
+		}
+	}
+	sort.Slice(keys, func(i, j int) bool {
+		if reverse {
+			return bytes.Compare(keys[i], keys[j]) > 0
+		}
+		return bytes.Compare(keys[i], keys[j]) < 0
+	})
+
+	var pairs [][2][]byte
+	for _, key := range keys {
+		pairs = append(pairs, [2][]byte{key[len(prefix):], cp(model[string(key)])})
+	}
+	return pairs
+}
@@ -3,6 +3,7 @@ package db
 import (
 	"errors"
 	"fmt"
+	"io"
 	"path/filepath"
 
 	"github.com/spf13/cast"
@@ -10,6 +11,7 @@ import (
 	leveldberrors "github.com/syndtr/goleveldb/leveldb/errors"
 	"github.com/syndtr/goleveldb/leveldb/filter"
 	"github.com/syndtr/goleveldb/leveldb/opt"
+	"github.com/syndtr/goleveldb/leveldb/storage"
 	"github.com/syndtr/goleveldb/leveldb/util"
 )
 
@@ -18,15 +20,50 @@ func init() {
 		return NewGoLevelDB(name, dir, opts)
 	}
 	registerDBCreator(GoLevelDBBackend, dbCreator, false)
+
+	memDBCreator := func(name, dir string, opts Options) (DB, error) {
+		db, err := newGoLevelDBWithStorage(storage.NewMemStorage(), goLevelDBOptions(opts))
+		if err != nil {
+			return nil, err
+		}
+		db.mergeOp = mergeOperatorFromOptions(opts)
+		return db, nil
+	}
+	registerDBCreator(GoLevelDBMemBackend, memDBCreator, false)
 }
 
 type GoLevelDB struct {
 	db *leveldb.DB
+
+	// goleveldb has no merge operator nor conditional writes, so these are emulated with a
+	// read-modify-write under the write locks of their keys, while other writes take the read
+	// locks of their keys.
+	mergeOp MergeOperator
+	locks   keyLocks
 }
 
-var _ DB = (*GoLevelDB)(nil)
+var (
+	_ DB                  = (*GoLevelDB)(nil)
+	_ Merger              = (*GoLevelDB)(nil)
+	_ ConditionalWriter   = (*GoLevelDB)(nil)
+	_ MultiGetter         = (*GoLevelDB)(nil)
+	_ UnsafeReader        = (*GoLevelDB)(nil)
+	_ IterableWithOptions = (*GoLevelDB)(nil)
+	_ SizeEstimator       = (*GoLevelDB)(nil)
+	_ RangeSplitter       = (*GoLevelDB)(nil)
+)
 
 func NewGoLevelDB(name, dir string, opts Options) (*GoLevelDB, error) {
+	db, err := NewGoLevelDBWithOpts(name, dir, goLevelDBOptions(opts))
+	if err != nil {
+		return nil, err
+	}
+	db.mergeOp = mergeOperatorFromOptions(opts)
+	return db, nil
+}
+
+// goLevelDBOptions returns the default goleveldb options, adjusted by opts.
+func goLevelDBOptions(opts Options) *opt.Options {
 	defaultOpts := &opt.Options{
 		Filter: filter.NewBloomFilter(10), // by default, goleveldb doesn't use a bloom filter.
 	}
@@ -36,8 +73,7 @@ func NewGoLevelDB(name, dir string, opts Options) (*GoLevelDB, error) {
 			defaultOpts.OpenFilesCacheCapacity = files
 		}
 	}
-
-	return NewGoLevelDBWithOpts(name, dir, defaultOpts)
+	return defaultOpts
 }
 
 func NewGoLevelDBWithOpts(name, dir string, o *opt.Options) (*GoLevelDB, error) {
@@ -52,6 +88,18 @@ func NewGoLevelDBWithOpts(name, dir string, o *opt.Options) (*GoLevelDB, error)
 	return database, nil
 }
 
+// newGoLevelDBWithStorage opens a GoLevelDB on the given storage, e.g. an in-memory one.
+func newGoLevelDBWithStorage(stor storage.Storage, o *opt.Options) (*GoLevelDB, error) {
+	db, err := leveldb.Open(stor, o)
+	if err != nil {
+		return nil, err
+	}
+	database := &GoLevelDB{
+		db: db,
+	}
+	return database, nil
+}
+
 // Get implements DB.
 func (db *GoLevelDB) Get(key []byte) ([]byte, error) {
 	if len(key) == 0 {
@@ -67,6 +115,41 @@ func (db *GoLevelDB) Get(key []byte) ([]byte, error) {
 	return res, nil
 }
 
+// GetUnsafe implements UnsafeReader. goleveldb always returns a copy of the value, so this is
+// the same as Get.
+func (db *GoLevelDB) GetUnsafe(key []byte) ([]byte, io.Closer, error) {
+	value, err := db.Get(key)
+	if err != nil {
+		return nil, nil, err
+	}
+	return value, nopCloser{}, nil
+}
+
+// MultiGet implements MultiGetter, reading all keys from a single snapshot.
+func (db *GoLevelDB) MultiGet(keys [][]byte) ([][]byte, error) {
+	if err := checkKeys(keys); err != nil {
+		return nil, err
+	}
+	snapshot, err := db.db.GetSnapshot()
+	if err != nil {
+		return nil, err
+	}
+	defer snapshot.Release()
+
+	values := make([][]byte, len(keys))
+	for i, key := range keys {
+		value, err := snapshot.Get(key, nil)
+		if err != nil {
+			if errors.Is(err, leveldberrors.ErrNotFound) {
+				continue
+			}
+			return nil, err
+		}
+		values[i] = value
+	}
+	return values, nil
+}
+
 // Has implements DB.
 func (db *GoLevelDB) Has(key []byte) (bool, error) {
 	bytes, err := db.Get(key)
@@ -84,6 +167,8 @@ func (db *GoLevelDB) Set(key, value []byte) error {
 	if value == nil {
 		return errValueNil
 	}
+	unlock := db.locks.rlock(key)
+	defer unlock()
 	if err := db.db.Put(key, value, nil); err != nil {
 		return err
 	}
@@ -98,6 +183,8 @@ func (db *GoLevelDB) SetSync(key, value []byte) error {
 	if value == nil {
 		return errValueNil
 	}
+	unlock := db.locks.rlock(key)
+	defer unlock()
 	if err := db.db.Put(key, value, &opt.WriteOptions{Sync: true}); err != nil {
 		return err
 	}
@@ -109,6 +196,8 @@ func (db *GoLevelDB) Delete(key []byte) error {
 	if len(key) == 0 {
 		return errKeyEmpty
 	}
+	unlock := db.locks.rlock(key)
+	defer unlock()
 	if err := db.db.Delete(key, nil); err != nil {
 		return err
 	}
@@ -120,6 +209,8 @@ func (db *GoLevelDB) DeleteSync(key []byte) error {
 	if len(key) == 0 {
 		return errKeyEmpty
 	}
+	unlock := db.locks.rlock(key)
+	defer unlock()
 	err := db.db.Delete(key, &opt.WriteOptions{Sync: true})
 	if err != nil {
 		return err
@@ -127,6 +218,85 @@ func (db *GoLevelDB) DeleteSync(key []byte) error {
 	return nil
 }
 
+// Merge implements Merger.
+func (db *GoLevelDB) Merge(key, operand []byte) error {
+	if len(key) == 0 {
+		return errKeyEmpty
+	}
+	if operand == nil {
+		return errValueNil
+	}
+	if db.mergeOp == nil {
+		return errMergeOperatorMissing
+	}
+	unlock := db.locks.lock(key)
+	defer unlock()
+
+	existing, err := db.Get(key)
+	if err != nil {
+		return err
+	}
+	value, err := db.mergeOp.Merge(key, existing, operand)
+	if err != nil {
+		return err
+	}
+	if value == nil {
+		value = []byte{}
+	}
+	return db.db.Put(key, value, nil)
+}
+
+// CompareAndSwap implements ConditionalWriter.
+func (db *GoLevelDB) CompareAndSwap(key, oldValue, newValue []byte) (bool, error) {
+	unlock := db.locks.lock(key)
+	defer unlock()
+
+	return compareAndSwap(key, oldValue, newValue, db.Get,
+		func(key, value []byte) error { return db.db.Put(key, value, nil) },
+		func(key []byte) error { return db.db.Delete(key, nil) },
+	)
+}
+
+// SetIfAbsent implements ConditionalWriter.
+func (db *GoLevelDB) SetIfAbsent(key, value []byte) (bool, error) {
+	if value == nil {
+		return false, errValueNil
+	}
+	return db.CompareAndSwap(key, nil, value)
+}
+
+// EstimateSize implements SizeEstimator, using the on-disk sizes of the tables.
+func (db *GoLevelDB) EstimateSize(start, end []byte) (uint64, error) {
+	if (start != nil && len(start) == 0) || (end != nil && len(end) == 0) {
+		return 0, errKeyEmpty
+	}
+	end, err := estimateEnd(db, start, end)
+	if err != nil || end == nil {
+		return 0, err
+	}
+	sizes, err := db.db.SizeOf([]util.Range{{Start: start, Limit: end}})
+	if err != nil {
+		return 0, err
+	}
+	return uint64(sizes.Sum()), nil
+}
+
+// EstimateKeyCount implements SizeEstimator, extrapolating from a sample of keys.
+func (db *GoLevelDB) EstimateKeyCount(start, end []byte) (uint64, error) {
+	if (start != nil && len(start) == 0) || (end != nil && len(end) == 0) {
+		return 0, errKeyEmpty
+	}
+	return estimateKeyCount(db, start, end, db.EstimateSize)
+}
+
+// SplitRange implements RangeSplitter, from the estimated sizes of ranges.
+func (db *GoLevelDB) SplitRange(start, end []byte, n int) ([]KeyRange, error) {
+	if err := checkSplitRange(start, end, n); err != nil {
+		return nil, err
+	}
+	return splitRangeBySize(db, start, end, n)
+}
+
 func (db *GoLevelDB) DB() *leveldb.DB {
 	return db.db
 }
@@ -195,18 +365,38 @@ func (db *GoLevelDB) NewBatchWithSize(size int) Batch {
 
 // Iterator implements DB.
 func (db *GoLevelDB) Iterator(start, end []byte) (Iterator, error) {
-	if (start != nil && len(start) == 0) || (end != nil && len(end) == 0) {
-		return nil, errKeyEmpty
-	}
-	itr := db.db.NewIterator(&util.Range{Start: start, Limit: end}, nil)
-	return newGoLevelDBIterator(itr, start, end, false), nil
+	return db.IteratorWithOptions(start, end, IteratorOptions{})
 }
 
 // ReverseIterator implements DB.
 func (db *GoLevelDB) ReverseIterator(start, end []byte) (Iterator, error) {
+	return db.IteratorWithOptions(start, end, IteratorOptions{Reverse: true})
+}
+
+// IteratorUnsafe implements UnsafeReader.
+func (db *GoLevelDB) IteratorUnsafe(start, end []byte) (Iterator, error) {
+	return db.IteratorWithOptions(start, end, IteratorOptions{Unsafe: true})
+}
+
+// ReverseIteratorUnsafe implements UnsafeReader.
+func (db *GoLevelDB) ReverseIteratorUnsafe(start, end []byte) (Iterator, error) {
+	return db.IteratorWithOptions(start, end, IteratorOptions{Reverse: true, Unsafe: true})
+}
+
+// IteratorWithOptions implements IterableWithOptions. goleveldb has no readahead option, so
+// ReadaheadSize is ignored.
+func (db *GoLevelDB) IteratorWithOptions(start, end []byte, opts IteratorOptions) (Iterator, error) {
 	if (start != nil && len(start) == 0) || (end != nil && len(end) == 0) {
 		return nil, errKeyEmpty
 	}
-	itr := db.db.NewIterator(&util.Range{Start: start, Limit: end}, nil)
-	return newGoLevelDBIterator(itr, start, end, true), nil
+	end = opts.iteratorEnd(start, end)
+	var ro *opt.ReadOptions
+	if opts.DontFillCache {
+		ro = &opt.ReadOptions{DontFillCache: true}
+	}
+	itr := db.db.NewIterator(&util.Range{Start: start, Limit: end}, ro)
+	gitr := newGoLevelDBIterator(itr, start, end, opts.Reverse)
+	gitr.noCopy = opts.Unsafe
+	gitr.keyOnly = opts.KeyOnly
+	return gitr, nil
 }
@@ -8,9 +8,29 @@ import (
 type goLevelDBBatch struct {
 	db    *GoLevelDB
 	batch *leveldb.Batch
+
+	// merges are resolved when the batch is written, and are kept aside along with their
+	// position in the batch.
+	merges    []goLevelDBMerge
+	mergeSize int
+
+	// spare keeps the underlying batch of a written batch, for reuse after Reset.
+	spare *leveldb.Batch
+}
+
+// goLevelDBMerge is a merge in a goLevelDBBatch, which comes before the index'th operation of the
+// underlying batch.
+type goLevelDBMerge struct {
+	index   int
+	key     []byte
+	operand []byte
 }
 
-var _ Batch = (*goLevelDBBatch)(nil)
+var (
+	_ Batch         = (*goLevelDBBatch)(nil)
+	_ Merger        = (*goLevelDBBatch)(nil)
+	_ ReusableBatch = (*goLevelDBBatch)(nil)
+)
 
 func newGoLevelDBBatch(db *GoLevelDB) *goLevelDBBatch {
 	return &goLevelDBBatch{
@@ -53,6 +73,25 @@ func (b *goLevelDBBatch) Delete(key []byte) error {
 	return nil
 }
 
+// Merge implements Merger.
+func (b *goLevelDBBatch) Merge(key, operand []byte) error {
+	if len(key) == 0 {
+		return errKeyEmpty
+	}
+	if operand == nil {
+		return errValueNil
+	}
+	if b.batch == nil {
+		return errBatchClosed
+	}
+	if b.db.mergeOp == nil {
+		return errMergeOperatorMissing
+	}
+	b.merges = append(b.merges, goLevelDBMerge{index: b.batch.Len(), key: key, operand: operand})
+	b.mergeSize += len(key) + len(operand)
+	return nil
+}
+
 // Write implements Batch.
 func (b *goLevelDBBatch) Write() error {
 	return b.write(false)
@@ -67,12 +106,130 @@ func (b *goLevelDBBatch) write(sync bool) error {
 	if b.batch == nil {
 		return errBatchClosed
 	}
-	err := b.db.db.Write(b.batch, &opt.WriteOptions{Sync: sync})
+	unlock, err := b.lock()
 	if err != nil {
 		return err
 	}
-	// Make sure batch cannot be used afterwards. Callers should still call Close(), for errors.
-	return b.Close()
+	defer unlock()
+
+	batch := b.batch
+	if len(b.merges) > 0 {
+		batch, err = b.resolveMerges()
+		if err != nil {
+			return err
+		}
+	}
+	err = b.db.db.Write(batch, &opt.WriteOptions{Sync: sync})
+	if err != nil {
+		return err
+	}
+	// Make sure batch cannot be used afterwards, but keep the underlying batch for Reset. Callers
+	// should still call Close(), for errors.
+	spare := b.batch
+	if err := b.Close(); err != nil {
+		return err
+	}
+	b.spare = spare
+	return nil
+}
+
+// lock locks the keys of the batch, for writing if they are merged, and returns a function
+// unlocking them. Merges are read-modify-writes, which enable striping.
+func (b *goLevelDBBatch) lock() (unlock func(), err error) {
+	if len(b.merges) > 0 {
+		b.db.locks.enable()
+	}
+	return b.db.locks.lockCollected(func(stripes *keyStripes) error {
+		replay := &goLevelDBBatchStripes{stripes: stripes}
+		if err := b.batch.Replay(replay); err != nil {
+			return err
+		}
+		for _, merge := range b.merges {
+			stripes.write(merge.key)
+		}
+		return nil
+	})
+}
+
+// goLevelDBBatchStripes collects the stripes of the keys of a leveldb.Batch.
+type goLevelDBBatchStripes struct {
+	stripes *keyStripes
+}
+
+var _ leveldb.BatchReplay = (*goLevelDBBatchStripes)(nil)
+
+// Put implements leveldb.BatchReplay.
+func (r *goLevelDBBatchStripes) Put(key, _ []byte) {
+	r.stripes.read(key)
+}
+
+// Delete implements leveldb.BatchReplay.
+func (r *goLevelDBBatchStripes) Delete(key []byte) {
+	r.stripes.read(key)
+}
+
+// resolveMerges returns a new batch with the merges resolved into sets. The caller must hold the
+// write locks of the merged keys.
+func (b *goLevelDBBatch) resolveMerges() (*leveldb.Batch, error) {
+	ops, err := b.operations()
+	if err != nil {
+		return nil, err
+	}
+	ops, err = resolveMerges(b.db.mergeOp, ops, b.db.Get)
+	if err != nil {
+		return nil, err
+	}
+	batch := leveldb.MakeBatch(len(b.batch.Dump()) + b.mergeSize)
+	for _, op := range ops {
+		if op.opType == opTypeSet {
+			batch.Put(op.key, op.value)
+		} else {
+			batch.Delete(op.key)
+		}
+	}
+	return batch, nil
+}
+
+// operations returns the operations of the batch, with the merges in their place.
+func (b *goLevelDBBatch) operations() ([]operation, error) {
+	ops := make([]operation, 0, b.batch.Len()+len(b.merges))
+	replay := &goLevelDBBatchReplay{merges: b.merges, ops: ops}
+	if err := b.batch.Replay(replay); err != nil {
+		return nil, err
+	}
+	replay.addMerges(b.batch.Len())
+	return replay.ops, nil
+}
+
+// goLevelDBBatchReplay collects the operations of a leveldb.Batch, interleaved with merges.
+type goLevelDBBatchReplay struct {
+	merges []goLevelDBMerge
+	ops    []operation
+	index  int
+}
+
+var _ leveldb.BatchReplay = (*goLevelDBBatchReplay)(nil)
+
+// addMerges adds the merges which come before the index'th operation.
+func (r *goLevelDBBatchReplay) addMerges(index int) {
+	for len(r.merges) > 0 && r.merges[0].index <= index {
+		r.ops = append(r.ops, operation{opTypeMerge, r.merges[0].key, r.merges[0].operand})
+		r.merges = r.merges[1:]
+	}
+}
+
+// Put implements leveldb.BatchReplay.
+func (r *goLevelDBBatchReplay) Put(key, value []byte) {
+	r.addMerges(r.index)
+	r.ops = append(r.ops, operation{opTypeSet, key, value})
+	r.index++
+}
+
+// Delete implements leveldb.BatchReplay.
+func (r *goLevelDBBatchReplay) Delete(key []byte) {
+	r.addMerges(r.index)
+	r.ops = append(r.ops, operation{opTypeDelete, key, nil})
+	r.index++
 }
 
 // Close implements Batch.
@@ -81,6 +238,33 @@ func (b *goLevelDBBatch) Close() error {
 		b.batch.Reset()
 		b.batch = nil
 	}
+	b.merges = nil
+	b.mergeSize = 0
+	b.spare = nil
+	return nil
+}
+
+// Count implements ReusableBatch.
+func (b *goLevelDBBatch) Count() (int, error) {
+	if b.batch == nil {
+		return 0, errBatchClosed
+	}
+	return b.batch.Len() + len(b.merges), nil
+}
+
+// Reset implements ReusableBatch.
+func (b *goLevelDBBatch) Reset() error {
+	switch {
+	case b.batch != nil:
+		b.batch.Reset()
+	case b.spare != nil:
+		b.batch = b.spare
+	default:
+		b.batch = new(leveldb.Batch)
+	}
+	b.spare = nil
+	b.merges = b.merges[:0]
+	b.mergeSize = 0
 	return nil
 }
 
@@ -89,5 +273,52 @@ func (b *goLevelDBBatch) GetByteSize() (int, error) {
 	if b.batch == nil {
 		return 0, errBatchClosed
 	}
-	return len(b.batch.Dump()), nil
+	return len(b.batch.Dump()) + b.mergeSize, nil
+}
+
+// Data implements SerializableBatch.
+func (b *goLevelDBBatch) Data() ([]byte, error) {
+	if b.batch == nil {
+		return nil, errBatchClosed
+	}
+	ops, err := b.operations()
+	if err != nil {
+		return nil, err
+	}
+	return encodeBatchOps(ops), nil
+}
+
+// SetData implements SerializableBatch.
+func (b *goLevelDBBatch) SetData(data []byte) error {
+	if b.batch == nil {
+		return errBatchClosed
+	}
+	// Merges keep their keys and operands, which would otherwise point into the caller's data.
+	data = cp(data)
+	batch := &goLevelDBBatch{db: b.db, batch: new(leveldb.Batch)}
+	err := ReplayBatchData(data, func(op BatchOp) error {
+		return applyBatchOp(batch, op)
+	})
+	if err != nil {
+		return err
+	}
+	b.batch, b.merges, b.mergeSize = batch.batch, batch.merges, batch.mergeSize
+	return nil
+}
+
+// Replay implements SerializableBatch.
+func (b *goLevelDBBatch) Replay(fn func(op BatchOp) error) error {
+	if b.batch == nil {
+		return errBatchClosed
+	}
+	ops, err := b.operations()
+	if err != nil {
+		return err
+	}
+	for _, op := range ops {
+		if err := fn(op.batchOp()); err != nil {
+			return err
+		}
+	}
+	return nil
 }
@@ -12,9 +12,11 @@ type goLevelDBIterator struct {
 	end       []byte
 	isReverse bool
 	isInvalid bool
+	noCopy    bool // return borrowed keys and values, see UnsafeReader
+	keyOnly   bool // never read values, see IteratorOptions
 }
 
-var _ Iterator = (*goLevelDBIterator)(nil)
+var _ BidirectionalIterator = (*goLevelDBIterator)(nil)
 
 func newGoLevelDBIterator(source iterator.Iterator, start, end []byte, isReverse bool) *goLevelDBIterator {
 	if isReverse {
@@ -97,6 +99,9 @@ func (itr *goLevelDBIterator) Key() []byte {
 	// Key returns a copy of the current key.
 	// See https://github.com/syndtr/goleveldb/blob/52c212e6c196a1404ea59592d3f1c227c9f034b2/leveldb/iterator/iter.go#L88
 	itr.assertIsValid()
+	if itr.noCopy {
+		return itr.source.Key()
+	}
 	return cp(itr.source.Key())
 }
 
@@ -105,6 +110,12 @@ func (itr *goLevelDBIterator) Value() []byte {
 	// Value returns a copy of the current value.
 	// See https://github.com/syndtr/goleveldb/blob/52c212e6c196a1404ea59592d3f1c227c9f034b2/leveldb/iterator/iter.go#L88
 	itr.assertIsValid()
+	if itr.keyOnly {
+		return nil
+	}
+	if itr.noCopy {
+		return itr.source.Value()
+	}
 	return cp(itr.source.Value())
 }
 
@@ -118,6 +129,16 @@ func (itr *goLevelDBIterator) Next() {
 	}
 }
 
+// Prev implements BidirectionalIterator.
+func (itr *goLevelDBIterator) Prev() {
+	itr.assertIsValid()
+	if itr.isReverse {
+		itr.source.Next()
+	} else {
+		itr.source.Prev()
+	}
+}
+
 // Error implements Iterator.
 func (itr *goLevelDBIterator) Error() error {
 	return itr.source.Error()
@@ -2,6 +2,7 @@ package db
 
 import (
 	"fmt"
+	"os"
 	"testing"
 
 	"github.com/stretchr/testify/require"
@@ -28,6 +29,21 @@ func TestGoLevelDBNewGoLevelDB(t *testing.T) {
 	defer ro2.Close()
 }
 
+func TestGoLevelDBMemBackend(t *testing.T) {
+	dir := t.TempDir()
+	db, err := NewDB("testdb", GoLevelDBMemBackend, dir)
+	require.NoError(t, err)
+	defer db.Close()
+
+	_, ok := db.(*GoLevelDB)
+	require.True(t, ok)
+
+	require.NoError(t, db.SetSync([]byte("a"), []byte{1}))
+	entries, err := os.ReadDir(dir)
+	require.NoError(t, err)
+	require.Empty(t, entries)
+}
+
 func BenchmarkGoLevelDBRandomReadsWrites(b *testing.B) {
 	name := fmt.Sprintf("test_%x", randStr(12))
 	db, err := NewGoLevelDB(name, "", nil)
@@ -41,3 +57,17 @@ func BenchmarkGoLevelDBRandomReadsWrites(b *testing.B) {
 
 	benchmarkRandomReadsWrites(b, db)
 }
+
+func BenchmarkGoLevelDBCASWithSyncWrites(b *testing.B) {
+	name := fmt.Sprintf("test_%x", randStr(12))
+	db, err := NewGoLevelDB(name, "", nil)
+	if err != nil {
+		b.Fatal(err)
+	}
+	defer func() {
+		require.NoError(b, db.Close())
+		cleanupDBDir("", name)
+	}()
+
+	benchmarkCASWithSyncWrites(b, db)
+}
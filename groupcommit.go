@@ -0,0 +1,411 @@
+package db
+
+import (
+	"strconv"
+	"sync"
+	"sync/atomic"
+)
+
+// GroupCommitDB wraps a database and coalesces concurrent synchronous writes, i.e. SetSync,
+// DeleteSync and Batch.WriteSync, into a single batch written with one WriteSync, so they share
+// one fsync. This helps backends such as goleveldb which sync every write on its own, under
+// workloads with many concurrent small durable writes.
+//
+// The first writer to arrive commits its own writes along with those queued while it was
+// waiting for the previous commit, and acknowledges all of them with the same result. Each
+// caller's writes stay atomic, but a failing commit fails every write of the group, none of
+// which is applied.
+//
+// GroupCommitDB also implements AsyncWriter: asynchronous writes are queued the same way and
+// committed in the background. Queued writes are not applied until committed, so reads of their
+// keys wait for them, and other writes and iterators wait for all queued writes, to keep them
+// ordered. Merges, conditional writes and ingestion are forwarded to the underlying database if
+// it supports them, without syncing them.
+type GroupCommitDB struct {
+	db DB
+
+	mtx     sync.Mutex // guards queue, leading, pending and last
+	queue   []*groupCommitRequest
+	leading bool
+	pending map[string]*groupCommitRequest // last request writing each key, until committed
+	last    *groupCommitRequest            // last request queued, until committed
+
+	commits uint64 // number of commits, accessed atomically
+	writes  uint64 // number of synchronous writes, accessed atomically
+}
+
+// groupCommitRequest is a synchronous write waiting to be committed. It is also the handle of
+// asynchronous writes.
+type groupCommitRequest struct {
+	ops  []operation
+	err  error
+	done chan struct{} // closed once committed, with the result in err
+	lead chan struct{} // closed when the request has to commit the queue
+}
+
+var (
+	_ DB                  = (*GroupCommitDB)(nil)
+	_ AsyncWriter         = (*GroupCommitDB)(nil)
+	_ Merger              = (*GroupCommitDB)(nil)
+	_ ConditionalWriter   = (*GroupCommitDB)(nil)
+	_ MultiGetter         = (*GroupCommitDB)(nil)
+	_ IterableWithOptions = (*GroupCommitDB)(nil)
+	_ Ingester            = (*GroupCommitDB)(nil)
+	_ WriteHandle         = (*groupCommitRequest)(nil)
+)
+
+// NewGroupCommitDB creates a new GroupCommitDB wrapping db.
+func NewGroupCommitDB(db DB) *GroupCommitDB {
+	return &GroupCommitDB{
+		db:      db,
+		pending: make(map[string]*groupCommitRequest),
+	}
+}
+
+// Wait implements WriteHandle.
+func (r *groupCommitRequest) Wait() error {
+	<-r.done
+	return r.err
+}
+
+// commit queues operations for the next commit and waits for it.
+func (gdb *GroupCommitDB) commit(ops []operation) error {
+	req, follow := gdb.enqueue(ops)
+	gdb.process(req, follow)
+	return req.err
+}
+
+// commitAsync queues operations for the next commit, which is waited for in the background. The
+// operations are copied, as the caller may reuse their keys and values once it returns.
+func (gdb *GroupCommitDB) commitAsync(ops []operation) WriteHandle {
+	copied := make([]operation, 0, len(ops))
+	for _, op := range ops {
+		copied = append(copied, operation{op.opType, cp(op.key), cp(op.value)})
+	}
+	req, follow := gdb.enqueue(copied)
+	go gdb.process(req, follow)
+	return req
+}
+
+// enqueue queues operations for the next commit, returning whether a commit is in progress,
+// which will hand over to the request once done.
+func (gdb *GroupCommitDB) enqueue(ops []operation) (*groupCommitRequest, bool) {
+	req := &groupCommitRequest{
+		ops:  ops,
+		done: make(chan struct{}),
+		lead: make(chan struct{}),
+	}
+	atomic.AddUint64(&gdb.writes, 1)
+
+	gdb.mtx.Lock()
+	defer gdb.mtx.Unlock()
+	gdb.queue = append(gdb.queue, req)
+	for _, op := range ops {
+		gdb.pending[string(op.key)] = req
+	}
+	gdb.last = req
+	follow := gdb.leading
+	gdb.leading = true
+	return req, follow
+}
+
+// process waits until a queued request is committed. If no commit is in progress, or once one
+// hands over to the request, it commits the queue itself, and then hands over to the first
+// request queued in the meantime, if any.
+func (gdb *GroupCommitDB) process(req *groupCommitRequest, follow bool) {
+	if follow {
+		select {
+		case <-req.done:
+			return
+		case <-req.lead:
+		}
+	}
+
+	gdb.mtx.Lock()
+	group := gdb.queue
+	gdb.queue = nil
+	gdb.mtx.Unlock()
+
+	err := gdb.write(group)
+
+	gdb.mtx.Lock()
+	for _, r := range group {
+		for _, op := range r.ops {
+			if gdb.pending[string(op.key)] == r {
+				delete(gdb.pending, string(op.key))
+			}
+		}
+		if gdb.last == r {
+			gdb.last = nil
+		}
+	}
+	gdb.mtx.Unlock()
+	for _, r := range group {
+		r.err = err
+		close(r.done)
+	}
+
+	gdb.mtx.Lock()
+	if len(gdb.queue) > 0 {
+		close(gdb.queue[0].lead)
+	} else {
+		gdb.leading = false
+	}
+	gdb.mtx.Unlock()
+}
+
+// write writes the operations of a group of requests in a single synced batch.
+func (gdb *GroupCommitDB) write(group []*groupCommitRequest) error {
+	atomic.AddUint64(&gdb.commits, 1)
+	size := 0
+	for _, r := range group {
+		for _, op := range r.ops {
+			size += len(op.key) + len(op.value)
+		}
+	}
+	batch := gdb.db.NewBatchWithSize(size)
+	defer batch.Close()
+	for _, r := range group {
+		for _, op := range r.ops {
+			if err := applyBatchOp(batch, op.batchOp()); err != nil {
+				return err
+			}
+		}
+	}
+	return batch.WriteSync()
+}
+
+// waitKeys waits until the queued writes to the given keys are committed, if any.
+func (gdb *GroupCommitDB) waitKeys(keys ...[]byte) {
+	gdb.mtx.Lock()
+	var reqs []*groupCommitRequest
+	for _, key := range keys {
+		if req, ok := gdb.pending[string(key)]; ok {
+			reqs = append(reqs, req)
+		}
+	}
+	gdb.mtx.Unlock()
+	for _, req := range reqs {
+		<-req.done
+	}
+}
+
+// waitAll waits until all queued writes are committed, if any. Requests are committed in order,
+// so it is enough to wait for the last one.
+func (gdb *GroupCommitDB) waitAll() {
+	gdb.mtx.Lock()
+	req := gdb.last
+	gdb.mtx.Unlock()
+	if req != nil {
+		<-req.done
+	}
+}
+
+// Get implements DB.
+func (gdb *GroupCommitDB) Get(key []byte) ([]byte, error) {
+	gdb.waitKeys(key)
+	return gdb.db.Get(key)
+}
+
+// Has implements DB.
+func (gdb *GroupCommitDB) Has(key []byte) (bool, error) {
+	gdb.waitKeys(key)
+	return gdb.db.Has(key)
+}
+
+// Set implements DB.
+func (gdb *GroupCommitDB) Set(key, value []byte) error {
+	gdb.waitAll()
+	return gdb.db.Set(key, value)
+}
+
+// SetSync implements DB.
+func (gdb *GroupCommitDB) SetSync(key, value []byte) error {
+	if len(key) == 0 {
+		return errKeyEmpty
+	}
+	if value == nil {
+		return errValueNil
+	}
+	return gdb.commit([]operation{{opTypeSet, key, value}})
+}
+
+// SetAsync implements AsyncWriter, queuing the write for the next commit.
+func (gdb *GroupCommitDB) SetAsync(key, value []byte) (WriteHandle, error) {
+	if len(key) == 0 {
+		return nil, errKeyEmpty
+	}
+	if value == nil {
+		return nil, errValueNil
+	}
+	return gdb.commitAsync([]operation{{opTypeSet, key, value}}), nil
+}
+
+// Delete implements DB.
+func (gdb *GroupCommitDB) Delete(key []byte) error {
+	gdb.waitAll()
+	return gdb.db.Delete(key)
+}
+
+// DeleteSync implements DB.
+func (gdb *GroupCommitDB) DeleteSync(key []byte) error {
+	if len(key) == 0 {
+		return errKeyEmpty
+	}
+	return gdb.commit([]operation{{opTypeDelete, key, nil}})
+}
+
+// DeleteAsync implements AsyncWriter, queuing the delete for the next commit.
+func (gdb *GroupCommitDB) DeleteAsync(key []byte) (WriteHandle, error) {
+	if len(key) == 0 {
+		return nil, errKeyEmpty
+	}
+	return gdb.commitAsync([]operation{{opTypeDelete, key, nil}}), nil
+}
+
+// Merge implements Merger, if the underlying database supports merges.
+func (gdb *GroupCommitDB) Merge(key, operand []byte) error {
+	merger, ok := gdb.db.(Merger)
+	if !ok {
+		return errMergeOperatorMissing
+	}
+	gdb.waitAll()
+	return merger.Merge(key, operand)
+}
+
+// CompareAndSwap implements ConditionalWriter, if the underlying database supports it.
+func (gdb *GroupCommitDB) CompareAndSwap(key, oldValue, newValue []byte) (bool, error) {
+	writer, ok := gdb.db.(ConditionalWriter)
+	if !ok {
+		return false, errConditionalWritesUnsupported
+	}
+	gdb.waitAll()
+	return writer.CompareAndSwap(key, oldValue, newValue)
+}
+
+// SetIfAbsent implements ConditionalWriter, if the underlying database supports it.
+func (gdb *GroupCommitDB) SetIfAbsent(key, value []byte) (bool, error) {
+	writer, ok := gdb.db.(ConditionalWriter)
+	if !ok {
+		return false, errConditionalWritesUnsupported
+	}
+	gdb.waitAll()
+	return writer.SetIfAbsent(key, value)
+}
+
+// MultiGet implements MultiGetter.
+func (gdb *GroupCommitDB) MultiGet(keys [][]byte) ([][]byte, error) {
+	gdb.waitKeys(keys...)
+	return MultiGet(gdb.db, keys)
+}
+
+// Iterator implements DB.
+func (gdb *GroupCommitDB) Iterator(start, end []byte) (Iterator, error) {
+	gdb.waitAll()
+	return gdb.db.Iterator(start, end)
+}
+
+// ReverseIterator implements DB.
+func (gdb *GroupCommitDB) ReverseIterator(start, end []byte) (Iterator, error) {
+	gdb.waitAll()
+	return gdb.db.ReverseIterator(start, end)
+}
+
+// IteratorWithOptions implements IterableWithOptions.
+func (gdb *GroupCommitDB) IteratorWithOptions(start, end []byte, opts IteratorOptions) (Iterator, error) {
+	gdb.waitAll()
+	return IteratorWithOptions(gdb.db, start, end, opts)
+}
+
+// NewSSTWriter implements Ingester.
+func (gdb *GroupCommitDB) NewSSTWriter(path string) (SSTWriter, error) {
+	return NewSSTWriter(gdb.db, path)
+}
+
+// Ingest implements Ingester.
+func (gdb *GroupCommitDB) Ingest(paths []string) error {
+	gdb.waitAll()
+	return Ingest(gdb.db, paths)
+}
+
+// Close implements DB, once the queued writes are committed.
+func (gdb *GroupCommitDB) Close() error {
+	gdb.waitAll()
+	return gdb.db.Close()
+}
+
+// NewBatch implements DB.
+func (gdb *GroupCommitDB) NewBatch() Batch {
+	return &groupCommitBatch{recordingBatch: recordingBatch{Batch: gdb.db.NewBatch()}, gdb: gdb}
+}
+
+// NewBatchWithSize implements DB.
+func (gdb *GroupCommitDB) NewBatchWithSize(size int) Batch {
+	return &groupCommitBatch{recordingBatch: recordingBatch{Batch: gdb.db.NewBatchWithSize(size)}, gdb: gdb}
+}
+
+// Print implements DB.
+func (gdb *GroupCommitDB) Print() error {
+	return gdb.db.Print()
+}
+
+// Stats implements DB, adding the number of synchronous writes and of the commits they were
+// grouped into.
+func (gdb *GroupCommitDB) Stats() map[string]string {
+	stats := make(map[string]string)
+	for k, v := range gdb.db.Stats() {
+		stats[k] = v
+	}
+	stats["groupcommit.writes"] = strconv.FormatUint(atomic.LoadUint64(&gdb.writes), 10)
+	stats["groupcommit.commits"] = strconv.FormatUint(atomic.LoadUint64(&gdb.commits), 10)
+	return stats
+}
+
+// groupCommitBatch keeps track of the operations of a batch, so that WriteSync and WriteAsync can
+// commit them along with other synchronous writes. Write uses the underlying batch.
+type groupCommitBatch struct {
+	recordingBatch
+	gdb *GroupCommitDB
+}
+
+var (
+	_ Batch      = (*groupCommitBatch)(nil)
+	_ Merger     = (*groupCommitBatch)(nil)
+	_ AsyncBatch = (*groupCommitBatch)(nil)
+)
+
+// Write implements Batch, once the queued writes are committed.
+func (b *groupCommitBatch) Write() error {
+	if b.closed {
+		return errBatchClosed
+	}
+	b.gdb.waitAll()
+	if err := b.Batch.Write(); err != nil {
+		return err
+	}
+	b.reset()
+	return nil
+}
+
+// WriteSync implements Batch, committing the operations along with other synchronous writes.
+func (b *groupCommitBatch) WriteSync() error {
+	if b.closed {
+		return errBatchClosed
+	}
+	if err := b.gdb.commit(b.ops); err != nil {
+		return err
+	}
+	return b.Close()
+}
+
+// WriteAsync implements AsyncBatch, queuing the operations for the next commit.
+func (b *groupCommitBatch) WriteAsync() (WriteHandle, error) {
+	if b.closed {
+		return nil, errBatchClosed
+	}
+	handle := b.gdb.commitAsync(b.ops)
+	if err := b.Close(); err != nil {
+		return nil, err
+	}
+	return handle, nil
+}
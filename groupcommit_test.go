@@ -0,0 +1,202 @@
+package db
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestGroupCommitDB(t *testing.T) {
+	for backend := range backends {
+		t.Run(string(backend), func(t *testing.T) {
+			db, dir := newTempDB(t, backend)
+			defer os.RemoveAll(dir)
+			gdb := NewGroupCommitDB(db)
+			defer gdb.Close()
+
+			require.NoError(t, gdb.Set([]byte("deleted"), []byte{1}))
+
+			var wg sync.WaitGroup
+			errs := make(chan error, 64)
+			for i := 0; i < 32; i++ {
+				i := i
+				wg.Add(2)
+				go func() {
+					defer wg.Done()
+					errs <- gdb.SetSync([]byte(fmt.Sprintf("set/%02d", i)), []byte{byte(i)})
+				}()
+				go func() {
+					defer wg.Done()
+					batch := gdb.NewBatch()
+					defer batch.Close()
+					if err := batch.Set([]byte(fmt.Sprintf("batch/%02d/a", i)), []byte{byte(i)}); err != nil {
+						errs <- err
+						return
+					}
+					if err := batch.Set([]byte(fmt.Sprintf("batch/%02d/b", i)), []byte{}); err != nil {
+						errs <- err
+						return
+					}
+					errs <- batch.WriteSync()
+				}()
+			}
+			wg.Wait()
+			close(errs)
+			for err := range errs {
+				require.NoError(t, err)
+			}
+			require.NoError(t, gdb.DeleteSync([]byte("deleted")))
+
+			for i := 0; i < 32; i++ {
+				checkValue(t, gdb, []byte(fmt.Sprintf("set/%02d", i)), []byte{byte(i)})
+				checkValue(t, gdb, []byte(fmt.Sprintf("batch/%02d/a", i)), []byte{byte(i)})
+				checkValue(t, gdb, []byte(fmt.Sprintf("batch/%02d/b", i)), []byte{})
+			}
+			checkValue(t, gdb, []byte("deleted"), nil)
+
+			stats := gdb.Stats()
+			require.Equal(t, "65", stats["groupcommit.writes"])
+			require.NotEmpty(t, stats["groupcommit.commits"])
+
+			// Written batches can't be written again, and invalid writes fail on their own.
+			batch := gdb.NewBatch()
+			require.NoError(t, batch.Set([]byte("key"), []byte{1}))
+			require.NoError(t, batch.WriteSync())
+			require.Equal(t, errBatchClosed, batch.WriteSync())
+			require.NoError(t, batch.Close())
+			require.Equal(t, errKeyEmpty, gdb.SetSync(nil, []byte{1}))
+			require.Equal(t, errValueNil, gdb.SetSync([]byte("key"), nil))
+			require.Equal(t, errKeyEmpty, gdb.DeleteSync(nil))
+		})
+	}
+}
+
+// blockingSyncDB blocks the first Batch.WriteSync until release is closed, and signals blocked
+// once it is reached.
+type blockingSyncDB struct {
+	DB
+	once    sync.Once
+	blocked chan struct{}
+	release chan struct{}
+}
+
+func (db *blockingSyncDB) NewBatchWithSize(size int) Batch {
+	return &blockingSyncBatch{Batch: db.DB.NewBatchWithSize(size), db: db}
+}
+
+type blockingSyncBatch struct {
+	Batch
+	db *blockingSyncDB
+}
+
+func (b *blockingSyncBatch) WriteSync() error {
+	b.db.once.Do(func() {
+		close(b.db.blocked)
+		<-b.db.release
+	})
+	return b.Batch.WriteSync()
+}
+
+func TestGroupCommitDBCoalesces(t *testing.T) {
+	// Block the first sync until the following writes have queued up behind it.
+	db := &blockingSyncDB{DB: NewMemDB(), blocked: make(chan struct{}), release: make(chan struct{})}
+	gdb := NewGroupCommitDB(db)
+
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		require.NoError(t, gdb.SetSync([]byte("first"), []byte{0}))
+	}()
+	<-db.blocked
+
+	for i := 1; i <= 10; i++ {
+		i := i
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			require.NoError(t, gdb.SetSync([]byte{byte(i)}, []byte{byte(i)}))
+		}()
+	}
+	require.Eventually(t, func() bool {
+		gdb.mtx.Lock()
+		defer gdb.mtx.Unlock()
+		return len(gdb.queue) == 10
+	}, 10*time.Second, time.Millisecond)
+	close(db.release)
+	wg.Wait()
+
+	for i := 1; i <= 10; i++ {
+		checkValue(t, gdb, []byte{byte(i)}, []byte{byte(i)})
+	}
+	stats := gdb.Stats()
+	require.Equal(t, "11", stats["groupcommit.writes"])
+	require.Equal(t, "2", stats["groupcommit.commits"])
+}
+
+func TestGroupCommitDBErrors(t *testing.T) {
+	fdb := NewFaultDB(NewMemDB())
+	gdb := NewGroupCommitDB(fdb)
+
+	// A failing commit fails all of its writes, none of which is applied.
+	fdb.AddFault(Fault{Ops: FaultBatchWrite, Err: errTestFault})
+	require.Equal(t, errTestFault, gdb.SetSync([]byte("a"), []byte{1}))
+	batch := gdb.NewBatch()
+	require.NoError(t, batch.Set([]byte("b"), []byte{1}))
+	require.Equal(t, errTestFault, batch.WriteSync())
+	require.NoError(t, batch.Close())
+	checkValue(t, gdb, []byte("a"), nil)
+	checkValue(t, gdb, []byte("b"), nil)
+
+	// Writes succeed again once the fault is cleared, and are durable along with the writes
+	// before them.
+	fdb.ClearFaults()
+	require.NoError(t, gdb.SetSync([]byte("a"), []byte{1}))
+	require.NoError(t, gdb.Set([]byte("c"), []byte{1}))
+	require.NoError(t, gdb.DeleteSync([]byte("d")))
+	require.NoError(t, fdb.Crash())
+	checkValue(t, gdb, []byte("a"), []byte{1})
+	checkValue(t, gdb, []byte("c"), []byte{1})
+	checkValue(t, gdb, []byte("d"), nil)
+
+	// Merges need a batch supporting them.
+	batch = gdb.NewBatch()
+	require.Equal(t, errMergeOperatorMissing, batch.(Merger).Merge([]byte("c"), []byte{1}))
+	require.NoError(t, batch.Close())
+}
+
+func TestGroupCommitDBOptionalInterfaces(t *testing.T) {
+	gdb := NewGroupCommitDB(NewMemDBWithMergeOperator(counterMergeOperator{}))
+
+	require.NoError(t, gdb.Merge([]byte("counter"), counterValue(2)))
+	require.NoError(t, gdb.Merge([]byte("counter"), counterValue(3)))
+	swapped, err := gdb.CompareAndSwap([]byte("key"), nil, []byte{1})
+	require.NoError(t, err)
+	require.True(t, swapped)
+	swapped, err = gdb.SetIfAbsent([]byte("key"), []byte{2})
+	require.NoError(t, err)
+	require.False(t, swapped)
+
+	path := filepath.Join(t.TempDir(), "ingest.sst")
+	writer, err := gdb.NewSSTWriter(path)
+	require.NoError(t, err)
+	require.NoError(t, writer.Set([]byte("ingested"), []byte{3}))
+	require.NoError(t, writer.Finish())
+	require.NoError(t, gdb.Ingest([]string{path}))
+
+	values, err := gdb.MultiGet([][]byte{[]byte("counter"), []byte("key"), []byte("ingested")})
+	require.NoError(t, err)
+	require.Equal(t, [][]byte{counterValue(5), {1}, {3}}, values)
+	itr, err := gdb.IteratorWithOptions([]byte("i"), nil, IteratorOptions{PrefixSameAsStart: true})
+	require.NoError(t, err)
+	require.Equal(t, [][2][]byte{{[]byte("ingested"), {3}}}, collectFuzzPairs(t, itr))
+
+	// Writes to merged keys are synced like others.
+	require.NoError(t, gdb.SetSync([]byte("counter"), counterValue(1)))
+	checkValue(t, gdb, []byte("counter"), counterValue(1))
+}
@@ -0,0 +1,301 @@
+package db
+
+import "sync"
+
+// Commit is a write to a HookDB, i.e. a Set, Delete or batch write, passed to its hooks.
+type Commit struct {
+	// Ops are the operations of the write, in order. They must not be modified, and are only valid
+	// during the hook calls.
+	Ops []BatchOp
+
+	// Sync is whether the write is synchronous, i.e. SetSync, DeleteSync or Batch.WriteSync.
+	Sync bool
+
+	// Annotations are set by pre-commit hooks with Annotate, and passed on to the following hooks.
+	Annotations map[string]interface{}
+}
+
+// Annotate sets an annotation of the commit, e.g. for post-commit hooks.
+func (c *Commit) Annotate(key string, value interface{}) {
+	if c.Annotations == nil {
+		c.Annotations = make(map[string]interface{})
+	}
+	c.Annotations[key] = value
+}
+
+// PreCommitHook is called before a write is applied. Returning an error rejects the write, which
+// then fails with that error.
+type PreCommitHook func(c *Commit) error
+
+// PostCommitHook is called after a write is committed.
+type PostCommitHook func(c *Commit)
+
+// HookDB wraps a database and calls hooks around its writes, e.g. to enforce invariants such as
+// writing only to allowed prefixes, or to maintain derived data. Pre-commit hooks are called in
+// the order they were added before every write, and can reject or annotate it. Post-commit hooks
+// are called in the order they were added after every successful write.
+//
+// Hooks are called by the writing goroutine, and are not serialized: concurrent writes call them
+// concurrently. They can write to the database, but writes through the HookDB call the hooks
+// again.
+//
+// Merges and conditional writes are forwarded to the underlying database if it supports them, and
+// call the hooks with a merge, or with the set or delete they would make. Whether a conditional
+// write is applied is only known once it is made, so pre-commit hooks are called for every
+// conditional write, including those which end up not being applied, while post-commit hooks are
+// only called for those which are. HookDB does not implement Ingester, so that Ingest falls back
+// to writing the files in batches, which call the hooks.
+type HookDB struct {
+	db DB
+
+	mtx  sync.RWMutex // guards pre and post
+	pre  []PreCommitHook
+	post []PostCommitHook
+}
+
+var (
+	_ DB                  = (*HookDB)(nil)
+	_ Merger              = (*HookDB)(nil)
+	_ ConditionalWriter   = (*HookDB)(nil)
+	_ MultiGetter         = (*HookDB)(nil)
+	_ IterableWithOptions = (*HookDB)(nil)
+)
+
+// NewHookDB creates a new HookDB wrapping db.
+func NewHookDB(db DB) *HookDB {
+	return &HookDB{db: db}
+}
+
+// AddPreCommitHook adds a hook called before every write.
+func (hdb *HookDB) AddPreCommitHook(hook PreCommitHook) {
+	hdb.mtx.Lock()
+	defer hdb.mtx.Unlock()
+	hdb.pre = append(hdb.pre, hook)
+}
+
+// AddPostCommitHook adds a hook called after every successful write.
+func (hdb *HookDB) AddPostCommitHook(hook PostCommitHook) {
+	hdb.mtx.Lock()
+	defer hdb.mtx.Unlock()
+	hdb.post = append(hdb.post, hook)
+}
+
+// write runs a write between the pre-commit and post-commit hooks.
+func (hdb *HookDB) write(ops []operation, sync bool, apply func() error) error {
+	_, err := hdb.writeIf(ops, sync, func() (bool, error) {
+		return true, apply()
+	})
+	return err
+}
+
+// writeIf runs a write which may not be applied, i.e. a conditional write, between the pre-commit
+// and post-commit hooks. Post-commit hooks are only called if it is applied.
+func (hdb *HookDB) writeIf(ops []operation, sync bool, apply func() (bool, error)) (bool, error) {
+	hdb.mtx.RLock()
+	pre, post := hdb.pre, hdb.post
+	hdb.mtx.RUnlock()
+	if len(pre) == 0 && len(post) == 0 {
+		return apply()
+	}
+
+	c := &Commit{Ops: make([]BatchOp, 0, len(ops)), Sync: sync}
+	for _, op := range ops {
+		c.Ops = append(c.Ops, op.batchOp())
+	}
+	for _, hook := range pre {
+		if err := hook(c); err != nil {
+			return false, err
+		}
+	}
+	applied, err := apply()
+	if err != nil || !applied {
+		return applied, err
+	}
+	for _, hook := range post {
+		hook(c)
+	}
+	return true, nil
+}
+
+// Get implements DB.
+func (hdb *HookDB) Get(key []byte) ([]byte, error) {
+	return hdb.db.Get(key)
+}
+
+// Has implements DB.
+func (hdb *HookDB) Has(key []byte) (bool, error) {
+	return hdb.db.Has(key)
+}
+
+// Set implements DB.
+func (hdb *HookDB) Set(key, value []byte) error {
+	return hdb.set(key, value, false, hdb.db.Set)
+}
+
+// SetSync implements DB.
+func (hdb *HookDB) SetSync(key, value []byte) error {
+	return hdb.set(key, value, true, hdb.db.SetSync)
+}
+
+func (hdb *HookDB) set(key, value []byte, sync bool, fn func(key, value []byte) error) error {
+	if len(key) == 0 {
+		return errKeyEmpty
+	}
+	if value == nil {
+		return errValueNil
+	}
+	return hdb.write([]operation{{opTypeSet, key, value}}, sync, func() error {
+		return fn(key, value)
+	})
+}
+
+// Delete implements DB.
+func (hdb *HookDB) Delete(key []byte) error {
+	return hdb.delete(key, false, hdb.db.Delete)
+}
+
+// DeleteSync implements DB.
+func (hdb *HookDB) DeleteSync(key []byte) error {
+	return hdb.delete(key, true, hdb.db.DeleteSync)
+}
+
+func (hdb *HookDB) delete(key []byte, sync bool, fn func(key []byte) error) error {
+	if len(key) == 0 {
+		return errKeyEmpty
+	}
+	return hdb.write([]operation{{opTypeDelete, key, nil}}, sync, func() error {
+		return fn(key)
+	})
+}
+
+// Merge implements Merger, if the underlying database supports merges.
+func (hdb *HookDB) Merge(key, operand []byte) error {
+	if len(key) == 0 {
+		return errKeyEmpty
+	}
+	if operand == nil {
+		return errValueNil
+	}
+	merger, ok := hdb.db.(Merger)
+	if !ok {
+		return errMergeOperatorMissing
+	}
+	return hdb.write([]operation{{opTypeMerge, key, operand}}, false, func() error {
+		return merger.Merge(key, operand)
+	})
+}
+
+// CompareAndSwap implements ConditionalWriter, if the underlying database supports it. The hooks
+// are called with the set or delete of the swap: pre-commit hooks even if the swap is then not
+// applied, and post-commit hooks only if it is.
+func (hdb *HookDB) CompareAndSwap(key, oldValue, newValue []byte) (bool, error) {
+	if len(key) == 0 {
+		return false, errKeyEmpty
+	}
+	writer, ok := hdb.db.(ConditionalWriter)
+	if !ok {
+		return false, errConditionalWritesUnsupported
+	}
+	op := operation{opTypeSet, key, newValue}
+	if newValue == nil {
+		op = operation{opTypeDelete, key, nil}
+	}
+	return hdb.writeIf([]operation{op}, false, func() (bool, error) {
+		return writer.CompareAndSwap(key, oldValue, newValue)
+	})
+}
+
+// SetIfAbsent implements ConditionalWriter, if the underlying database supports it.
+func (hdb *HookDB) SetIfAbsent(key, value []byte) (bool, error) {
+	if len(key) == 0 {
+		return false, errKeyEmpty
+	}
+	if value == nil {
+		return false, errValueNil
+	}
+	writer, ok := hdb.db.(ConditionalWriter)
+	if !ok {
+		return false, errConditionalWritesUnsupported
+	}
+	return hdb.writeIf([]operation{{opTypeSet, key, value}}, false, func() (bool, error) {
+		return writer.SetIfAbsent(key, value)
+	})
+}
+
+// MultiGet implements MultiGetter.
+func (hdb *HookDB) MultiGet(keys [][]byte) ([][]byte, error) {
+	return MultiGet(hdb.db, keys)
+}
+
+// Iterator implements DB.
+func (hdb *HookDB) Iterator(start, end []byte) (Iterator, error) {
+	return hdb.db.Iterator(start, end)
+}
+
+// ReverseIterator implements DB.
+func (hdb *HookDB) ReverseIterator(start, end []byte) (Iterator, error) {
+	return hdb.db.ReverseIterator(start, end)
+}
+
+// IteratorWithOptions implements IterableWithOptions.
+func (hdb *HookDB) IteratorWithOptions(start, end []byte, opts IteratorOptions) (Iterator, error) {
+	return IteratorWithOptions(hdb.db, start, end, opts)
+}
+
+// Close implements DB.
+func (hdb *HookDB) Close() error {
+	return hdb.db.Close()
+}
+
+// NewBatch implements DB.
+func (hdb *HookDB) NewBatch() Batch {
+	return &hookDBBatch{recordingBatch: recordingBatch{Batch: hdb.db.NewBatch()}, hdb: hdb}
+}
+
+// NewBatchWithSize implements DB.
+func (hdb *HookDB) NewBatchWithSize(size int) Batch {
+	return &hookDBBatch{recordingBatch: recordingBatch{Batch: hdb.db.NewBatchWithSize(size)}, hdb: hdb}
+}
+
+// Print implements DB.
+func (hdb *HookDB) Print() error {
+	return hdb.db.Print()
+}
+
+// Stats implements DB.
+func (hdb *HookDB) Stats() map[string]string {
+	return hdb.db.Stats()
+}
+
+// hookDBBatch keeps track of the operations of a batch, to pass them to the hooks when written.
+type hookDBBatch struct {
+	recordingBatch
+	hdb *HookDB
+}
+
+var (
+	_ Batch  = (*hookDBBatch)(nil)
+	_ Merger = (*hookDBBatch)(nil)
+)
+
+// Write implements Batch. A rejected batch is left unwritten.
+func (b *hookDBBatch) Write() error {
+	return b.write(false, b.Batch.Write)
+}
+
+// WriteSync implements Batch. A rejected batch is left unwritten.
+func (b *hookDBBatch) WriteSync() error {
+	return b.write(true, b.Batch.WriteSync)
+}
+
+func (b *hookDBBatch) write(sync bool, apply func() error) error {
+	// Hooks are not called for written or closed batches.
+	if b.closed {
+		return errBatchClosed
+	}
+	if err := b.hdb.write(b.ops, sync, apply); err != nil {
+		return err
+	}
+	b.reset()
+	return nil
+}
@@ -0,0 +1,170 @@
+package db
+
+import (
+	"bytes"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+var errTestForbiddenPrefix = errors.New("write outside of allowed prefixes")
+
+func TestHookDB(t *testing.T) {
+	for backend := range backends {
+		t.Run(string(backend), func(t *testing.T) {
+			db, dir := newTempDB(t, backend)
+			defer os.RemoveAll(dir)
+			hdb := NewHookDB(db)
+			defer hdb.Close()
+
+			// Without hooks, writes go straight through.
+			require.NoError(t, hdb.Set([]byte("x/1"), []byte{1}))
+
+			// Reject writes outside of "a/", annotate the others with their size, and record the
+			// committed ones.
+			hdb.AddPreCommitHook(func(c *Commit) error {
+				size := 0
+				for _, op := range c.Ops {
+					if !bytes.HasPrefix(op.Key, []byte("a/")) {
+						return errTestForbiddenPrefix
+					}
+					size += len(op.Key) + len(op.Value)
+				}
+				c.Annotate("size", size)
+				return nil
+			})
+			var commits []Commit
+			hdb.AddPostCommitHook(func(c *Commit) {
+				commits = append(commits, *c)
+			})
+
+			require.NoError(t, hdb.Set([]byte("a/1"), []byte{1}))
+			require.NoError(t, hdb.DeleteSync([]byte("a/2")))
+			require.Equal(t, errTestForbiddenPrefix, hdb.SetSync([]byte("b/1"), []byte{1}))
+			require.Equal(t, errTestForbiddenPrefix, hdb.Delete([]byte("x/1")))
+			require.Equal(t, errKeyEmpty, hdb.Set(nil, []byte{1}))
+
+			batch := hdb.NewBatch()
+			require.NoError(t, batch.Set([]byte("a/3"), []byte{3}))
+			require.NoError(t, batch.Set([]byte("b/3"), []byte{3}))
+			require.Equal(t, errTestForbiddenPrefix, batch.WriteSync())
+			require.NoError(t, batch.Close())
+
+			batch = hdb.NewBatch()
+			require.NoError(t, batch.Set([]byte("a/4"), []byte{4}))
+			require.NoError(t, batch.Delete([]byte("a/1")))
+			require.NoError(t, batch.WriteSync())
+			require.Equal(t, errBatchClosed, batch.Write())
+			require.NoError(t, batch.Close())
+
+			checkValue(t, hdb, []byte("a/1"), nil)
+			checkValue(t, hdb, []byte("a/3"), nil)
+			checkValue(t, hdb, []byte("a/4"), []byte{4})
+			checkValue(t, hdb, []byte("b/1"), nil)
+			checkValue(t, hdb, []byte("b/3"), nil)
+			checkValue(t, hdb, []byte("x/1"), []byte{1})
+
+			require.Len(t, commits, 3)
+			require.Equal(t, []BatchOp{{Type: BatchOpSet, Key: []byte("a/1"), Value: []byte{1}}}, commits[0].Ops)
+			require.False(t, commits[0].Sync)
+			require.Equal(t, 4, commits[0].Annotations["size"])
+			require.Equal(t, []BatchOp{{Type: BatchOpDelete, Key: []byte("a/2")}}, commits[1].Ops)
+			require.True(t, commits[1].Sync)
+			require.Equal(t, []BatchOp{
+				{Type: BatchOpSet, Key: []byte("a/4"), Value: []byte{4}},
+				{Type: BatchOpDelete, Key: []byte("a/1")},
+			}, commits[2].Ops)
+			require.True(t, commits[2].Sync)
+			require.Equal(t, 7, commits[2].Annotations["size"])
+		})
+	}
+}
+
+func TestHookDBFailedWrite(t *testing.T) {
+	fdb := NewFaultDB(NewMemDB())
+	hdb := NewHookDB(fdb)
+	pre, post := 0, 0
+	hdb.AddPreCommitHook(func(*Commit) error {
+		pre++
+		return nil
+	})
+	hdb.AddPostCommitHook(func(*Commit) {
+		post++
+	})
+
+	// Post-commit hooks are not called for failed writes.
+	fdb.AddFault(Fault{Ops: FaultSet, Err: errTestFault})
+	require.Equal(t, errTestFault, hdb.Set([]byte("key"), []byte{1}))
+	require.Equal(t, 1, pre)
+	require.Equal(t, 0, post)
+
+	fdb.ClearFaults()
+	require.NoError(t, hdb.Set([]byte("key"), []byte{1}))
+	require.Equal(t, 2, pre)
+	require.Equal(t, 1, post)
+}
+
+func TestHookDBOptionalInterfaces(t *testing.T) {
+	hdb := NewHookDB(NewMemDBWithMergeOperator(counterMergeOperator{}))
+	var pre, post []BatchOp
+	hdb.AddPreCommitHook(func(c *Commit) error {
+		pre = append(pre, c.Ops...)
+		if bytes.HasPrefix(c.Ops[0].Key, []byte("b/")) {
+			return errTestForbiddenPrefix
+		}
+		return nil
+	})
+	hdb.AddPostCommitHook(func(c *Commit) {
+		post = append(post, c.Ops...)
+	})
+
+	// Merges and conditional writes call the hooks, which can reject them. Pre-commit hooks are
+	// called for every conditional write, and post-commit hooks only for applied ones.
+	require.NoError(t, hdb.Merge([]byte("counter"), counterValue(2)))
+	require.Equal(t, errTestForbiddenPrefix, hdb.Merge([]byte("b/counter"), counterValue(2)))
+	swapped, err := hdb.CompareAndSwap([]byte("key"), nil, []byte{1})
+	require.NoError(t, err)
+	require.True(t, swapped)
+	swapped, err = hdb.SetIfAbsent([]byte("key"), []byte{2})
+	require.NoError(t, err)
+	require.False(t, swapped)
+	swapped, err = hdb.CompareAndSwap([]byte("b/key"), nil, []byte{1})
+	require.Equal(t, errTestForbiddenPrefix, err)
+	require.False(t, swapped)
+	swapped, err = hdb.CompareAndSwap([]byte("key"), []byte{1}, nil)
+	require.NoError(t, err)
+	require.True(t, swapped)
+
+	// Ingestion falls back to batches, which call the hooks.
+	path := filepath.Join(t.TempDir(), "ingest.sst")
+	writer, err := NewSSTWriter(hdb, path)
+	require.NoError(t, err)
+	require.NoError(t, writer.Set([]byte("b/ingested"), []byte{3}))
+	require.NoError(t, writer.Finish())
+	require.True(t, errors.Is(Ingest(hdb, []string{path}), errTestForbiddenPrefix))
+
+	merge := BatchOp{Type: BatchOpMerge, Key: []byte("counter"), Value: counterValue(2)}
+	set := BatchOp{Type: BatchOpSet, Key: []byte("key"), Value: []byte{1}}
+	del := BatchOp{Type: BatchOpDelete, Key: []byte("key")}
+	require.Equal(t, []BatchOp{
+		merge,
+		{Type: BatchOpMerge, Key: []byte("b/counter"), Value: counterValue(2)},
+		set,
+		{Type: BatchOpSet, Key: []byte("key"), Value: []byte{2}},
+		{Type: BatchOpSet, Key: []byte("b/key"), Value: []byte{1}},
+		del,
+		{Type: BatchOpSet, Key: []byte("b/ingested"), Value: []byte{3}},
+	}, pre)
+	require.Equal(t, []BatchOp{merge, set, del}, post)
+
+	values, err := hdb.MultiGet([][]byte{[]byte("counter"), []byte("key"), []byte("b/counter")})
+	require.NoError(t, err)
+	require.Equal(t, [][]byte{counterValue(2), nil, nil}, values)
+	itr, err := hdb.IteratorWithOptions(nil, nil, IteratorOptions{KeyOnly: true})
+	require.NoError(t, err)
+	// Values are not loaded, and collected as empty.
+	require.Equal(t, [][2][]byte{{[]byte("counter"), {}}}, collectFuzzPairs(t, itr))
+}
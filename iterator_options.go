@@ -0,0 +1,120 @@
+package db
+
+import "bytes"
+
+// IteratorOptions configures an iterator created with IteratorWithOptions. The zero value gives
+// the same iterator as DB.Iterator.
+type IteratorOptions struct {
+	// Reverse iterates in descending order, like DB.ReverseIterator.
+	Reverse bool
+
+	// KeyOnly is for scans which only need keys, e.g. existence checks or index scans. Value
+	// always returns nil, and values are never copied. None of the backends can read keys without
+	// their values, so the values are still read from disk, as part of the blocks holding their
+	// keys.
+	KeyOnly bool
+
+	// Unsafe returns borrowed keys and values, only valid until the next call to Next or Close,
+	// like UnsafeReader.IteratorUnsafe.
+	Unsafe bool
+
+	// PrefixSameAsStart only iterates over keys which have start as prefix, as if end was the
+	// first key after them. It has no effect with a nil start. The backends are given this
+	// tighter bound, which e.g. lets RocksDB stop reading earlier.
+	PrefixSameAsStart bool
+
+	// DontFillCache does not add the blocks read by the iterator to the block cache, for bulk
+	// scans such as exports which would otherwise evict the working set. Only a hint, used by
+	// goleveldb and RocksDB. It is a no-op on pebble, whose iterators have no such option.
+	DontFillCache bool
+
+	// ReadaheadSize sets the size of the reads ahead of the iterator, in bytes, for scans of
+	// large ranges. Zero uses the backend default. Only a hint, used by RocksDB. It is a no-op on
+	// goleveldb, and on pebble, which adapts its readahead to the reads of the iterator by itself.
+	ReadaheadSize int
+}
+
+// iteratorEnd returns the end of the domain to iterate over, taking PrefixSameAsStart into
+// account.
+func (opts IteratorOptions) iteratorEnd(start, end []byte) []byte {
+	if !opts.PrefixSameAsStart || len(start) == 0 {
+		return end
+	}
+	prefixEnd := cpIncr(start)
+	if prefixEnd == nil || (end != nil && bytes.Compare(end, prefixEnd) < 0) {
+		return end
+	}
+	return prefixEnd
+}
+
+// IterableWithOptions is implemented by databases which can create iterators configured with
+// IteratorOptions.
+type IterableWithOptions interface {
+	// IteratorWithOptions returns an iterator over a domain of keys, like DB.Iterator, configured
+	// with opts.
+	// CONTRACT: start, end readonly []byte
+	IteratorWithOptions(start, end []byte, opts IteratorOptions) (Iterator, error)
+}
+
+// IteratorWithOptions returns an iterator over db configured with opts. If db does not implement
+// IterableWithOptions, it falls back to a regular iterator, with the same behavior but without
+// the performance benefits of the options.
+func IteratorWithOptions(db DB, start, end []byte, opts IteratorOptions) (Iterator, error) {
+	if iterable, ok := db.(IterableWithOptions); ok {
+		return iterable.IteratorWithOptions(start, end, opts)
+	}
+	end = opts.iteratorEnd(start, end)
+
+	var (
+		itr Iterator
+		err error
+	)
+	switch {
+	case opts.Reverse && opts.Unsafe:
+		itr, err = ReverseIteratorUnsafe(db, start, end)
+	case opts.Reverse:
+		itr, err = db.ReverseIterator(start, end)
+	case opts.Unsafe:
+		itr, err = IteratorUnsafe(db, start, end)
+	default:
+		itr, err = db.Iterator(start, end)
+	}
+	if err != nil {
+		return nil, err
+	}
+	if opts.KeyOnly {
+		if _, ok := itr.(BidirectionalIterator); ok {
+			return bidirectionalKeyOnlyIterator{keyOnlyIterator{itr}}, nil
+		}
+		return keyOnlyIterator{itr}, nil
+	}
+	return itr, nil
+}
+
+// keyOnlyIterator hides the values of an iterator.
+type keyOnlyIterator struct {
+	Iterator
+}
+
+var _ Iterator = keyOnlyIterator{}
+
+// Value implements Iterator.
+func (itr keyOnlyIterator) Value() []byte {
+	if !itr.Valid() {
+		panic("iterator is invalid")
+	}
+	return nil
+}
+
+// bidirectionalKeyOnlyIterator is a keyOnlyIterator over a BidirectionalIterator, which can also
+// move backwards.
+type bidirectionalKeyOnlyIterator struct {
+	keyOnlyIterator
+}
+
+var _ BidirectionalIterator = bidirectionalKeyOnlyIterator{}
+
+// Prev implements BidirectionalIterator.
+func (itr bidirectionalKeyOnlyIterator) Prev() {
+	itr.Iterator.(BidirectionalIterator).Prev()
+}
@@ -0,0 +1,112 @@
+package db
+
+import (
+	"io"
+	"os"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestIteratorWithOptions(t *testing.T) {
+	for backend := range backends {
+		backend := backend
+		t.Run(string(backend), func(t *testing.T) {
+			db, dir := newTempDB(t, backend)
+			defer os.RemoveAll(dir)
+			defer db.Close()
+			_, ok := db.(IterableWithOptions)
+			require.True(t, ok)
+			testIteratorWithOptions(t, db)
+		})
+	}
+}
+
+func TestIteratorWithOptionsFallback(t *testing.T) {
+	testIteratorWithOptions(t, NewTraceDB(NewMemDB(), io.Discard, TraceOptions{}))
+}
+
+func testIteratorWithOptions(t *testing.T, db DB) {
+	t.Helper()
+
+	require.NoError(t, db.Set([]byte("a"), []byte{1}))
+	require.NoError(t, db.Set([]byte("b"), []byte{2}))
+	require.NoError(t, db.Set([]byte("c"), []byte{3}))
+	require.NoError(t, db.Set([]byte("ab"), []byte{4}))
+	require.NoError(t, db.Set([]byte("abc"), []byte{5}))
+
+	testCases := map[string]struct {
+		start, end []byte
+		opts       IteratorOptions
+		expect     []string
+	}{
+		"default":          {[]byte("b"), nil, IteratorOptions{}, []string{"b=\x02", "c=\x03"}},
+		"reverse":          {[]byte("ab"), []byte("c"), IteratorOptions{Reverse: true}, []string{"b=\x02", "abc=\x05", "ab=\x04"}},
+		"key only":         {[]byte("b"), nil, IteratorOptions{KeyOnly: true}, []string{"b=", "c="}},
+		"key only reverse": {[]byte("abc"), nil, IteratorOptions{KeyOnly: true, Reverse: true}, []string{"c=", "b=", "abc="}},
+		"unsafe":           {[]byte("abc"), []byte("c"), IteratorOptions{Unsafe: true}, []string{"abc=\x05", "b=\x02"}},
+		"unsafe key only":  {[]byte("b"), nil, IteratorOptions{Unsafe: true, KeyOnly: true}, []string{"b=", "c="}},
+		"no fill cache": {
+			nil, nil, IteratorOptions{DontFillCache: true, ReadaheadSize: 1 << 20},
+			[]string{"a=\x01", "ab=\x04", "abc=\x05", "b=\x02", "c=\x03"},
+		},
+		"prefix same as start": {
+			[]byte("ab"), nil, IteratorOptions{PrefixSameAsStart: true},
+			[]string{"ab=\x04", "abc=\x05"},
+		},
+		"prefix same as start reverse": {
+			[]byte("a"), []byte("b\x00"), IteratorOptions{PrefixSameAsStart: true, Reverse: true, DontFillCache: true},
+			[]string{"abc=\x05", "ab=\x04", "a=\x01"},
+		},
+		"prefix same as start with end": {
+			[]byte("a"), []byte("abc"), IteratorOptions{PrefixSameAsStart: true},
+			[]string{"a=\x01", "ab=\x04"},
+		},
+	}
+	for name, tc := range testCases {
+		itr, err := IteratorWithOptions(db, tc.start, tc.end, tc.opts)
+		require.NoError(t, err, name)
+		start, end := itr.Domain()
+		require.Equal(t, tc.start, start, name)
+		require.Equal(t, tc.opts.iteratorEnd(tc.start, tc.end), end, name)
+		if tc.opts.KeyOnly {
+			require.True(t, itr.Valid())
+			require.Nil(t, itr.Value(), name)
+		}
+		require.Equal(t, tc.expect, collectUnsafe(t, itr), name)
+		require.Panics(t, func() { itr.Value() }, name)
+	}
+
+	_, err := IteratorWithOptions(db, []byte{}, nil, IteratorOptions{KeyOnly: true})
+	require.Equal(t, errKeyEmpty, err)
+}
+
+func TestIteratorWithOptionsFallbackPrev(t *testing.T) {
+	// Hide IterableWithOptions, to use the fallback.
+	db := struct{ DB }{NewMemDB()}
+	require.NoError(t, db.Set([]byte("a"), []byte{1}))
+	require.NoError(t, db.Set([]byte("b"), []byte{2}))
+
+	itr, err := IteratorWithOptions(db, nil, nil, IteratorOptions{KeyOnly: true})
+	require.NoError(t, err)
+	defer itr.Close()
+	bitr, ok := itr.(BidirectionalIterator)
+	require.True(t, ok)
+	bitr.Next()
+	require.Equal(t, []byte("b"), bitr.Key())
+	bitr.Prev()
+	require.Equal(t, []byte("a"), bitr.Key())
+	require.Nil(t, bitr.Value())
+}
+
+func TestIteratorOptionsIteratorEnd(t *testing.T) {
+	opts := IteratorOptions{PrefixSameAsStart: true}
+	require.Nil(t, opts.iteratorEnd(nil, nil))
+	require.Equal(t, []byte("b"), opts.iteratorEnd(nil, []byte("b")))
+	require.Equal(t, []byte("ac"), opts.iteratorEnd([]byte("ab"), nil))
+	require.Equal(t, []byte("ac"), opts.iteratorEnd([]byte("ab"), []byte("b")))
+	require.Equal(t, []byte("abc"), opts.iteratorEnd([]byte("ab"), []byte("abc")))
+	require.Equal(t, []byte{0x02, 0x00}, opts.iteratorEnd([]byte{0x01, 0xff}, nil))
+	require.Nil(t, opts.iteratorEnd([]byte{0xff, 0xff}, nil))
+	require.Equal(t, []byte("b"), IteratorOptions{}.iteratorEnd([]byte("ab"), []byte("b")))
+}
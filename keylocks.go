@@ -0,0 +1,145 @@
+package db
+
+import (
+	"sync"
+	"sync/atomic"
+)
+
+// keyLockStripes is the number of locks keys are hashed to by keyLocks.
+const keyLockStripes = 64
+
+// keyLocks is a set of striped read-write locks on keys, so that writes only wait for the
+// operations on the keys they touch, or on keys hashed to the same stripes. Plain writes take the
+// locks of their keys for reading, and read-modify-write operations, such as emulated conditional
+// writes and merges, take them for writing. Stripes are always locked in order, so that locking
+// several of them cannot deadlock.
+//
+// Striping is only enabled by the first read-modify-write operation, so that databases without
+// any don't pay for collecting the keys of every batch. Until then, writes only take mtx for
+// reading, and enabling striping takes it for writing, to wait for the writes in progress.
+type keyLocks struct {
+	mtx     sync.RWMutex
+	striped uint32 // whether striping is enabled, accessed atomically
+	stripes [keyLockStripes]sync.RWMutex
+}
+
+// Modes in which keyStripes lock a stripe.
+const (
+	stripeUnlocked uint8 = iota
+	stripeRead
+	stripeWrite
+)
+
+// keyStripes is a set of stripes of keyLocks to lock, along with the mode to lock them in.
+type keyStripes [keyLockStripes]uint8
+
+// keyStripe returns the stripe of a key, hashing it with FNV-1a.
+func keyStripe(key []byte) int {
+	h := uint32(2166136261)
+	for _, c := range key {
+		h ^= uint32(c)
+		h *= 16777619
+	}
+	return int(h % keyLockStripes)
+}
+
+// read adds the stripe of a key to lock for reading, unless it is locked for writing.
+func (s *keyStripes) read(key []byte) {
+	if i := keyStripe(key); s[i] == stripeUnlocked {
+		s[i] = stripeRead
+	}
+}
+
+// write adds the stripe of a key to lock for writing.
+func (s *keyStripes) write(key []byte) {
+	s[keyStripe(key)] = stripeWrite
+}
+
+// enable enables striping, if it is not yet.
+func (l *keyLocks) enable() {
+	if atomic.LoadUint32(&l.striped) == 1 {
+		return
+	}
+	l.mtx.Lock()
+	atomic.StoreUint32(&l.striped, 1)
+	l.mtx.Unlock()
+}
+
+// rlock locks the stripes of the given keys for reading, and returns a function unlocking them.
+func (l *keyLocks) rlock(keys ...[]byte) (unlock func()) {
+	unlock, _ = l.lockCollected(func(stripes *keyStripes) error {
+		for _, key := range keys {
+			stripes.read(key)
+		}
+		return nil
+	})
+	return unlock
+}
+
+// lock enables striping, locks the stripes of the given keys for writing, and returns a function
+// unlocking them.
+func (l *keyLocks) lock(keys ...[]byte) (unlock func()) {
+	l.enable()
+	unlock, _ = l.lockCollected(func(stripes *keyStripes) error {
+		for _, key := range keys {
+			stripes.write(key)
+		}
+		return nil
+	})
+	return unlock
+}
+
+// rlockAll locks all stripes for reading, e.g. for writes whose keys are unknown, and returns a
+// function unlocking them.
+func (l *keyLocks) rlockAll() (unlock func()) {
+	unlock, _ = l.lockCollected(func(stripes *keyStripes) error {
+		for i := range stripes {
+			stripes[i] = stripeRead
+		}
+		return nil
+	})
+	return unlock
+}
+
+// lockCollected locks the stripes added by collect, e.g. from the keys of a batch, and returns a
+// function unlocking them. collect is only called once striping is enabled. Locking stripes for
+// writing needs enable to be called first.
+func (l *keyLocks) lockCollected(collect func(*keyStripes) error) (unlock func(), err error) {
+	l.mtx.RLock()
+	if atomic.LoadUint32(&l.striped) == 0 {
+		return l.mtx.RUnlock, nil
+	}
+	var stripes keyStripes
+	if err := collect(&stripes); err != nil {
+		l.mtx.RUnlock()
+		return nil, err
+	}
+	unlockStripes := l.lockStripes(&stripes)
+	return func() {
+		unlockStripes()
+		l.mtx.RUnlock()
+	}, nil
+}
+
+// lockStripes locks a set of stripes, and returns a function unlocking them.
+func (l *keyLocks) lockStripes(stripes *keyStripes) (unlock func()) {
+	locked := *stripes
+	for i, mode := range locked {
+		switch mode {
+		case stripeRead:
+			l.stripes[i].RLock()
+		case stripeWrite:
+			l.stripes[i].Lock()
+		}
+	}
+	return func() {
+		for i, mode := range locked {
+			switch mode {
+			case stripeRead:
+				l.stripes[i].RUnlock()
+			case stripeWrite:
+				l.stripes[i].Unlock()
+			}
+		}
+	}
+}
@@ -0,0 +1,59 @@
+package db
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestKeyLocks(t *testing.T) {
+	var locks keyLocks
+	a, b := []byte("a"), []byte("b")
+	require.NotEqual(t, keyStripe(a), keyStripe(b))
+
+	// The keys of writes are only collected once a key is locked for writing.
+	collected := false
+	collect := func(stripes *keyStripes) error {
+		collected = true
+		stripes.read(a)
+		return nil
+	}
+	unlockCollected, err := locks.lockCollected(collect)
+	require.NoError(t, err)
+	unlockCollected()
+	require.False(t, collected)
+
+	// Writes to other keys don't wait for a locked key.
+	unlock := locks.lock(a)
+	locks.rlock(b)()
+
+	// Writes to the locked key do, until it is unlocked.
+	locked := make(chan struct{})
+	go func() {
+		unlockRead := locks.rlock(b, a)
+		close(locked)
+		unlockRead()
+	}()
+	select {
+	case <-locked:
+		t.Fatal("read lock acquired while locked for writing")
+	case <-time.After(10 * time.Millisecond):
+	}
+	unlock()
+	<-locked
+	unlockCollected, err = locks.lockCollected(collect)
+	require.NoError(t, err)
+	unlockCollected()
+	require.True(t, collected)
+
+	// A key locked for writing in a set is not downgraded by locking it for reading too.
+	var stripes keyStripes
+	stripes.write(a)
+	stripes.read(a)
+	stripes.read(b)
+	require.Equal(t, stripeWrite, stripes[keyStripe(a)])
+	require.Equal(t, stripeRead, stripes[keyStripe(b)])
+	locks.lockStripes(&stripes)()
+	locks.rlockAll()()
+}
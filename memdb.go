@@ -3,6 +3,7 @@ package db
 import (
 	"bytes"
 	"fmt"
+	"io"
 	"sync"
 
 	"github.com/google/btree"
@@ -15,7 +16,7 @@ const (
 
 func init() {
 	registerDBCreator(MemDBBackend, func(name, dir string, opts Options) (DB, error) {
-		return NewMemDB(), nil
+		return NewMemDBWithMergeOperator(mergeOperatorFromOptions(opts)), nil
 	}, false)
 }
 
@@ -49,11 +50,21 @@ func newPair(key, value []byte) item {
 // already specify that keys and values should be considered read-only, but this is especially
 // important with MemDB.
 type MemDB struct {
-	mtx   sync.RWMutex
-	btree *btree.BTree
+	mtx     sync.RWMutex
+	btree   *btree.BTree
+	mergeOp MergeOperator
 }
 
-var _ DB = (*MemDB)(nil)
+var (
+	_ DB                  = (*MemDB)(nil)
+	_ Merger              = (*MemDB)(nil)
+	_ ConditionalWriter   = (*MemDB)(nil)
+	_ MultiGetter         = (*MemDB)(nil)
+	_ UnsafeReader        = (*MemDB)(nil)
+	_ IterableWithOptions = (*MemDB)(nil)
+	_ SizeEstimator       = (*MemDB)(nil)
+	_ RangeSplitter       = (*MemDB)(nil)
+)
 
 // NewMemDB creates a new in-memory database.
 func NewMemDB() *MemDB {
@@ -63,6 +74,14 @@ func NewMemDB() *MemDB {
 	return database
 }
 
+// NewMemDBWithMergeOperator creates a new in-memory database supporting merges with the given
+// merge operator.
+func NewMemDBWithMergeOperator(mergeOp MergeOperator) *MemDB {
+	database := NewMemDB()
+	database.mergeOp = mergeOp
+	return database
+}
+
 // Get implements DB.
 func (db *MemDB) Get(key []byte) ([]byte, error) {
 	if len(key) == 0 {
@@ -71,11 +90,40 @@ func (db *MemDB) Get(key []byte) ([]byte, error) {
 	db.mtx.RLock()
 	defer db.mtx.RUnlock()
 
+	return db.get(key), nil
+}
+
+// GetUnsafe implements UnsafeReader. MemDB never copies values, so this is the same as Get.
+func (db *MemDB) GetUnsafe(key []byte) ([]byte, io.Closer, error) {
+	value, err := db.Get(key)
+	if err != nil {
+		return nil, nil, err
+	}
+	return value, nopCloser{}, nil
+}
+
+// MultiGet implements MultiGetter.
+func (db *MemDB) MultiGet(keys [][]byte) ([][]byte, error) {
+	if err := checkKeys(keys); err != nil {
+		return nil, err
+	}
+	db.mtx.RLock()
+	defer db.mtx.RUnlock()
+
+	values := make([][]byte, len(keys))
+	for i, key := range keys {
+		values[i] = db.get(key)
+	}
+	return values, nil
+}
+
+// get gets a value without locking the mutex.
+func (db *MemDB) get(key []byte) []byte {
 	i := db.btree.Get(newKey(key))
 	if i != nil {
-		return i.(item).value, nil
+		return i.(item).value
 	}
-	return nil, nil
+	return nil
 }
 
 // Has implements DB.
@@ -136,6 +184,113 @@ func (db *MemDB) DeleteSync(key []byte) error {
 	return db.Delete(key)
 }
 
+// Merge implements Merger.
+func (db *MemDB) Merge(key, operand []byte) error {
+	if len(key) == 0 {
+		return errKeyEmpty
+	}
+	if operand == nil {
+		return errValueNil
+	}
+	if db.mergeOp == nil {
+		return errMergeOperatorMissing
+	}
+	db.mtx.Lock()
+	defer db.mtx.Unlock()
+
+	value, err := db.mergeOp.Merge(key, db.get(key), operand)
+	if err != nil {
+		return err
+	}
+	if value == nil {
+		value = []byte{}
+	}
+	db.set(key, value)
+	return nil
+}
+
+// CompareAndSwap implements ConditionalWriter.
+func (db *MemDB) CompareAndSwap(key, oldValue, newValue []byte) (bool, error) {
+	db.mtx.Lock()
+	defer db.mtx.Unlock()
+
+	return compareAndSwap(key, oldValue, newValue,
+		func(key []byte) ([]byte, error) { return db.get(key), nil },
+		func(key, value []byte) error { db.set(key, value); return nil },
+		func(key []byte) error { db.delete(key); return nil },
+	)
+}
+
+// SetIfAbsent implements ConditionalWriter.
+func (db *MemDB) SetIfAbsent(key, value []byte) (bool, error) {
+	if value == nil {
+		return false, errValueNil
+	}
+	return db.CompareAndSwap(key, nil, value)
+}
+
+// EstimateSize implements SizeEstimator. MemDB has no metadata to estimate from, but computes
+// the exact size of the keys and values instead.
+func (db *MemDB) EstimateSize(start, end []byte) (uint64, error) {
+	if (start != nil && len(start) == 0) || (end != nil && len(end) == 0) {
+		return 0, errKeyEmpty
+	}
+	db.mtx.RLock()
+	defer db.mtx.RUnlock()
+
+	var size uint64
+	db.ascendRange(start, end, func(i item) {
+		size += uint64(len(i.key) + len(i.value))
+	})
+	return size, nil
+}
+
+// EstimateKeyCount implements SizeEstimator, counting the keys exactly.
+func (db *MemDB) EstimateKeyCount(start, end []byte) (uint64, error) {
+	if (start != nil && len(start) == 0) || (end != nil && len(end) == 0) {
+		return 0, errKeyEmpty
+	}
+	db.mtx.RLock()
+	defer db.mtx.RUnlock()
+
+	if start == nil && end == nil {
+		return uint64(db.btree.Len()), nil
+	}
+	var count uint64
+	db.ascendRange(start, end, func(item) {
+		count++
+	})
+	return count, nil
+}
+
+// SplitRange implements RangeSplitter, splitting the range into subranges with the same number of
+// keys.
+func (db *MemDB) SplitRange(start, end []byte, n int) ([]KeyRange, error) {
+	if err := checkSplitRange(start, end, n); err != nil {
+		return nil, err
+	}
+	return splitRangeByKeys(db, start, end, n)
+}
+
+// ascendRange calls fn for the items in [start, end) in ascending order, without locking the
+// mutex. A nil start or end is unbounded.
+func (db *MemDB) ascendRange(start, end []byte, fn func(item)) {
+	visitor := func(i btree.Item) bool {
+		fn(i.(item))
+		return true
+	}
+	switch {
+	case start == nil && end == nil:
+		db.btree.Ascend(visitor)
+	case start == nil:
+		db.btree.AscendLessThan(newKey(end), visitor)
+	case end == nil:
+		db.btree.AscendGreaterOrEqual(newKey(start), visitor)
+	default:
+		db.btree.AscendRange(newKey(start), newKey(end), visitor)
+	}
+}
+
 // Close implements DB.
 func (db *MemDB) Close() error {
 	// Close is a noop since for an in-memory database, we don't have a destination to flush
@@ -197,6 +352,31 @@ func (db *MemDB) ReverseIterator(start, end []byte) (Iterator, error) {
 	return newMemDBIterator(db, start, end, true), nil
 }
 
+// IteratorUnsafe implements UnsafeReader. MemDB iterators never copy keys and values, so this is
+// the same as Iterator.
+func (db *MemDB) IteratorUnsafe(start, end []byte) (Iterator, error) {
+	return db.Iterator(start, end)
+}
+
+// ReverseIteratorUnsafe implements UnsafeReader. MemDB iterators never copy keys and values, so
+// this is the same as ReverseIterator.
+func (db *MemDB) ReverseIteratorUnsafe(start, end []byte) (Iterator, error) {
+	return db.ReverseIterator(start, end)
+}
+
+// IteratorWithOptions implements IterableWithOptions. MemDB iterators never copy keys and
+// values nor use a cache, so the only options with an effect are the ones changing the domain
+// and order of iteration.
+func (db *MemDB) IteratorWithOptions(start, end []byte, opts IteratorOptions) (Iterator, error) {
+	if (start != nil && len(start) == 0) || (end != nil && len(end) == 0) {
+		return nil, errKeyEmpty
+	}
+	end = opts.iteratorEnd(start, end)
+	itr := newMemDBIterator(db, start, end, opts.Reverse)
+	itr.keyOnly = opts.KeyOnly
+	return itr, nil
+}
+
 // IteratorNoMtx makes an iterator with no mutex.
 func (db *MemDB) IteratorNoMtx(start, end []byte) (Iterator, error) {
 	if (start != nil && len(start) == 0) || (end != nil && len(end) == 0) {
@@ -8,6 +8,7 @@ type opType int
 const (
 	opTypeSet opType = iota + 1
 	opTypeDelete
+	opTypeMerge
 )
 
 type operation struct {
@@ -21,9 +22,17 @@ type memDBBatch struct {
 	db   *MemDB
 	ops  []operation
 	size int
+
+	// spare keeps the operations buffer of a written batch, for reuse after Reset.
+	spare []operation
 }
 
-var _ Batch = (*memDBBatch)(nil)
+var (
+	_ Batch             = (*memDBBatch)(nil)
+	_ Merger            = (*memDBBatch)(nil)
+	_ SerializableBatch = (*memDBBatch)(nil)
+	_ ReusableBatch     = (*memDBBatch)(nil)
+)
 
 // newMemDBBatch creates a new memDBBatch
 func newMemDBBatch(db *MemDB) *memDBBatch {
@@ -63,6 +72,25 @@ func (b *memDBBatch) Delete(key []byte) error {
 	return nil
 }
 
+// Merge implements Merger.
+func (b *memDBBatch) Merge(key, operand []byte) error {
+	if len(key) == 0 {
+		return errKeyEmpty
+	}
+	if operand == nil {
+		return errValueNil
+	}
+	if b.ops == nil {
+		return errBatchClosed
+	}
+	if b.db.mergeOp == nil {
+		return errMergeOperatorMissing
+	}
+	b.size += len(key) + len(operand)
+	b.ops = append(b.ops, operation{opTypeMerge, key, operand})
+	return nil
+}
+
 // Write implements Batch.
 func (b *memDBBatch) Write() error {
 	if b.ops == nil {
@@ -71,7 +99,18 @@ func (b *memDBBatch) Write() error {
 	b.db.mtx.Lock()
 	defer b.db.mtx.Unlock()
 
-	for _, op := range b.ops {
+	ops := b.ops
+	if b.db.mergeOp != nil {
+		var err error
+		ops, err = resolveMerges(b.db.mergeOp, ops, func(key []byte) ([]byte, error) {
+			return b.db.get(key), nil
+		})
+		if err != nil {
+			return err
+		}
+	}
+
+	for _, op := range ops {
 		switch op.opType {
 		case opTypeSet:
 			b.db.set(op.key, op.value)
@@ -82,8 +121,12 @@ func (b *memDBBatch) Write() error {
 		}
 	}
 
-	// Make sure batch cannot be used afterwards. Callers should still call Close(), for errors.
-	return b.Close()
+	// Make sure batch cannot be used afterwards, but keep the buffer for Reset. Callers should
+	// still call Close(), for errors.
+	b.spare = b.ops[:0]
+	b.ops = nil
+	b.size = 0
+	return nil
 }
 
 // WriteSync implements Batch.
@@ -94,6 +137,30 @@ func (b *memDBBatch) WriteSync() error {
 // Close implements Batch.
 func (b *memDBBatch) Close() error {
 	b.ops = nil
+	b.spare = nil
+	b.size = 0
+	return nil
+}
+
+// Count implements ReusableBatch.
+func (b *memDBBatch) Count() (int, error) {
+	if b.ops == nil {
+		return 0, errBatchClosed
+	}
+	return len(b.ops), nil
+}
+
+// Reset implements ReusableBatch.
+func (b *memDBBatch) Reset() error {
+	switch {
+	case b.ops != nil:
+		b.ops = b.ops[:0]
+	case b.spare != nil:
+		b.ops = b.spare
+	default:
+		b.ops = []operation{}
+	}
+	b.spare = nil
 	b.size = 0
 	return nil
 }
@@ -105,3 +172,42 @@ func (b *memDBBatch) GetByteSize() (int, error) {
 	}
 	return b.size, nil
 }
+
+// Data implements SerializableBatch.
+func (b *memDBBatch) Data() ([]byte, error) {
+	if b.ops == nil {
+		return nil, errBatchClosed
+	}
+	return encodeBatchOps(b.ops), nil
+}
+
+// SetData implements SerializableBatch.
+func (b *memDBBatch) SetData(data []byte) error {
+	if b.ops == nil {
+		return errBatchClosed
+	}
+	// The batch keeps the keys and values, which would otherwise point into the caller's data.
+	data = cp(data)
+	batch := newMemDBBatch(b.db)
+	err := ReplayBatchData(data, func(op BatchOp) error {
+		return applyBatchOp(batch, op)
+	})
+	if err != nil {
+		return err
+	}
+	b.ops, b.size = batch.ops, batch.size
+	return nil
+}
+
+// Replay implements SerializableBatch.
+func (b *memDBBatch) Replay(fn func(op BatchOp) error) error {
+	if b.ops == nil {
+		return errBatchClosed
+	}
+	for _, op := range b.ops {
+		if err := fn(op.batchOp()); err != nil {
+			return err
+		}
+	}
+	return nil
+}
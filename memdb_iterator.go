@@ -16,15 +16,19 @@ const (
 
 // memDBIterator is a memDB iterator.
 type memDBIterator struct {
-	ch     <-chan *item
-	cancel context.CancelFunc
-	item   *item
-	start  []byte
-	end    []byte
-	useMtx bool
+	db       *MemDB
+	ch       <-chan *item
+	cancel   context.CancelFunc
+	item     *item
+	start    []byte
+	end      []byte
+	reverse  bool
+	backward bool // the traversal runs against the order of iteration, after Prev
+	keyOnly  bool
+	useMtx   bool
 }
 
-var _ Iterator = (*memDBIterator)(nil)
+var _ BidirectionalIterator = (*memDBIterator)(nil)
 
 // newMemDBIterator creates a new memDBIterator.
 func newMemDBIterator(db *MemDB, start, end []byte, reverse bool) *memDBIterator {
@@ -32,15 +36,26 @@ func newMemDBIterator(db *MemDB, start, end []byte, reverse bool) *memDBIterator
 }
 
 func newMemDBIteratorMtxChoice(db *MemDB, start, end []byte, reverse, useMtx bool) *memDBIterator {
-	ctx, cancel := context.WithCancel(context.Background())
-	ch := make(chan *item, chBufferSize)
 	iter := &memDBIterator{
-		ch:     ch,
-		cancel: cancel,
-		start:  start,
-		end:    end,
-		useMtx: useMtx,
+		db:      db,
+		start:   start,
+		end:     end,
+		reverse: reverse,
+		useMtx:  useMtx,
 	}
+	iter.traverse(start, end, reverse)
+	return iter
+}
+
+// traverse starts a traversal of [start, end) in the given order, and primes the iterator with
+// its first item, if any.
+func (i *memDBIterator) traverse(start, end []byte, reverse bool) {
+	db := i.db
+	useMtx := i.useMtx
+	ctx, cancel := context.WithCancel(context.Background())
+	ch := make(chan *item, chBufferSize)
+	i.ch = ch
+	i.cancel = cancel
 
 	if useMtx {
 		db.mtx.RLock()
@@ -95,11 +110,24 @@ func newMemDBIteratorMtxChoice(db *MemDB, start, end []byte, reverse, useMtx boo
 	}()
 
 	// prime the iterator with the first value, if any
+	i.item = nil
 	if item, ok := <-ch; ok {
-		iter.item = item
+		i.item = item
 	}
+}
 
-	return iter
+// turn stops the current traversal and starts a new one from the current key, exclusive, in the
+// given order.
+func (i *memDBIterator) turn(reverse bool) {
+	key := i.item.key
+	i.cancel()
+	for range i.ch {
+	} // drain channel, releasing the read lock
+	if reverse {
+		i.traverse(i.start, key, true)
+	} else {
+		i.traverse(append(cp(key), 0x00), i.end, false)
+	}
 }
 
 // Close implements Iterator.
@@ -124,6 +152,28 @@ func (i *memDBIterator) Valid() bool {
 // Next implements Iterator.
 func (i *memDBIterator) Next() {
 	i.assertIsValid()
+	if i.backward {
+		i.backward = false
+		i.turn(i.reverse)
+		return
+	}
+	i.step()
+}
+
+// Prev implements BidirectionalIterator. The btree traversal can't change direction, so it is
+// restarted from the current key whenever it does.
+func (i *memDBIterator) Prev() {
+	i.assertIsValid()
+	if !i.backward {
+		i.backward = true
+		i.turn(!i.reverse)
+		return
+	}
+	i.step()
+}
+
+// step moves to the next item of the current traversal.
+func (i *memDBIterator) step() {
 	item, ok := <-i.ch
 	switch {
 	case ok:
@@ -147,6 +197,9 @@ func (i *memDBIterator) Key() []byte {
 // Value implements Iterator.
 func (i *memDBIterator) Value() []byte {
 	i.assertIsValid()
+	if i.keyOnly {
+		return nil
+	}
 	return i.item.value
 }
 
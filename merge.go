@@ -0,0 +1,87 @@
+package db
+
+// MergeOperator combines merge operands into values, for read-modify-write operations such as
+// counters or appending to lists that do not require a Get followed by a Set.
+//
+// A merge operator is configured when opening a database, with the "merge_operator" option of
+// NewDBwithOptions, or e.g. NewMemDBWithMergeOperator. Pebble and RocksDB use it as their native
+// merge operator and apply it lazily, during reads and compactions, while MemDB and GoLevelDB
+// apply it immediately with a read-modify-write under a lock.
+//
+// Since the engines may merge operands with each other before merging them into the existing
+// value, Merge must be associative, i.e. merging a then b into x must give the same result as
+// merging the merge of b into a into x. Additionally, merging an operand into a nil value must
+// return the operand unchanged.
+type MergeOperator interface {
+	// Name identifies the merge operator. Pebble stores it, and refuses to open a database with a
+	// merge operator of a different name.
+	Name() string
+
+	// Merge returns the result of merging operand into existing, which is nil if the key does
+	// not exist. existing may itself be the result of previous merges. Neither existing nor
+	// operand may be modified or retained.
+	Merge(key, existing, operand []byte) ([]byte, error)
+}
+
+// Merger is implemented by databases and batches that support merge operations. The merge is
+// applied with the MergeOperator the database was opened with, or errors if there is none.
+//
+// Since not all backends support merges, callers should check for this interface, e.g.:
+//
+//	merger, ok := db.(Merger)
+//	if !ok {
+//	  ...
+//	}
+//	err := merger.Merge(key, operand)
+type Merger interface {
+	// Merge merges operand into the value of key.
+	// CONTRACT: key, operand readonly []byte
+	Merge(key, operand []byte) error
+}
+
+// mergeOperatorFromOptions returns the "merge_operator" option, or nil if it is not set.
+func mergeOperatorFromOptions(opts Options) MergeOperator {
+	if opts == nil {
+		return nil
+	}
+	op, _ := opts.Get("merge_operator").(MergeOperator)
+	return op
+}
+
+// resolveMerges returns ops with every merge replaced by a set of the merged value, for backends
+// emulating merges. Existing values are read with get, and earlier operations in ops are taken
+// into account. The caller must ensure the database is not written to before the resolved
+// operations are applied.
+func resolveMerges(
+	mergeOp MergeOperator,
+	ops []operation,
+	get func(key []byte) ([]byte, error),
+) ([]operation, error) {
+	resolved := make([]operation, len(ops))
+	pending := make(map[string]*operation) // last operation per key
+	for i, op := range ops {
+		if op.opType == opTypeMerge {
+			var existing []byte
+			if prev, ok := pending[string(op.key)]; ok {
+				existing = prev.value
+			} else {
+				var err error
+				existing, err = get(op.key)
+				if err != nil {
+					return nil, err
+				}
+			}
+			value, err := mergeOp.Merge(op.key, existing, op.value)
+			if err != nil {
+				return nil, err
+			}
+			if value == nil {
+				value = []byte{}
+			}
+			op = operation{opTypeSet, op.key, value}
+		}
+		resolved[i] = op
+		pending[string(op.key)] = &resolved[i]
+	}
+	return resolved, nil
+}
@@ -0,0 +1,226 @@
+package db
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+// mapOptions is an Options backed by a map.
+type mapOptions map[string]interface{}
+
+func (o mapOptions) Get(key string) interface{} {
+	return o[key]
+}
+
+// counterMergeOperator adds uint64 operands, encoded as 8 bytes big endian.
+type counterMergeOperator struct{}
+
+func (counterMergeOperator) Name() string {
+	return "test.counter"
+}
+
+func (counterMergeOperator) Merge(_, existing, operand []byte) ([]byte, error) {
+	if existing == nil {
+		return operand, nil
+	}
+	if len(existing) != 8 || len(operand) != 8 {
+		return nil, errors.New("invalid counter")
+	}
+	return counterValue(binary.BigEndian.Uint64(existing) + binary.BigEndian.Uint64(operand)), nil
+}
+
+func counterValue(n uint64) []byte {
+	bz := make([]byte, 8)
+	binary.BigEndian.PutUint64(bz, n)
+	return bz
+}
+
+// appendMergeOperator appends operands to the existing value.
+type appendMergeOperator struct{}
+
+func (appendMergeOperator) Name() string {
+	return "test.append"
+}
+
+func (appendMergeOperator) Merge(_, existing, operand []byte) ([]byte, error) {
+	return append(cp(existing), operand...), nil
+}
+
+// mergeBackends returns the backends which take a merge operator in their options.
+func mergeBackends() []BackendType {
+	var types []BackendType
+	for backend := range backends {
+		if backend == "prefixdb" {
+			continue
+		}
+		types = append(types, backend)
+	}
+	return types
+}
+
+func newMergeDB(t *testing.T, backend BackendType, mergeOp MergeOperator) DB {
+	t.Helper()
+	db, err := NewDBwithOptions("merge", backend, t.TempDir(), mapOptions{"merge_operator": mergeOp})
+	require.NoError(t, err)
+	t.Cleanup(func() { db.Close() })
+	return db
+}
+
+func TestMerge(t *testing.T) {
+	for _, backend := range mergeBackends() {
+		backend := backend
+		t.Run(string(backend), func(t *testing.T) {
+			db := newMergeDB(t, backend, appendMergeOperator{})
+			merger, ok := db.(Merger)
+			require.True(t, ok)
+
+			require.NoError(t, merger.Merge([]byte("a"), []byte("1")))
+			require.NoError(t, merger.Merge([]byte("a"), []byte("2")))
+			require.NoError(t, db.Set([]byte("b"), []byte("x")))
+			require.NoError(t, merger.Merge([]byte("b"), []byte("3")))
+			require.NoError(t, merger.Merge([]byte("c"), []byte("4")))
+			require.NoError(t, db.Delete([]byte("c")))
+			require.NoError(t, merger.Merge([]byte("c"), []byte("5")))
+
+			batch := db.NewBatch()
+			defer batch.Close()
+			bmerger, ok := batch.(Merger)
+			require.True(t, ok)
+			require.NoError(t, bmerger.Merge([]byte("a"), []byte("6")))
+			require.NoError(t, batch.Set([]byte("d"), []byte("y")))
+			require.NoError(t, bmerger.Merge([]byte("d"), []byte("7")))
+			require.NoError(t, batch.Delete([]byte("b")))
+			require.NoError(t, bmerger.Merge([]byte("b"), []byte("8")))
+			require.NoError(t, bmerger.Merge([]byte("d"), []byte("9")))
+			require.NoError(t, batch.Write())
+			require.Equal(t, errBatchClosed, bmerger.Merge([]byte("a"), []byte("0")))
+
+			checkValue(t, db, []byte("a"), []byte("126"))
+			checkValue(t, db, []byte("b"), []byte("8"))
+			checkValue(t, db, []byte("c"), []byte("5"))
+			checkValue(t, db, []byte("d"), []byte("y79"))
+
+			itr, err := db.Iterator(nil, nil)
+			require.NoError(t, err)
+			defer itr.Close()
+			var values []string
+			for ; itr.Valid(); itr.Next() {
+				values = append(values, fmt.Sprintf("%s=%s", itr.Key(), itr.Value()))
+			}
+			require.NoError(t, itr.Error())
+			require.Equal(t, []string{"a=126", "b=8", "c=5", "d=y79"}, values)
+
+			require.Equal(t, errKeyEmpty, merger.Merge(nil, []byte("1")))
+			require.Equal(t, errValueNil, merger.Merge([]byte("a"), nil))
+		})
+	}
+}
+
+func TestMergeConcurrent(t *testing.T) {
+	for _, backend := range mergeBackends() {
+		backend := backend
+		t.Run(string(backend), func(t *testing.T) {
+			db := newMergeDB(t, backend, counterMergeOperator{})
+			merger := db.(Merger)
+
+			var wg sync.WaitGroup
+			for i := 0; i < 8; i++ {
+				wg.Add(1)
+				go func() {
+					defer wg.Done()
+					for j := 0; j < 100; j++ {
+						if j%10 == 0 {
+							batch := db.NewBatch()
+							require.NoError(t, batch.(Merger).Merge([]byte("counter"), counterValue(1)))
+							require.NoError(t, batch.Write())
+							require.NoError(t, batch.Close())
+							continue
+						}
+						require.NoError(t, merger.Merge([]byte("counter"), counterValue(1)))
+					}
+				}()
+			}
+			wg.Wait()
+
+			checkValue(t, db, []byte("counter"), counterValue(800))
+		})
+	}
+}
+
+func TestMergeWithoutOperator(t *testing.T) {
+	for _, backend := range mergeBackends() {
+		backend := backend
+		t.Run(string(backend), func(t *testing.T) {
+			db, err := NewDB("merge", backend, t.TempDir())
+			require.NoError(t, err)
+			defer db.Close()
+
+			merger, ok := db.(Merger)
+			require.True(t, ok)
+			require.Equal(t, errMergeOperatorMissing, merger.Merge([]byte("a"), []byte{1}))
+
+			batch := db.NewBatch()
+			defer batch.Close()
+			require.Equal(t, errMergeOperatorMissing, batch.(Merger).Merge([]byte("a"), []byte{1}))
+		})
+	}
+}
+
+func TestMergeOperatorError(t *testing.T) {
+	for _, backend := range []BackendType{MemDBBackend, GoLevelDBBackend} {
+		backend := backend
+		t.Run(string(backend), func(t *testing.T) {
+			db := newMergeDB(t, backend, counterMergeOperator{})
+			require.NoError(t, db.Set([]byte("a"), []byte("invalid")))
+			require.Error(t, db.(Merger).Merge([]byte("a"), counterValue(1)))
+
+			// A failed merge must not write any of the batch.
+			batch := db.NewBatch()
+			defer batch.Close()
+			require.NoError(t, batch.Set([]byte("b"), []byte{1}))
+			require.NoError(t, batch.(Merger).Merge([]byte("a"), counterValue(1)))
+			require.Error(t, batch.Write())
+			checkValue(t, db, []byte("a"), []byte("invalid"))
+			checkValue(t, db, []byte("b"), nil)
+		})
+	}
+}
+
+func TestPebbleDBMergeCompaction(t *testing.T) {
+	db := newMergeDB(t, PebbleDBBackend, counterMergeOperator{})
+	pdb := db.(*PebbleDB).DB()
+	merger := db.(Merger)
+
+	for i := 0; i < 10; i++ {
+		require.NoError(t, merger.Merge([]byte("counter"), counterValue(1)))
+		if i%3 == 0 {
+			require.NoError(t, pdb.Flush())
+		}
+	}
+	require.NoError(t, pdb.Compact([]byte("a"), []byte("z"), true))
+	require.NoError(t, merger.Merge([]byte("counter"), counterValue(5)))
+
+	checkValue(t, db, []byte("counter"), counterValue(15))
+}
+
+func TestPrefixDBMerge(t *testing.T) {
+	mdb := NewMemDBWithMergeOperator(appendMergeOperator{})
+	pdb := NewPrefixDB(mdb, []byte("p/"))
+
+	require.NoError(t, pdb.Merge([]byte("a"), []byte("1")))
+	batch := pdb.NewBatch()
+	defer batch.Close()
+	require.NoError(t, batch.(Merger).Merge([]byte("a"), []byte("2")))
+	require.NoError(t, batch.Write())
+
+	checkValue(t, pdb, []byte("a"), []byte("12"))
+	checkValue(t, mdb, []byte("p/a"), []byte("12"))
+
+	pdb = NewPrefixDB(NewMemDB(), []byte("p/"))
+	require.Equal(t, errMergeOperatorMissing, pdb.Merge([]byte("a"), []byte("1")))
+}
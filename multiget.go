@@ -0,0 +1,39 @@
+package db
+
+// MultiGetter is implemented by databases which can fetch many keys at once more efficiently than
+// with separate calls to Get, e.g. with a single lock acquisition or read state. All values are
+// read from the same consistent view of the database.
+type MultiGetter interface {
+	// MultiGet fetches the values of the given keys, in the same order, with nil for keys which
+	// do not exist.
+	// CONTRACT: keys, values readonly []byte
+	MultiGet(keys [][]byte) ([][]byte, error)
+}
+
+// MultiGet fetches the values of the given keys from db, in the same order, with nil for keys
+// which do not exist. It uses MultiGetter if db implements it, and falls back to calling Get for
+// each key otherwise, in which case the values may not come from a consistent view.
+func MultiGet(db DB, keys [][]byte) ([][]byte, error) {
+	if getter, ok := db.(MultiGetter); ok {
+		return getter.MultiGet(keys)
+	}
+	values := make([][]byte, len(keys))
+	for i, key := range keys {
+		value, err := db.Get(key)
+		if err != nil {
+			return nil, err
+		}
+		values[i] = value
+	}
+	return values, nil
+}
+
+// checkKeys returns errKeyEmpty if any of the keys is empty.
+func checkKeys(keys [][]byte) error {
+	for _, key := range keys {
+		if len(key) == 0 {
+			return errKeyEmpty
+		}
+	}
+	return nil
+}
@@ -0,0 +1,61 @@
+package db
+
+import (
+	"io"
+	"os"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestMultiGet(t *testing.T) {
+	for backend := range backends {
+		backend := backend
+		t.Run(string(backend), func(t *testing.T) {
+			db, dir := newTempDB(t, backend)
+			defer os.RemoveAll(dir)
+			defer db.Close()
+			getter, ok := db.(MultiGetter)
+			require.True(t, ok)
+
+			require.NoError(t, db.Set([]byte("a"), []byte{1}))
+			require.NoError(t, db.Set([]byte("b"), []byte{}))
+			require.NoError(t, db.Set([]byte("c"), []byte{3}))
+
+			values, err := getter.MultiGet([][]byte{[]byte("c"), []byte("x"), []byte("a"), []byte("b"), []byte("a")})
+			require.NoError(t, err)
+			require.Equal(t, [][]byte{{3}, nil, {1}, {}, {1}}, values)
+
+			values, err = getter.MultiGet(nil)
+			require.NoError(t, err)
+			require.Empty(t, values)
+
+			_, err = getter.MultiGet([][]byte{[]byte("a"), {}})
+			require.Equal(t, errKeyEmpty, err)
+		})
+	}
+}
+
+func TestMultiGetFallback(t *testing.T) {
+	mdb := NewMemDB()
+	require.NoError(t, mdb.Set([]byte("a"), []byte{1}))
+	tdb := NewTraceDB(mdb, io.Discard, TraceOptions{})
+
+	values, err := MultiGet(tdb, [][]byte{[]byte("a"), []byte("b")})
+	require.NoError(t, err)
+	require.Equal(t, [][]byte{{1}, nil}, values)
+
+	_, err = MultiGet(tdb, [][]byte{nil})
+	require.Equal(t, errKeyEmpty, err)
+}
+
+func TestPrefixDBMultiGet(t *testing.T) {
+	mdb := NewMemDB()
+	require.NoError(t, mdb.Set([]byte("a"), []byte{1}))
+	require.NoError(t, mdb.Set([]byte("p/a"), []byte{2}))
+	pdb := NewPrefixDB(mdb, []byte("p/"))
+
+	values, err := pdb.MultiGet([][]byte{[]byte("a"), []byte("b")})
+	require.NoError(t, err)
+	require.Equal(t, [][]byte{{2}, nil}, values)
+}
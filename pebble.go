@@ -2,11 +2,15 @@ package db
 
 import (
 	"bytes"
+	"encoding/binary"
 	"errors"
 	"fmt"
+	"io"
 	"path/filepath"
+	"sync"
 
 	"github.com/cockroachdb/pebble"
+	"github.com/cockroachdb/pebble/vfs"
 	"github.com/spf13/cast"
 )
 
@@ -64,6 +68,15 @@ var (
 
 func init() {
 	registerDBCreator(PebbleDBBackend, NewPebbleDB, false)
+	registerDBCreator(PebbleDBMemBackend, func(name, dir string, opts Options) (DB, error) {
+		do := pebbleOptions(opts)
+		do.FS = vfs.NewMem()
+		db, err := newPebbleDBWithOpts(name, "", do)
+		if err != nil {
+			return nil, err
+		}
+		return db, nil
+	}, false)
 
 	if ForceSync == "1" {
 		isForceSync = true
@@ -72,12 +85,40 @@ func init() {
 
 // PebbleDB is a PebbleDB backend.
 type PebbleDB struct {
-	db *pebble.DB
+	db       *pebble.DB
+	fs       vfs.FS // the file system of db, where SST files to ingest are written and read
+	canMerge bool
+	// forceSync syncs the writes which are not synced otherwise, set from ForceSync when opening.
+	forceSync bool
+
+	// pebble has no conditional writes, so these are emulated with a read-modify-write under the
+	// write lock of their key, while other writes take the read locks of their keys.
+	locks keyLocks
 }
 
-var _ DB = (*PebbleDB)(nil)
+var (
+	_ DB                  = (*PebbleDB)(nil)
+	_ Merger              = (*PebbleDB)(nil)
+	_ ConditionalWriter   = (*PebbleDB)(nil)
+	_ MultiGetter         = (*PebbleDB)(nil)
+	_ UnsafeReader        = (*PebbleDB)(nil)
+	_ IterableWithOptions = (*PebbleDB)(nil)
+	_ SizeEstimator       = (*PebbleDB)(nil)
+	_ RangeSplitter       = (*PebbleDB)(nil)
+	_ Ingester            = (*PebbleDB)(nil)
+	_ AsyncWriter         = (*PebbleDB)(nil)
+)
 
 func NewPebbleDB(name, dir string, opts Options) (DB, error) {
+	db, err := newPebbleDBWithOpts(name, dir, pebbleOptions(opts))
+	if err != nil {
+		return nil, err
+	}
+	return db, nil
+}
+
+// pebbleOptions returns the default pebble options, adjusted by opts.
+func pebbleOptions(opts Options) *pebble.Options {
 	do := &pebble.Options{
 		Logger: &fatalLogger{}, // pebble info logs are messing up the logs
 		// (not a cosmossdk.io/log logger)
@@ -91,16 +132,90 @@ func NewPebbleDB(name, dir string, opts Options) (DB, error) {
 		if files > 0 {
 			do.MaxOpenFiles = files
 		}
+		if mergeOp := mergeOperatorFromOptions(opts); mergeOp != nil {
+			do.Merger = newPebbleMerger(mergeOp)
+		}
+	}
+
+	return do
+}
+
+// newPebbleMerger wraps a MergeOperator as a pebble merger.
+func newPebbleMerger(mergeOp MergeOperator) *pebble.Merger {
+	return &pebble.Merger{
+		Name: mergeOp.Name(),
+		Merge: func(key, value []byte) (pebble.ValueMerger, error) {
+			return &pebbleValueMerger{mergeOp: mergeOp, key: cp(key), value: cp(value)}, nil
+		},
 	}
+}
+
+// pebbleValueMerger accumulates the operands of a key. Pebble does not retain the operands past
+// each call, so the accumulated value is always copied.
+type pebbleValueMerger struct {
+	mergeOp MergeOperator
+	key     []byte
+	value   []byte
+}
+
+var _ pebble.ValueMerger = (*pebbleValueMerger)(nil)
 
+// MergeNewer implements pebble.ValueMerger.
+func (m *pebbleValueMerger) MergeNewer(value []byte) error {
+	merged, err := m.mergeOp.Merge(m.key, m.value, value)
+	if err != nil {
+		return err
+	}
+	m.value = cp(merged)
+	return nil
+}
+
+// MergeOlder implements pebble.ValueMerger.
+func (m *pebbleValueMerger) MergeOlder(value []byte) error {
+	merged, err := m.mergeOp.Merge(m.key, value, m.value)
+	if err != nil {
+		return err
+	}
+	m.value = cp(merged)
+	return nil
+}
+
+// Finish implements pebble.ValueMerger.
+func (m *pebbleValueMerger) Finish(_ bool) ([]byte, io.Closer, error) {
+	if m.value == nil {
+		return []byte{}, nil, nil
+	}
+	return m.value, nil, nil
+}
+
+// newPebbleDBWithOpts opens a PebbleDB with the given options, used as is. This allows e.g.
+// opening the database on a custom vfs.FS.
+func newPebbleDBWithOpts(name, dir string, o *pebble.Options) (*PebbleDB, error) {
 	dbPath := filepath.Join(dir, name+DBFileSuffix)
-	p, err := pebble.Open(dbPath, do)
+	p, err := pebble.Open(dbPath, o)
 	if err != nil {
 		return nil, err
 	}
+	fs := vfs.Default
+	if o != nil && o.FS != nil {
+		fs = o.FS
+	}
 	return &PebbleDB{
 		db: p,
-	}, err
+		fs: fs,
+		// Merges with pebble's default merger, which concatenates values, are not supported, to
+		// behave the same as the other backends.
+		canMerge:  o != nil && o.Merger != nil && o.Merger.Name != pebble.DefaultMerger.Name,
+		forceSync: isForceSync,
+	}, nil
+}
+
+// writeOptions returns the options of writes which are not synced, unless forced to.
+func (db *PebbleDB) writeOptions() *pebble.WriteOptions {
+	if db.forceSync {
+		return pebble.Sync
+	}
+	return pebble.NoSync
 }
 
 // Get implements DB.
@@ -121,6 +236,45 @@ func (db *PebbleDB) Get(key []byte) ([]byte, error) {
 	return cp(res), nil
 }
 
+// GetUnsafe implements UnsafeReader.
+func (db *PebbleDB) GetUnsafe(key []byte) ([]byte, io.Closer, error) {
+	if len(key) == 0 {
+		return nil, nil, errKeyEmpty
+	}
+
+	res, closer, err := db.db.Get(key)
+	if err != nil {
+		if errors.Is(err, pebble.ErrNotFound) {
+			return nil, nopCloser{}, nil
+		}
+		return nil, nil, err
+	}
+	return res, closer, nil
+}
+
+// MultiGet implements MultiGetter, reading all keys from a single snapshot.
+func (db *PebbleDB) MultiGet(keys [][]byte) ([][]byte, error) {
+	if err := checkKeys(keys); err != nil {
+		return nil, err
+	}
+	snapshot := db.db.NewSnapshot()
+	defer snapshot.Close()
+
+	values := make([][]byte, len(keys))
+	for i, key := range keys {
+		res, closer, err := snapshot.Get(key)
+		if err != nil {
+			if errors.Is(err, pebble.ErrNotFound) {
+				continue
+			}
+			return nil, err
+		}
+		values[i] = cp(res)
+		closer.Close()
+	}
+	return values, nil
+}
+
 // Has implements DB.
 func (db *PebbleDB) Has(key []byte) (bool, error) {
 	// fmt.Println("PebbleDB.Has")
@@ -144,11 +298,10 @@ func (db *PebbleDB) Set(key, value []byte) error {
 		return errValueNil
 	}
 
-	wopts := pebble.NoSync
-	if isForceSync {
-		wopts = pebble.Sync
-	}
+	wopts := db.writeOptions()
 
+	unlock := db.locks.rlock(key)
+	defer unlock()
 	err := db.db.Set(key, value, wopts)
 	if err != nil {
 		return err
@@ -165,6 +318,8 @@ func (db *PebbleDB) SetSync(key, value []byte) error {
 	if value == nil {
 		return errValueNil
 	}
+	unlock := db.locks.rlock(key)
+	defer unlock()
 	err := db.db.Set(key, value, pebble.Sync)
 	if err != nil {
 		return err
@@ -179,10 +334,9 @@ func (db *PebbleDB) Delete(key []byte) error {
 		return errKeyEmpty
 	}
 
-	wopts := pebble.NoSync
-	if isForceSync {
-		wopts = pebble.Sync
-	}
+	wopts := db.writeOptions()
+	unlock := db.locks.rlock(key)
+	defer unlock()
 	return db.db.Delete(key, wopts)
 }
 
@@ -192,9 +346,197 @@ func (db *PebbleDB) DeleteSync(key []byte) error {
 	if len(key) == 0 {
 		return errKeyEmpty
 	}
+	unlock := db.locks.rlock(key)
+	defer unlock()
 	return db.db.Delete(key, pebble.Sync)
 }
 
+// SetAsync implements AsyncWriter.
+func (db *PebbleDB) SetAsync(key, value []byte) (WriteHandle, error) {
+	if len(key) == 0 {
+		return nil, errKeyEmpty
+	}
+	if value == nil {
+		return nil, errValueNil
+	}
+	batch := db.db.NewBatch()
+	if err := batch.Set(key, value, nil); err != nil {
+		batch.Close()
+		return nil, err
+	}
+	handle, err := db.applyAsync(batch)
+	if err != nil {
+		batch.Close()
+		return nil, err
+	}
+	return handle, nil
+}
+
+// DeleteAsync implements AsyncWriter.
+func (db *PebbleDB) DeleteAsync(key []byte) (WriteHandle, error) {
+	if len(key) == 0 {
+		return nil, errKeyEmpty
+	}
+	batch := db.db.NewBatch()
+	if err := batch.Delete(key, nil); err != nil {
+		batch.Close()
+		return nil, err
+	}
+	handle, err := db.applyAsync(batch)
+	if err != nil {
+		batch.Close()
+		return nil, err
+	}
+	return handle, nil
+}
+
+// applyAsync applies a batch without waiting for the WAL to be synced. On success, the returned
+// handle owns the batch, and closes it once synced.
+func (db *PebbleDB) applyAsync(batch *pebble.Batch) (WriteHandle, error) {
+	unlock, err := db.lockBatch(batch)
+	if err != nil {
+		return nil, err
+	}
+	defer unlock()
+	if err := db.db.ApplyNoSyncWait(batch, pebble.Sync); err != nil {
+		return nil, err
+	}
+	return &pebbleWriteHandle{batch: batch}, nil
+}
+
+// lockBatch locks the keys of a batch for reading, and returns a function unlocking them.
+func (db *PebbleDB) lockBatch(batch *pebble.Batch) (unlock func(), err error) {
+	return db.locks.lockCollected(func(stripes *keyStripes) error {
+		reader := batch.Reader()
+		for {
+			_, key, _, ok, err := reader.Next()
+			if err != nil {
+				return err
+			}
+			if !ok {
+				return nil
+			}
+			stripes.read(key)
+		}
+	})
+}
+
+// pebbleWriteHandle waits for a batch applied with ApplyNoSyncWait to be synced.
+type pebbleWriteHandle struct {
+	once  sync.Once
+	batch *pebble.Batch
+	err   error
+}
+
+var _ WriteHandle = (*pebbleWriteHandle)(nil)
+
+// Wait implements WriteHandle.
+func (h *pebbleWriteHandle) Wait() error {
+	h.once.Do(func() {
+		h.err = h.batch.SyncWait()
+		if err := h.batch.Close(); h.err == nil {
+			h.err = err
+		}
+		h.batch = nil
+	})
+	return h.err
+}
+
+// CompareAndSwap implements ConditionalWriter.
+func (db *PebbleDB) CompareAndSwap(key, oldValue, newValue []byte) (bool, error) {
+	unlock := db.locks.lock(key)
+	defer unlock()
+
+	wopts := db.writeOptions()
+	return compareAndSwap(key, oldValue, newValue, db.Get,
+		func(key, value []byte) error { return db.db.Set(key, value, wopts) },
+		func(key []byte) error { return db.db.Delete(key, wopts) },
+	)
+}
+
+// SetIfAbsent implements ConditionalWriter.
+func (db *PebbleDB) SetIfAbsent(key, value []byte) (bool, error) {
+	if value == nil {
+		return false, errValueNil
+	}
+	return db.CompareAndSwap(key, nil, value)
+}
+
+// Merge implements Merger.
+func (db *PebbleDB) Merge(key, operand []byte) error {
+	if len(key) == 0 {
+		return errKeyEmpty
+	}
+	if operand == nil {
+		return errValueNil
+	}
+	if !db.canMerge {
+		return errMergeOperatorMissing
+	}
+
+	wopts := db.writeOptions()
+	unlock := db.locks.rlock(key)
+	defer unlock()
+	return db.db.Merge(key, operand, wopts)
+}
+
+// EstimateSize implements SizeEstimator, using the on-disk sizes of the tables.
+func (db *PebbleDB) EstimateSize(start, end []byte) (uint64, error) {
+	if (start != nil && len(start) == 0) || (end != nil && len(end) == 0) {
+		return 0, errKeyEmpty
+	}
+	end, err := estimateEnd(db, start, end)
+	if err != nil || end == nil {
+		return 0, err
+	}
+	return db.db.EstimateDiskUsage(start, end)
+}
+
+// EstimateKeyCount implements SizeEstimator, extrapolating from a sample of keys.
+func (db *PebbleDB) EstimateKeyCount(start, end []byte) (uint64, error) {
+	if (start != nil && len(start) == 0) || (end != nil && len(end) == 0) {
+		return 0, errKeyEmpty
+	}
+	return estimateKeyCount(db, start, end, db.EstimateSize)
+}
+
+// SplitRange implements RangeSplitter, from the key ranges and sizes of the tables, or from the
+// estimated sizes of ranges if too few tables overlap the range.
+func (db *PebbleDB) SplitRange(start, end []byte, n int) ([]KeyRange, error) {
+	if err := checkSplitRange(start, end, n); err != nil {
+		return nil, err
+	}
+	levels, err := db.db.SSTables()
+	if err != nil {
+		return nil, err
+	}
+	var tables []tableRange
+	for _, level := range levels {
+		for _, info := range level {
+			tables = append(tables, tableRange{
+				smallest: info.Smallest.UserKey,
+				largest:  info.Largest.UserKey,
+				size:     info.Size,
+			})
+		}
+	}
+	return splitRangeByTables(db, start, end, n, tables)
+}
+
+// NewSSTWriter implements Ingester, writing files in the newest table format of the database, on
+// its file system.
+func (db *PebbleDB) NewSSTWriter(path string) (SSTWriter, error) {
+	return newPebbleSSTWriter(db.fs, path, db.db.FormatMajorVersion().MaxTableFormat())
+}
+
+// Ingest implements Ingester.
+func (db *PebbleDB) Ingest(paths []string) error {
+	// The keys of the files are unknown, so lock all of them.
+	unlock := db.locks.rlockAll()
+	defer unlock()
+	return db.db.Ingest(paths)
+}
+
 func (db *PebbleDB) DB() *pebble.DB {
 	return db.db
 }
@@ -247,28 +589,33 @@ func (db *PebbleDB) NewBatchWithSize(_ int) Batch {
 // Iterator implements DB.
 func (db *PebbleDB) Iterator(start, end []byte) (Iterator, error) {
 	// fmt.Println("PebbleDB.Iterator")
-	if (start != nil && len(start) == 0) || (end != nil && len(end) == 0) {
-		return nil, errKeyEmpty
-	}
-	o := pebble.IterOptions{
-		LowerBound: start,
-		UpperBound: end,
-	}
-	itr, err := db.db.NewIter(&o)
-	if err != nil {
-		return nil, err
-	}
-	itr.First()
-
-	return newPebbleDBIterator(itr, start, end, false), nil
+	return db.IteratorWithOptions(start, end, IteratorOptions{})
 }
 
 // ReverseIterator implements DB.
 func (db *PebbleDB) ReverseIterator(start, end []byte) (Iterator, error) {
 	// fmt.Println("PebbleDB.ReverseIterator")
+	return db.IteratorWithOptions(start, end, IteratorOptions{Reverse: true})
+}
+
+// IteratorUnsafe implements UnsafeReader.
+func (db *PebbleDB) IteratorUnsafe(start, end []byte) (Iterator, error) {
+	return db.IteratorWithOptions(start, end, IteratorOptions{Unsafe: true})
+}
+
+// ReverseIteratorUnsafe implements UnsafeReader.
+func (db *PebbleDB) ReverseIteratorUnsafe(start, end []byte) (Iterator, error) {
+	return db.IteratorWithOptions(start, end, IteratorOptions{Reverse: true, Unsafe: true})
+}
+
+// IteratorWithOptions implements IterableWithOptions. Pebble iterators have no options for the
+// block cache and readahead, which pebble adapts by itself, so DontFillCache and ReadaheadSize are
+// no-ops. KeyOnly only skips copying values, as pebble has no key-only reads.
+func (db *PebbleDB) IteratorWithOptions(start, end []byte, opts IteratorOptions) (Iterator, error) {
 	if (start != nil && len(start) == 0) || (end != nil && len(end) == 0) {
 		return nil, errKeyEmpty
 	}
+	end = opts.iteratorEnd(start, end)
 	o := pebble.IterOptions{
 		LowerBound: start,
 		UpperBound: end,
@@ -277,20 +624,39 @@ func (db *PebbleDB) ReverseIterator(start, end []byte) (Iterator, error) {
 	if err != nil {
 		return nil, err
 	}
-	itr.Last()
-	return newPebbleDBIterator(itr, start, end, true), nil
+	if opts.Reverse {
+		itr.Last()
+	} else {
+		itr.First()
+	}
+
+	pitr := newPebbleDBIterator(itr, start, end, opts.Reverse)
+	pitr.noCopy = opts.Unsafe
+	pitr.keyOnly = opts.KeyOnly
+	return pitr, nil
 }
 
 var _ Batch = (*pebbleDBBatch)(nil)
 
 type pebbleDBBatch struct {
+	db    *PebbleDB
 	batch *pebble.Batch
+
+	// spare keeps the underlying batch of a written batch, for reuse after Reset.
+	spare *pebble.Batch
 }
 
-var _ Batch = (*pebbleDBBatch)(nil)
+var (
+	_ Batch             = (*pebbleDBBatch)(nil)
+	_ Merger            = (*pebbleDBBatch)(nil)
+	_ SerializableBatch = (*pebbleDBBatch)(nil)
+	_ ReusableBatch     = (*pebbleDBBatch)(nil)
+	_ AsyncBatch        = (*pebbleDBBatch)(nil)
+)
 
 func newPebbleDBBatch(db *PebbleDB) *pebbleDBBatch {
 	return &pebbleDBBatch{
+		db:    db,
 		batch: db.db.NewBatch(),
 	}
 }
@@ -320,23 +686,41 @@ func (b *pebbleDBBatch) Delete(key []byte) error {
 	return b.batch.Delete(key, nil)
 }
 
+// Merge implements Merger.
+func (b *pebbleDBBatch) Merge(key, operand []byte) error {
+	if len(key) == 0 {
+		return errKeyEmpty
+	}
+	if operand == nil {
+		return errValueNil
+	}
+	if b.batch == nil {
+		return errBatchClosed
+	}
+	if !b.db.canMerge {
+		return errMergeOperatorMissing
+	}
+	return b.batch.Merge(key, operand, nil)
+}
+
 // Write implements Batch.
 func (b *pebbleDBBatch) Write() error {
 	if b.batch == nil {
 		return errBatchClosed
 	}
 
-	wopts := pebble.NoSync
-	if isForceSync {
-		wopts = pebble.Sync
+	wopts := b.db.writeOptions()
+	unlock, err := b.db.lockBatch(b.batch)
+	if err != nil {
+		return err
 	}
-	err := b.batch.Commit(wopts)
+	defer unlock()
+	err = b.batch.Commit(wopts)
 	if err != nil {
 		return err
 	}
-	// Make sure batch cannot be used afterwards. Callers should still call Close(), for errors.
-
-	return b.Close()
+	b.release()
+	return nil
 }
 
 // WriteSync implements Batch.
@@ -345,12 +729,39 @@ func (b *pebbleDBBatch) WriteSync() error {
 	if b.batch == nil {
 		return errBatchClosed
 	}
-	err := b.batch.Commit(pebble.Sync)
+	unlock, err := b.db.lockBatch(b.batch)
+	if err != nil {
+		return err
+	}
+	defer unlock()
+	err = b.batch.Commit(pebble.Sync)
 	if err != nil {
 		return err
 	}
-	// Make sure batch cannot be used afterwards. Callers should still call Close(), for errors.
-	return b.Close()
+	b.release()
+	return nil
+}
+
+// release makes sure a written batch cannot be used afterwards, but keeps the underlying batch for
+// Reset. Callers should still call Close(), to release it.
+func (b *pebbleDBBatch) release() {
+	b.spare = b.batch
+	b.batch = nil
+}
+
+// WriteAsync implements AsyncBatch.
+func (b *pebbleDBBatch) WriteAsync() (WriteHandle, error) {
+	if b.batch == nil {
+		return nil, errBatchClosed
+	}
+	handle, err := b.db.applyAsync(b.batch)
+	if err != nil {
+		return nil, err
+	}
+	// The handle closes the underlying batch once synced, so just make sure the batch cannot be
+	// used afterwards.
+	b.batch = nil
+	return handle, nil
 }
 
 // Close implements Batch.
@@ -363,6 +774,13 @@ func (b *pebbleDBBatch) Close() error {
 		}
 		b.batch = nil
 	}
+	if b.spare != nil {
+		err := b.spare.Close()
+		if err != nil {
+			return err
+		}
+		b.spare = nil
+	}
 
 	return nil
 }
@@ -375,14 +793,39 @@ func (b *pebbleDBBatch) GetByteSize() (int, error) {
 	return b.batch.Len(), nil
 }
 
+// Count implements ReusableBatch.
+func (b *pebbleDBBatch) Count() (int, error) {
+	if b.batch == nil {
+		return 0, errBatchClosed
+	}
+	return int(b.batch.Count()), nil
+}
+
+// Reset implements ReusableBatch.
+func (b *pebbleDBBatch) Reset() error {
+	switch {
+	case b.batch != nil:
+		b.batch.Reset()
+	case b.spare != nil:
+		b.batch = b.spare
+		b.batch.Reset()
+	default:
+		b.batch = b.db.db.NewBatch()
+	}
+	b.spare = nil
+	return nil
+}
+
 type pebbleDBIterator struct {
 	source     *pebble.Iterator
 	start, end []byte
 	isReverse  bool
 	isInvalid  bool
+	noCopy     bool // return borrowed keys and values, see UnsafeReader
+	keyOnly    bool // never read values, see IteratorOptions
 }
 
-var _ Iterator = (*pebbleDBIterator)(nil)
+var _ BidirectionalIterator = (*pebbleDBIterator)(nil)
 
 func newPebbleDBIterator(source *pebble.Iterator, start, end []byte, isReverse bool) *pebbleDBIterator {
 	if isReverse {
@@ -455,12 +898,21 @@ func (itr *pebbleDBIterator) Valid() bool {
 // Key implements Iterator.
 func (itr *pebbleDBIterator) Key() []byte {
 	itr.assertIsValid()
+	if itr.noCopy {
+		return itr.source.Key()
+	}
 	return cp(itr.source.Key())
 }
 
 // Value implements Iterator.
 func (itr *pebbleDBIterator) Value() []byte {
 	itr.assertIsValid()
+	if itr.keyOnly {
+		return nil
+	}
+	if itr.noCopy {
+		return itr.source.Value()
+	}
 	return cp(itr.source.Value())
 }
 
@@ -474,6 +926,16 @@ func (itr *pebbleDBIterator) Next() {
 	}
 }
 
+// Prev implements BidirectionalIterator.
+func (itr *pebbleDBIterator) Prev() {
+	itr.assertIsValid()
+	if itr.isReverse {
+		itr.source.Next()
+	} else {
+		itr.source.Prev()
+	}
+}
+
 // Error implements Iterator.
 func (itr *pebbleDBIterator) Error() error {
 	return itr.source.Error()
@@ -500,3 +962,50 @@ func (*fatalLogger) Fatalf(format string, args ...interface{}) {
 }
 
 func (*fatalLogger) Infof(_ string, _ ...interface{}) {}
+
+// Data implements SerializableBatch, with the representation of the pebble batch.
+func (b *pebbleDBBatch) Data() ([]byte, error) {
+	if b.batch == nil {
+		return nil, errBatchClosed
+	}
+	return cp(b.batch.Repr()), nil
+}
+
+// SetData implements SerializableBatch, using data as the representation of the pebble batch.
+func (b *pebbleDBBatch) SetData(data []byte) error {
+	if b.batch == nil {
+		return errBatchClosed
+	}
+	err := ReplayBatchData(data, func(op BatchOp) error {
+		if op.Type == BatchOpMerge && !b.db.canMerge {
+			return errMergeOperatorMissing
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	// The pebble batch takes ownership of its representation, which starts with the sequence
+	// number it is committed at.
+	data = cp(data)
+	binary.LittleEndian.PutUint64(data, 0)
+	batch := b.db.db.NewBatch()
+	if err := batch.SetRepr(data); err != nil {
+		batch.Close()
+		return err
+	}
+	if err := b.batch.Close(); err != nil {
+		batch.Close()
+		return err
+	}
+	b.batch = batch
+	return nil
+}
+
+// Replay implements SerializableBatch.
+func (b *pebbleDBBatch) Replay(fn func(op BatchOp) error) error {
+	if b.batch == nil {
+		return errBatchClosed
+	}
+	return ReplayBatchData(b.batch.Repr(), fn)
+}
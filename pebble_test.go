@@ -3,6 +3,7 @@ package db
 import (
 	"fmt"
 	"os"
+	"path/filepath"
 	"testing"
 
 	"github.com/stretchr/testify/require"
@@ -19,6 +20,21 @@ func TestPebbleDBBackend(t *testing.T) {
 	require.True(t, ok)
 }
 
+func TestPebbleDBMemBackend(t *testing.T) {
+	dir := t.TempDir()
+	db, err := NewDB("testdb", PebbleDBMemBackend, dir)
+	require.NoError(t, err)
+	defer db.Close()
+
+	_, ok := db.(*PebbleDB)
+	require.True(t, ok)
+
+	require.NoError(t, db.SetSync([]byte("a"), []byte{1}))
+	entries, err := os.ReadDir(dir)
+	require.NoError(t, err)
+	require.Empty(t, entries)
+}
+
 // func TestPebbleDBStats(t *testing.T) {
 // 	name := fmt.Sprintf("test_%x", randStr(12))
 // 	dir := os.TempDir()
@@ -29,6 +45,60 @@ func TestPebbleDBBackend(t *testing.T) {
 // 	require.NotEmpty(t, db.Stats())
 // }
 
+func TestPebbleDBOpenError(t *testing.T) {
+	// A regular file where the database directory should be makes opening fail.
+	dir := t.TempDir()
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "testdb.db"), nil, 0o600))
+	db, err := NewPebbleDB("testdb", dir, nil)
+	require.Error(t, err)
+	require.True(t, db == nil, "expected a nil DB, got %#v", db)
+}
+
+func TestPebbleDBBatchResetReuses(t *testing.T) {
+	db, dir := newTempDB(t, PebbleDBBackend)
+	defer os.RemoveAll(dir)
+	defer db.Close()
+
+	// Written batches keep their pebble batch, and reuse it once reset.
+	batch := db.NewBatch().(*pebbleDBBatch)
+	defer batch.Close()
+	require.NoError(t, batch.Set([]byte("a"), []byte{1}))
+	require.NoError(t, batch.Write())
+	written := batch.spare
+	require.NotNil(t, written)
+	require.NoError(t, batch.Reset())
+	require.Same(t, written, batch.batch)
+	count, err := batch.Count()
+	require.NoError(t, err)
+	require.Zero(t, count)
+	require.NoError(t, batch.Set([]byte("b"), []byte{2}))
+	require.NoError(t, batch.WriteSync())
+	require.Same(t, written, batch.spare)
+	checkValue(t, db, []byte("a"), []byte{1})
+	checkValue(t, db, []byte("b"), []byte{2})
+}
+
+func TestPebbleDBSplitRangeTables(t *testing.T) {
+	db, dir := newTempDB(t, PebbleDBBackend)
+	defer os.RemoveAll(dir)
+	defer db.Close()
+
+	// Each flush makes a table, after whose last key the range is split.
+	for i := 0; i < 3; i++ {
+		for j := 0; j < 100; j++ {
+			require.NoError(t, db.Set([]byte(fmt.Sprintf("key%d%02d", i, j)), make([]byte, 100)))
+		}
+		require.NoError(t, db.(*PebbleDB).DB().Flush())
+	}
+	ranges, err := SplitRange(db, nil, nil, 3)
+	require.NoError(t, err)
+	require.Equal(t, []KeyRange{
+		{End: []byte("key099\x00")},
+		{Start: []byte("key099\x00"), End: []byte("key199\x00")},
+		{Start: []byte("key199\x00")},
+	}, ranges)
+}
+
 func BenchmarkPebbleDBRandomReadsWrites(b *testing.B) {
 	name := fmt.Sprintf("test_%x", randStr(12))
 	dir := os.TempDir()
@@ -44,4 +114,19 @@ func BenchmarkPebbleDBRandomReadsWrites(b *testing.B) {
 	benchmarkRandomReadsWrites(b, db)
 }
 
+func BenchmarkPebbleDBCASWithSyncWrites(b *testing.B) {
+	name := fmt.Sprintf("test_%x", randStr(12))
+	dir := os.TempDir()
+	db, err := NewDB(name, PebbleDBBackend, dir)
+	if err != nil {
+		b.Fatal(err)
+	}
+	defer func() {
+		require.NoError(b, db.Close())
+		cleanupDBDir(dir, name)
+	}()
+
+	benchmarkCASWithSyncWrites(b, db)
+}
+
 // TODO: Add tests for pebble
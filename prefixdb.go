@@ -2,6 +2,7 @@ package db
 
 import (
 	"fmt"
+	"io"
 	"sync"
 )
 
@@ -12,7 +13,18 @@ type PrefixDB struct {
 	db     DB
 }
 
-var _ DB = (*PrefixDB)(nil)
+var (
+	_ DB                  = (*PrefixDB)(nil)
+	_ Merger              = (*PrefixDB)(nil)
+	_ ConditionalWriter   = (*PrefixDB)(nil)
+	_ MultiGetter         = (*PrefixDB)(nil)
+	_ UnsafeReader        = (*PrefixDB)(nil)
+	_ IterableWithOptions = (*PrefixDB)(nil)
+	_ SizeEstimator       = (*PrefixDB)(nil)
+	_ RangeSplitter       = (*PrefixDB)(nil)
+	_ Ingester            = (*PrefixDB)(nil)
+	_ AsyncWriter         = (*PrefixDB)(nil)
+)
 
 // NewPrefixDB lets you namespace multiple DBs within a single DB.
 func NewPrefixDB(db DB, prefix []byte) *PrefixDB {
@@ -36,6 +48,27 @@ func (pdb *PrefixDB) Get(key []byte) ([]byte, error) {
 	return value, nil
 }
 
+// GetUnsafe implements UnsafeReader, reading without copies if the underlying database supports
+// it.
+func (pdb *PrefixDB) GetUnsafe(key []byte) ([]byte, io.Closer, error) {
+	if len(key) == 0 {
+		return nil, nil, errKeyEmpty
+	}
+	return GetUnsafe(pdb.db, pdb.prefixed(key))
+}
+
+// MultiGet implements MultiGetter, using MultiGet on the underlying database if it supports it.
+func (pdb *PrefixDB) MultiGet(keys [][]byte) ([][]byte, error) {
+	if err := checkKeys(keys); err != nil {
+		return nil, err
+	}
+	pkeys := make([][]byte, len(keys))
+	for i, key := range keys {
+		pkeys[i] = pdb.prefixed(key)
+	}
+	return MultiGet(pdb.db, pkeys)
+}
+
 // Has implements DB.
 func (pdb *PrefixDB) Has(key []byte) (bool, error) {
 	if len(key) == 0 {
@@ -66,6 +99,48 @@ func (pdb *PrefixDB) Set(key, value []byte) error {
 	return nil
 }
 
+// Merge implements Merger, if the underlying database supports merges.
+func (pdb *PrefixDB) Merge(key, operand []byte) error {
+	if len(key) == 0 {
+		return errKeyEmpty
+	}
+	if operand == nil {
+		return errValueNil
+	}
+	merger, ok := pdb.db.(Merger)
+	if !ok {
+		return errMergeOperatorMissing
+	}
+	return merger.Merge(pdb.prefixed(key), operand)
+}
+
+// CompareAndSwap implements ConditionalWriter, if the underlying database supports it.
+func (pdb *PrefixDB) CompareAndSwap(key, oldValue, newValue []byte) (bool, error) {
+	if len(key) == 0 {
+		return false, errKeyEmpty
+	}
+	writer, ok := pdb.db.(ConditionalWriter)
+	if !ok {
+		return false, errConditionalWritesUnsupported
+	}
+	return writer.CompareAndSwap(pdb.prefixed(key), oldValue, newValue)
+}
+
+// SetIfAbsent implements ConditionalWriter, if the underlying database supports it.
+func (pdb *PrefixDB) SetIfAbsent(key, value []byte) (bool, error) {
+	if len(key) == 0 {
+		return false, errKeyEmpty
+	}
+	if value == nil {
+		return false, errValueNil
+	}
+	writer, ok := pdb.db.(ConditionalWriter)
+	if !ok {
+		return false, errConditionalWritesUnsupported
+	}
+	return writer.SetIfAbsent(pdb.prefixed(key), value)
+}
+
 // SetSync implements DB.
 func (pdb *PrefixDB) SetSync(key, value []byte) error {
 	if len(key) == 0 {
@@ -96,46 +171,143 @@ func (pdb *PrefixDB) DeleteSync(key []byte) error {
 	return pdb.db.DeleteSync(pdb.prefixed(key))
 }
 
-// Iterator implements DB.
-func (pdb *PrefixDB) Iterator(start, end []byte) (Iterator, error) {
-	if (start != nil && len(start) == 0) || (end != nil && len(end) == 0) {
+// SetAsync implements AsyncWriter, using SetAsync on the underlying database.
+func (pdb *PrefixDB) SetAsync(key, value []byte) (WriteHandle, error) {
+	if len(key) == 0 {
 		return nil, errKeyEmpty
 	}
+	if value == nil {
+		return nil, errValueNil
+	}
+	return SetAsync(pdb.db, pdb.prefixed(key), value)
+}
 
-	var pStart, pEnd []byte
-	pStart = append(cp(pdb.prefix), start...)
-	if end == nil {
-		pEnd = cpIncr(pdb.prefix)
-	} else {
-		pEnd = append(cp(pdb.prefix), end...)
+// DeleteAsync implements AsyncWriter, using DeleteAsync on the underlying database.
+func (pdb *PrefixDB) DeleteAsync(key []byte) (WriteHandle, error) {
+	if len(key) == 0 {
+		return nil, errKeyEmpty
+	}
+	return DeleteAsync(pdb.db, pdb.prefixed(key))
+}
+
+// Iterator implements DB.
+func (pdb *PrefixDB) Iterator(start, end []byte) (Iterator, error) {
+	return pdb.iterator(start, end, pdb.db.Iterator)
+}
+
+// ReverseIterator implements DB.
+func (pdb *PrefixDB) ReverseIterator(start, end []byte) (Iterator, error) {
+	return pdb.iterator(start, end, pdb.db.ReverseIterator)
+}
+
+// IteratorUnsafe implements UnsafeReader, iterating without copies if the underlying database
+// supports it.
+func (pdb *PrefixDB) IteratorUnsafe(start, end []byte) (Iterator, error) {
+	return pdb.iterator(start, end, func(start, end []byte) (Iterator, error) {
+		return IteratorUnsafe(pdb.db, start, end)
+	})
+}
+
+// ReverseIteratorUnsafe implements UnsafeReader, iterating without copies if the underlying
+// database supports it.
+func (pdb *PrefixDB) ReverseIteratorUnsafe(start, end []byte) (Iterator, error) {
+	return pdb.iterator(start, end, func(start, end []byte) (Iterator, error) {
+		return ReverseIteratorUnsafe(pdb.db, start, end)
+	})
+}
+
+// IteratorWithOptions implements IterableWithOptions, passing the options to the underlying
+// database.
+func (pdb *PrefixDB) IteratorWithOptions(start, end []byte, opts IteratorOptions) (Iterator, error) {
+	end = opts.iteratorEnd(start, end)
+	return pdb.iterator(start, end, func(start, end []byte) (Iterator, error) {
+		return IteratorWithOptions(pdb.db, start, end, opts)
+	})
+}
+
+// iterator creates a prefix iterator over an iterator of the underlying database, created with
+// the given function.
+func (pdb *PrefixDB) iterator(
+	start, end []byte,
+	newSource func(start, end []byte) (Iterator, error),
+) (Iterator, error) {
+	pStart, pEnd, err := pdb.prefixedRange(start, end)
+	if err != nil {
+		return nil, err
 	}
-	itr, err := pdb.db.Iterator(pStart, pEnd)
+	itr, err := newSource(pStart, pEnd)
 	if err != nil {
 		return nil, err
 	}
 
-	return newPrefixIterator(pdb.prefix, start, end, itr)
+	pitr, err := newPrefixIterator(pdb.prefix, start, end, itr)
+	if err != nil {
+		return nil, err
+	}
+	if _, ok := itr.(BidirectionalIterator); ok {
+		return bidirectionalPrefixDBIterator{pitr}, nil
+	}
+	return pitr, nil
 }
 
-// ReverseIterator implements DB.
-func (pdb *PrefixDB) ReverseIterator(start, end []byte) (Iterator, error) {
-	if (start != nil && len(start) == 0) || (end != nil && len(end) == 0) {
-		return nil, errKeyEmpty
+// EstimateSize implements SizeEstimator, using EstimateSize on the underlying database.
+func (pdb *PrefixDB) EstimateSize(start, end []byte) (uint64, error) {
+	pStart, pEnd, err := pdb.prefixedRange(start, end)
+	if err != nil {
+		return 0, err
 	}
+	return EstimateSize(pdb.db, pStart, pEnd)
+}
 
-	var pStart, pEnd []byte
-	pStart = append(cp(pdb.prefix), start...)
-	if end == nil {
-		pEnd = cpIncr(pdb.prefix)
-	} else {
-		pEnd = append(cp(pdb.prefix), end...)
+// EstimateKeyCount implements SizeEstimator, using EstimateKeyCount on the underlying database.
+func (pdb *PrefixDB) EstimateKeyCount(start, end []byte) (uint64, error) {
+	pStart, pEnd, err := pdb.prefixedRange(start, end)
+	if err != nil {
+		return 0, err
 	}
-	ritr, err := pdb.db.ReverseIterator(pStart, pEnd)
+	return EstimateKeyCount(pdb.db, pStart, pEnd)
+}
+
+// SplitRange implements RangeSplitter, using SplitRange on the underlying database.
+func (pdb *PrefixDB) SplitRange(start, end []byte, n int) ([]KeyRange, error) {
+	if err := checkSplitRange(start, end, n); err != nil {
+		return nil, err
+	}
+	pStart, pEnd, err := pdb.prefixedRange(start, end)
 	if err != nil {
 		return nil, err
 	}
+	pRanges, err := SplitRange(pdb.db, pStart, pEnd, n)
+	if err != nil {
+		return nil, err
+	}
+	// The split points are within the prefixed range, so they all have the prefix.
+	ranges := make([]KeyRange, len(pRanges))
+	for i, r := range pRanges {
+		ranges[i] = KeyRange{Start: start, End: end}
+		if i > 0 {
+			ranges[i].Start = r.Start[len(pdb.prefix):]
+		}
+		if i < len(pRanges)-1 {
+			ranges[i].End = r.End[len(pdb.prefix):]
+		}
+	}
+	return ranges, nil
+}
 
-	return newPrefixIterator(pdb.prefix, start, end, ritr)
+// NewSSTWriter implements Ingester, creating a file for the underlying database with prefixed
+// keys.
+func (pdb *PrefixDB) NewSSTWriter(path string) (SSTWriter, error) {
+	writer, err := NewSSTWriter(pdb.db, path)
+	if err != nil {
+		return nil, err
+	}
+	return prefixSSTWriter{prefix: pdb.prefix, writer: writer}, nil
+}
+
+// Ingest implements Ingester, using Ingest on the underlying database.
+func (pdb *PrefixDB) Ingest(paths []string) error {
+	return Ingest(pdb.db, paths)
 }
 
 // NewBatch implements DB.
@@ -148,6 +320,17 @@ func (pdb *PrefixDB) NewBatchWithSize(size int) Batch {
 	return newPrefixBatch(pdb.prefix, pdb.db.NewBatchWithSize(size))
 }
 
+// NewBatchView returns a view of parent, a batch owned by the caller, which adds the prefix to
+// the keys of its operations. Views of one parent batch for several PrefixDBs sharing an
+// underlying database are written atomically when the parent batch is written.
+//
+// The parent must be a batch of the database underlying pdb, or a view of one if it is itself a
+// PrefixDB. Views cannot be written, and closing them has no effect: the caller writes and closes
+// the parent.
+func (pdb *PrefixDB) NewBatchView(parent Batch) Batch {
+	return prefixBatchView{prefix: pdb.prefix, parent: parent}
+}
+
 // Close implements DB.
 func (pdb *PrefixDB) Close() error {
 	pdb.mtx.Lock()
@@ -185,6 +368,43 @@ func (pdb *PrefixDB) Stats() map[string]string {
 	return stats
 }
 
+// prefixedRange returns the range of the underlying database for [start, end).
+func (pdb *PrefixDB) prefixedRange(start, end []byte) ([]byte, []byte, error) {
+	if (start != nil && len(start) == 0) || (end != nil && len(end) == 0) {
+		return nil, nil, errKeyEmpty
+	}
+
+	var pStart, pEnd []byte
+	pStart = append(cp(pdb.prefix), start...)
+	if end == nil {
+		pEnd = cpIncr(pdb.prefix)
+	} else {
+		pEnd = append(cp(pdb.prefix), end...)
+	}
+	return pStart, pEnd, nil
+}
+
 func (pdb *PrefixDB) prefixed(key []byte) []byte {
 	return append(cp(pdb.prefix), key...)
 }
+
+// prefixSSTWriter prefixes the keys written to an SSTWriter.
+type prefixSSTWriter struct {
+	prefix []byte
+	writer SSTWriter
+}
+
+var _ SSTWriter = prefixSSTWriter{}
+
+// Set implements SSTWriter.
+func (w prefixSSTWriter) Set(key, value []byte) error {
+	if len(key) == 0 {
+		return errKeyEmpty
+	}
+	return w.writer.Set(append(cp(w.prefix), key...), value)
+}
+
+// Finish implements SSTWriter.
+func (w prefixSSTWriter) Finish() error {
+	return w.writer.Finish()
+}
@@ -1,11 +1,19 @@
 package db
 
+import "bytes"
+
 type prefixDBBatch struct {
 	prefix []byte
 	source Batch
 }
 
-var _ Batch = (*prefixDBBatch)(nil)
+var (
+	_ Batch             = (*prefixDBBatch)(nil)
+	_ Merger            = (*prefixDBBatch)(nil)
+	_ SerializableBatch = (*prefixDBBatch)(nil)
+	_ ReusableBatch     = (*prefixDBBatch)(nil)
+	_ AsyncBatch        = (*prefixDBBatch)(nil)
+)
 
 func newPrefixBatch(prefix []byte, source Batch) prefixDBBatch {
 	return prefixDBBatch{
@@ -35,6 +43,22 @@ func (pb prefixDBBatch) Delete(key []byte) error {
 	return pb.source.Delete(pkey)
 }
 
+// Merge implements Merger, if the underlying batch supports merges.
+func (pb prefixDBBatch) Merge(key, operand []byte) error {
+	if len(key) == 0 {
+		return errKeyEmpty
+	}
+	if operand == nil {
+		return errValueNil
+	}
+	merger, ok := pb.source.(Merger)
+	if !ok {
+		return errMergeOperatorMissing
+	}
+	pkey := append(cp(pb.prefix), key...)
+	return merger.Merge(pkey, operand)
+}
+
 // Write implements Batch.
 func (pb prefixDBBatch) Write() error {
 	return pb.source.Write()
@@ -57,3 +81,158 @@ func (pb prefixDBBatch) GetByteSize() (int, error) {
 	}
 	return pb.source.GetByteSize()
 }
+
+// Data implements SerializableBatch, if the underlying batch supports it. The data has the keys
+// without the prefix, to be loaded into a batch of the same or another PrefixDB.
+func (pb prefixDBBatch) Data() ([]byte, error) {
+	var ops []operation
+	err := pb.Replay(func(op BatchOp) error {
+		ops = append(ops, newOperation(op))
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return encodeBatchOps(ops), nil
+}
+
+// SetData implements SerializableBatch, if the underlying batch supports it.
+func (pb prefixDBBatch) SetData(data []byte) error {
+	source, ok := pb.source.(SerializableBatch)
+	if !ok {
+		return errBatchSerializationUnsupported
+	}
+	var ops []operation
+	err := ReplayBatchData(data, func(op BatchOp) error {
+		op.Key = append(cp(pb.prefix), op.Key...)
+		ops = append(ops, newOperation(op))
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	return source.SetData(encodeBatchOps(ops))
+}
+
+// Replay implements SerializableBatch, if the underlying batch supports it.
+func (pb prefixDBBatch) Replay(fn func(op BatchOp) error) error {
+	source, ok := pb.source.(SerializableBatch)
+	if !ok {
+		return errBatchSerializationUnsupported
+	}
+	return source.Replay(func(op BatchOp) error {
+		op.Key = op.Key[len(pb.prefix):] // all keys of the batch have the prefix
+		return fn(op)
+	})
+}
+
+// WriteAsync implements AsyncBatch, using WriteAsync on the underlying batch.
+func (pb prefixDBBatch) WriteAsync() (WriteHandle, error) {
+	return WriteAsync(pb.source)
+}
+
+// Count implements ReusableBatch, if the underlying batch supports it.
+func (pb prefixDBBatch) Count() (int, error) {
+	source, ok := pb.source.(ReusableBatch)
+	if !ok {
+		return 0, errBatchReuseUnsupported
+	}
+	return source.Count()
+}
+
+// Reset implements ReusableBatch, if the underlying batch supports it.
+func (pb prefixDBBatch) Reset() error {
+	source, ok := pb.source.(ReusableBatch)
+	if !ok {
+		return errBatchReuseUnsupported
+	}
+	return source.Reset()
+}
+
+// prefixBatchView is a view of a parent batch for a PrefixDB, see PrefixDB.NewBatchView.
+type prefixBatchView struct {
+	prefix []byte
+	parent Batch
+}
+
+var (
+	_ Batch             = prefixBatchView{}
+	_ Merger            = prefixBatchView{}
+	_ SerializableBatch = prefixBatchView{}
+)
+
+// batch returns the view as a prefixDBBatch, to add operations to the parent.
+func (v prefixBatchView) batch() prefixDBBatch {
+	return newPrefixBatch(v.prefix, v.parent)
+}
+
+// Set implements Batch.
+func (v prefixBatchView) Set(key, value []byte) error {
+	return v.batch().Set(key, value)
+}
+
+// Delete implements Batch.
+func (v prefixBatchView) Delete(key []byte) error {
+	return v.batch().Delete(key)
+}
+
+// Merge implements Merger, if the parent batch supports merges.
+func (v prefixBatchView) Merge(key, operand []byte) error {
+	return v.batch().Merge(key, operand)
+}
+
+// Write implements Batch. Views cannot be written.
+func (v prefixBatchView) Write() error {
+	return errBatchViewWrite
+}
+
+// WriteSync implements Batch. Views cannot be written.
+func (v prefixBatchView) WriteSync() error {
+	return errBatchViewWrite
+}
+
+// Close implements Batch. It has no effect, the parent batch is closed by its owner.
+func (v prefixBatchView) Close() error {
+	return nil
+}
+
+// GetByteSize implements Batch, returning the size of the parent batch.
+func (v prefixBatchView) GetByteSize() (int, error) {
+	return v.parent.GetByteSize()
+}
+
+// Data implements SerializableBatch, if the parent batch supports it. The data has the
+// operations of the parent batch with the prefix, without it.
+func (v prefixBatchView) Data() ([]byte, error) {
+	var ops []operation
+	err := v.Replay(func(op BatchOp) error {
+		ops = append(ops, newOperation(op))
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return encodeBatchOps(ops), nil
+}
+
+// SetData implements SerializableBatch. It is not supported, as it would replace the operations
+// of the parent batch.
+func (v prefixBatchView) SetData(data []byte) error {
+	return errBatchSerializationUnsupported
+}
+
+// Replay implements SerializableBatch, if the parent batch supports it. It replays the
+// operations of the parent batch with the prefix, without it.
+func (v prefixBatchView) Replay(fn func(op BatchOp) error) error {
+	parent, ok := v.parent.(SerializableBatch)
+	if !ok {
+		return errBatchSerializationUnsupported
+	}
+	return parent.Replay(func(op BatchOp) error {
+		if len(op.Key) <= len(v.prefix) || !bytes.HasPrefix(op.Key, v.prefix) {
+			return nil
+		}
+		op.Key = op.Key[len(v.prefix):]
+		return fn(op)
+	})
+}
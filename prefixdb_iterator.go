@@ -124,6 +124,28 @@ func (itr *prefixDBIterator) Close() error {
 	return itr.source.Close()
 }
 
+// bidirectionalPrefixDBIterator is a prefixDBIterator over a BidirectionalIterator, which can also
+// move backwards.
+type bidirectionalPrefixDBIterator struct {
+	*prefixDBIterator
+}
+
+var _ BidirectionalIterator = bidirectionalPrefixDBIterator{}
+
+// Prev implements BidirectionalIterator.
+func (itr bidirectionalPrefixDBIterator) Prev() {
+	itr.assertIsValid()
+	itr.source.(BidirectionalIterator).Prev()
+
+	if !itr.source.Valid() || !bytes.HasPrefix(itr.source.Key(), itr.prefix) {
+		itr.valid = false
+	} else if bytes.Equal(itr.source.Key(), itr.prefix) {
+		// Empty keys are not allowed, so if a key exists in the database that exactly matches the
+		// prefix we need to skip it.
+		itr.Prev()
+	}
+}
+
 func (itr *prefixDBIterator) assertIsValid() {
 	if !itr.Valid() {
 		panic("iterator is invalid")
@@ -5,6 +5,7 @@ import (
 	"crypto/rand"
 	"encoding/binary"
 	"fmt"
+	"os"
 	"path/filepath"
 	"sync"
 	"testing"
@@ -229,3 +230,61 @@ func TestPrefixDBReverseIterator7(t *testing.T) {
 	checkInvalid(t, itr)
 	require.NoError(t, itr.Close())
 }
+
+func TestPrefixDBBatchViews(t *testing.T) {
+	for backend := range backends {
+		t.Run(string(backend), func(t *testing.T) {
+			db, dir := newTempDB(t, backend)
+			defer os.RemoveAll(dir)
+			defer db.Close()
+
+			pdbA := NewPrefixDB(db, []byte("a/"))
+			pdbB := NewPrefixDB(db, []byte("b/"))
+			pdbC := NewPrefixDB(pdbA, []byte("c/"))
+			require.NoError(t, pdbB.Set([]byte("deleted"), []byte{1}))
+
+			// Views of a closed parent batch are discarded along with it.
+			parent := db.NewBatch()
+			require.NoError(t, pdbA.NewBatchView(parent).Set([]byte("discarded"), []byte{1}))
+			require.NoError(t, parent.Close())
+			checkValue(t, pdbA, []byte("discarded"), nil)
+
+			parent = db.NewBatch()
+			defer parent.Close()
+			viewA := pdbA.NewBatchView(parent)
+			viewB := pdbB.NewBatchView(parent)
+			viewC := pdbC.NewBatchView(viewA)
+			require.NoError(t, viewA.Set([]byte("key"), []byte{1}))
+			require.NoError(t, viewB.Delete([]byte("deleted")))
+			require.NoError(t, viewC.Set([]byte("key"), []byte{2}))
+			require.NoError(t, parent.Set([]byte("root"), []byte{3}))
+			require.Equal(t, errKeyEmpty, viewA.Set(nil, []byte{1}))
+
+			// Views can't be written, and closing them has no effect.
+			require.Equal(t, errBatchViewWrite, viewA.Write())
+			require.Equal(t, errBatchViewWrite, viewB.WriteSync())
+			require.NoError(t, viewC.Close())
+			checkValue(t, pdbA, []byte("key"), nil)
+			checkValue(t, pdbB, []byte("deleted"), []byte{1})
+
+			// Views replay their own operations, without the prefix.
+			if _, ok := parent.(SerializableBatch); ok {
+				require.Equal(t, []BatchOp{
+					{Type: BatchOpSet, Key: []byte("key"), Value: []byte{1}},
+					{Type: BatchOpSet, Key: []byte("c/key"), Value: []byte{2}},
+				}, replayOps(t, viewA.(SerializableBatch)))
+				require.Equal(t, []BatchOp{
+					{Type: BatchOpDelete, Key: []byte("deleted")},
+				}, replayOps(t, viewB.(SerializableBatch)))
+				require.Equal(t, errBatchSerializationUnsupported, viewA.(SerializableBatch).SetData(nil))
+			}
+
+			require.NoError(t, parent.WriteSync())
+			checkValue(t, pdbA, []byte("key"), []byte{1})
+			checkValue(t, pdbB, []byte("deleted"), nil)
+			checkValue(t, pdbC, []byte("key"), []byte{2})
+			checkValue(t, db, []byte("a/c/key"), []byte{2})
+			checkValue(t, db, []byte("root"), []byte{3})
+		})
+	}
+}
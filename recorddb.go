@@ -0,0 +1,539 @@
+package db
+
+import (
+	"bufio"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"sync"
+	"time"
+)
+
+// recordMagic starts every workload log, and identifies the format version.
+const recordMagic = "CDBWL\x01"
+
+// Workload log operations. Each record is the operation byte, the time since the start of the
+// recording in nanoseconds as a uvarint, and the operation's arguments.
+const (
+	recordOpGet byte = iota + 1
+	recordOpHas
+	recordOpSet
+	recordOpSetSync
+	recordOpDelete
+	recordOpDeleteSync
+	recordOpBatchNew
+	recordOpBatchSet
+	recordOpBatchDelete
+	recordOpBatchWrite
+	recordOpBatchWriteSync
+	recordOpBatchClose
+	recordOpIterator
+	recordOpReverseIterator
+	recordOpIteratorClose
+	recordOpIteratorNext
+	recordOpBatchNewWithSize
+)
+
+// errRecordInvalid is returned when replaying a malformed workload log.
+var errRecordInvalid = errors.New("invalid workload log")
+
+// RecordDB wraps a database and records its workload (reads, writes, batches and iterations,
+// with their timing) to a compact binary log. The log can be replayed later against another
+// database or configuration with Replay, to reproduce and compare performance on real traffic.
+//
+// Values read from the database and failed operations are not recorded. The log is buffered, so
+// callers must call Flush or Close before using it, and should check their returned error for
+// write failures.
+type RecordDB struct {
+	db    DB
+	start time.Time
+
+	mtx     sync.Mutex // guards all fields below
+	w       *bufio.Writer
+	buf     []byte
+	err     error
+	batches uint64
+	iters   uint64
+}
+
+var _ DB = (*RecordDB)(nil)
+
+// NewRecordDB wraps db, recording its workload to w.
+func NewRecordDB(db DB, w io.Writer) *RecordDB {
+	rdb := &RecordDB{
+		db:    db,
+		start: time.Now(),
+		w:     bufio.NewWriter(w),
+	}
+	_, rdb.err = rdb.w.WriteString(recordMagic)
+	return rdb
+}
+
+// record appends a record for op started at the given time, with the given uvarint and byte
+// slice arguments. Failed operations, i.e. with a non-nil opErr, are not recorded.
+func (rdb *RecordDB) record(op byte, at time.Time, opErr error, ids []uint64, args ...[]byte) {
+	if opErr != nil {
+		return
+	}
+	rdb.mtx.Lock()
+	defer rdb.mtx.Unlock()
+	rdb.recordLocked(op, at, ids, args...)
+}
+
+func (rdb *RecordDB) recordLocked(op byte, at time.Time, ids []uint64, args ...[]byte) {
+	if rdb.err != nil {
+		return
+	}
+	buf := append(rdb.buf[:0], op)
+	buf = binary.AppendUvarint(buf, uint64(at.Sub(rdb.start)))
+	for _, id := range ids {
+		buf = binary.AppendUvarint(buf, id)
+	}
+	for _, arg := range args {
+		// Lengths are offset by one, so that nil and empty slices can be told apart.
+		if arg == nil {
+			buf = binary.AppendUvarint(buf, 0)
+			continue
+		}
+		buf = binary.AppendUvarint(buf, uint64(len(arg))+1)
+		buf = append(buf, arg...)
+	}
+	rdb.buf = buf
+	_, rdb.err = rdb.w.Write(buf)
+}
+
+// Flush writes any buffered records to the underlying writer, and returns the first error
+// encountered while recording, if any.
+func (rdb *RecordDB) Flush() error {
+	rdb.mtx.Lock()
+	defer rdb.mtx.Unlock()
+
+	if rdb.err != nil {
+		return rdb.err
+	}
+	rdb.err = rdb.w.Flush()
+	return rdb.err
+}
+
+// Get implements DB.
+func (rdb *RecordDB) Get(key []byte) ([]byte, error) {
+	now := time.Now()
+	value, err := rdb.db.Get(key)
+	rdb.record(recordOpGet, now, err, nil, key)
+	return value, err
+}
+
+// Has implements DB.
+func (rdb *RecordDB) Has(key []byte) (bool, error) {
+	now := time.Now()
+	ok, err := rdb.db.Has(key)
+	rdb.record(recordOpHas, now, err, nil, key)
+	return ok, err
+}
+
+// Set implements DB.
+func (rdb *RecordDB) Set(key, value []byte) error {
+	now := time.Now()
+	err := rdb.db.Set(key, value)
+	rdb.record(recordOpSet, now, err, nil, key, value)
+	return err
+}
+
+// SetSync implements DB.
+func (rdb *RecordDB) SetSync(key, value []byte) error {
+	now := time.Now()
+	err := rdb.db.SetSync(key, value)
+	rdb.record(recordOpSetSync, now, err, nil, key, value)
+	return err
+}
+
+// Delete implements DB.
+func (rdb *RecordDB) Delete(key []byte) error {
+	now := time.Now()
+	err := rdb.db.Delete(key)
+	rdb.record(recordOpDelete, now, err, nil, key)
+	return err
+}
+
+// DeleteSync implements DB.
+func (rdb *RecordDB) DeleteSync(key []byte) error {
+	now := time.Now()
+	err := rdb.db.DeleteSync(key)
+	rdb.record(recordOpDeleteSync, now, err, nil, key)
+	return err
+}
+
+// Iterator implements DB.
+func (rdb *RecordDB) Iterator(start, end []byte) (Iterator, error) {
+	return rdb.recordIterator(recordOpIterator, start, end, rdb.db.Iterator)
+}
+
+// ReverseIterator implements DB.
+func (rdb *RecordDB) ReverseIterator(start, end []byte) (Iterator, error) {
+	return rdb.recordIterator(recordOpReverseIterator, start, end, rdb.db.ReverseIterator)
+}
+
+func (rdb *RecordDB) recordIterator(
+	op byte,
+	start, end []byte,
+	fn func(start, end []byte) (Iterator, error),
+) (Iterator, error) {
+	now := time.Now()
+	itr, err := fn(start, end)
+	if err != nil {
+		return nil, err
+	}
+
+	rdb.mtx.Lock()
+	defer rdb.mtx.Unlock()
+	rdb.iters++
+	rdb.recordLocked(op, now, []uint64{rdb.iters}, start, end)
+	return &recordDBIterator{Iterator: itr, rdb: rdb, id: rdb.iters}, nil
+}
+
+// Close implements DB. It also flushes the log.
+func (rdb *RecordDB) Close() error {
+	if err := rdb.Flush(); err != nil {
+		_ = rdb.db.Close()
+		return err
+	}
+	return rdb.db.Close()
+}
+
+// NewBatch implements DB.
+func (rdb *RecordDB) NewBatch() Batch {
+	return rdb.newRecordBatch(rdb.db.NewBatch(), recordOpBatchNew)
+}
+
+// NewBatchWithSize implements DB.
+func (rdb *RecordDB) NewBatchWithSize(size int) Batch {
+	return rdb.newRecordBatch(rdb.db.NewBatchWithSize(size), recordOpBatchNewWithSize, uint64(size))
+}
+
+func (rdb *RecordDB) newRecordBatch(batch Batch, op byte, args ...uint64) Batch {
+	rdb.mtx.Lock()
+	defer rdb.mtx.Unlock()
+	rdb.batches++
+	rdb.recordLocked(op, time.Now(), append([]uint64{rdb.batches}, args...))
+	return &recordDBBatch{Batch: batch, rdb: rdb, id: rdb.batches}
+}
+
+// Print implements DB.
+func (rdb *RecordDB) Print() error {
+	return rdb.db.Print()
+}
+
+// Stats implements DB.
+func (rdb *RecordDB) Stats() map[string]string {
+	return rdb.db.Stats()
+}
+
+// recordDBBatch records the operations of a batch, tagged with the batch id.
+type recordDBBatch struct {
+	Batch
+	rdb    *RecordDB
+	id     uint64
+	closed bool
+}
+
+var _ Batch = (*recordDBBatch)(nil)
+
+// Set implements Batch.
+func (b *recordDBBatch) Set(key, value []byte) error {
+	now := time.Now()
+	err := b.Batch.Set(key, value)
+	b.rdb.record(recordOpBatchSet, now, err, []uint64{b.id}, key, value)
+	return err
+}
+
+// Delete implements Batch.
+func (b *recordDBBatch) Delete(key []byte) error {
+	now := time.Now()
+	err := b.Batch.Delete(key)
+	b.rdb.record(recordOpBatchDelete, now, err, []uint64{b.id}, key)
+	return err
+}
+
+// Write implements Batch.
+func (b *recordDBBatch) Write() error {
+	now := time.Now()
+	err := b.Batch.Write()
+	b.rdb.record(recordOpBatchWrite, now, err, []uint64{b.id})
+	return err
+}
+
+// WriteSync implements Batch.
+func (b *recordDBBatch) WriteSync() error {
+	now := time.Now()
+	err := b.Batch.WriteSync()
+	b.rdb.record(recordOpBatchWriteSync, now, err, []uint64{b.id})
+	return err
+}
+
+// Close implements Batch. Only the first call is recorded, since Close is idempotent.
+func (b *recordDBBatch) Close() error {
+	now := time.Now()
+	err := b.Batch.Close()
+	if !b.closed {
+		b.rdb.record(recordOpBatchClose, now, err, []uint64{b.id})
+		b.closed = err == nil
+	}
+	return err
+}
+
+// recordDBIterator records the calls to Next on an iterator as they happen, so that replay steps
+// through the same items, interleaved with the other operations as when recording.
+type recordDBIterator struct {
+	Iterator
+	rdb    *RecordDB
+	id     uint64
+	closed bool
+}
+
+var _ Iterator = (*recordDBIterator)(nil)
+
+// Next implements Iterator.
+func (itr *recordDBIterator) Next() {
+	now := time.Now()
+	itr.Iterator.Next()
+	itr.rdb.record(recordOpIteratorNext, now, nil, []uint64{itr.id})
+}
+
+// Close implements Iterator. Only the first call is recorded.
+func (itr *recordDBIterator) Close() error {
+	now := time.Now()
+	err := itr.Iterator.Close()
+	if !itr.closed {
+		itr.rdb.record(recordOpIteratorClose, now, err, []uint64{itr.id})
+		itr.closed = err == nil
+	}
+	return err
+}
+
+// ReplayOptions configures Replay.
+type ReplayOptions struct {
+	// Speed scales the recorded time between operations: 1 replays in real time, 2 replays twice
+	// as fast, and so on. Zero replays as fast as possible.
+	Speed float64
+}
+
+// Replay reads a workload log written by RecordDB from r, and applies it to db. Operations are
+// replayed sequentially in log order, so concurrency of the recorded workload is not reproduced,
+// but timing is preserved or compressed according to opts. Iterators step through the same items
+// as when recording, at the same points of the log, reading every key and value on the way.
+// Replay stops at the first error, either from a malformed log or from db.
+func Replay(r io.Reader, db DB, opts ReplayOptions) error {
+	br := bufio.NewReader(r)
+	magic := make([]byte, len(recordMagic))
+	if _, err := io.ReadFull(br, magic); err != nil || string(magic) != recordMagic {
+		return fmt.Errorf("%w: bad header", errRecordInvalid)
+	}
+
+	rp := &replayer{
+		r:       br,
+		db:      db,
+		batches: make(map[uint64]Batch),
+		iters:   make(map[uint64]Iterator),
+	}
+	defer rp.close()
+
+	start := time.Now()
+	for {
+		op, err := br.ReadByte()
+		if errors.Is(err, io.EOF) {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		at, err := rp.uvarint()
+		if err != nil {
+			return err
+		}
+		if opts.Speed > 0 {
+			target := time.Duration(float64(at) / opts.Speed)
+			if wait := target - time.Since(start); wait > 0 {
+				time.Sleep(wait)
+			}
+		}
+		if err := rp.apply(op); err != nil {
+			return err
+		}
+	}
+}
+
+// replayer holds the state of a Replay: the log reader and the open batches and iterators.
+type replayer struct {
+	r       *bufio.Reader
+	db      DB
+	batches map[uint64]Batch
+	iters   map[uint64]Iterator
+}
+
+func (rp *replayer) uvarint() (uint64, error) {
+	v, err := binary.ReadUvarint(rp.r)
+	if err != nil {
+		return 0, fmt.Errorf("%w: %v", errRecordInvalid, err)
+	}
+	return v, nil
+}
+
+func (rp *replayer) bytes() ([]byte, error) {
+	n, err := rp.uvarint()
+	if err != nil || n == 0 {
+		return nil, err
+	}
+	bz := make([]byte, n-1)
+	if _, err := io.ReadFull(rp.r, bz); err != nil {
+		return nil, fmt.Errorf("%w: %v", errRecordInvalid, err)
+	}
+	return bz, nil
+}
+
+// args reads the id and byte slice arguments of a record, returning the first error.
+func (rp *replayer) args(ids []*uint64, args ...*[]byte) error {
+	var err error
+	for _, id := range ids {
+		if *id, err = rp.uvarint(); err != nil {
+			return err
+		}
+	}
+	for _, arg := range args {
+		if *arg, err = rp.bytes(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (rp *replayer) apply(op byte) error {
+	var (
+		id, size   uint64
+		key, value []byte
+	)
+	switch op {
+	case recordOpGet, recordOpHas, recordOpDelete, recordOpDeleteSync:
+		if err := rp.args(nil, &key); err != nil {
+			return err
+		}
+		switch op {
+		case recordOpGet:
+			_, err := rp.db.Get(key)
+			return err
+		case recordOpHas:
+			_, err := rp.db.Has(key)
+			return err
+		case recordOpDelete:
+			return rp.db.Delete(key)
+		default:
+			return rp.db.DeleteSync(key)
+		}
+
+	case recordOpSet, recordOpSetSync:
+		if err := rp.args(nil, &key, &value); err != nil {
+			return err
+		}
+		if op == recordOpSet {
+			return rp.db.Set(key, value)
+		}
+		return rp.db.SetSync(key, value)
+
+	case recordOpBatchNew:
+		if err := rp.args([]*uint64{&id}); err != nil {
+			return err
+		}
+		rp.batches[id] = rp.db.NewBatch()
+		return nil
+
+	case recordOpBatchNewWithSize:
+		if err := rp.args([]*uint64{&id, &size}); err != nil {
+			return err
+		}
+		rp.batches[id] = rp.db.NewBatchWithSize(int(size))
+		return nil
+
+	case recordOpBatchSet, recordOpBatchDelete, recordOpBatchWrite, recordOpBatchWriteSync, recordOpBatchClose:
+		if err := rp.args([]*uint64{&id}); err != nil {
+			return err
+		}
+		batch, ok := rp.batches[id]
+		if !ok {
+			return fmt.Errorf("%w: unknown batch %d", errRecordInvalid, id)
+		}
+		switch op {
+		case recordOpBatchSet:
+			if err := rp.args(nil, &key, &value); err != nil {
+				return err
+			}
+			return batch.Set(key, value)
+		case recordOpBatchDelete:
+			if err := rp.args(nil, &key); err != nil {
+				return err
+			}
+			return batch.Delete(key)
+		case recordOpBatchWrite:
+			return batch.Write()
+		case recordOpBatchWriteSync:
+			return batch.WriteSync()
+		default:
+			delete(rp.batches, id)
+			return batch.Close()
+		}
+
+	case recordOpIterator, recordOpReverseIterator:
+		var start, end []byte
+		if err := rp.args([]*uint64{&id}, &start, &end); err != nil {
+			return err
+		}
+		var (
+			itr Iterator
+			err error
+		)
+		if op == recordOpIterator {
+			itr, err = rp.db.Iterator(start, end)
+		} else {
+			itr, err = rp.db.ReverseIterator(start, end)
+		}
+		if err != nil {
+			return err
+		}
+		rp.iters[id] = itr
+		return nil
+
+	case recordOpIteratorNext, recordOpIteratorClose:
+		if err := rp.args([]*uint64{&id}); err != nil {
+			return err
+		}
+		itr, ok := rp.iters[id]
+		if !ok {
+			return fmt.Errorf("%w: unknown iterator %d", errRecordInvalid, id)
+		}
+		if op == recordOpIteratorNext {
+			if itr.Valid() {
+				_, _ = itr.Key(), itr.Value()
+				itr.Next()
+			}
+			return nil
+		}
+		delete(rp.iters, id)
+		if err := itr.Error(); err != nil {
+			_ = itr.Close()
+			return err
+		}
+		return itr.Close()
+
+	default:
+		return fmt.Errorf("%w: unknown operation %d", errRecordInvalid, op)
+	}
+}
+
+// close releases any batches and iterators left open by the log.
+func (rp *replayer) close() {
+	for _, itr := range rp.iters {
+		_ = itr.Close()
+	}
+	for _, batch := range rp.batches {
+		_ = batch.Close()
+	}
+}
@@ -0,0 +1,144 @@
+package db
+
+import (
+	"bytes"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestRecordDBReplay(t *testing.T) {
+	var log bytes.Buffer
+	rdb := NewRecordDB(NewMemDB(), &log)
+
+	require.NoError(t, rdb.Set([]byte("a"), []byte{1}))
+	require.NoError(t, rdb.SetSync([]byte("b"), []byte{}))
+	require.NoError(t, rdb.Set([]byte("c"), []byte{3}))
+	require.NoError(t, rdb.Delete([]byte("c")))
+	require.Equal(t, errKeyEmpty, rdb.Set(nil, []byte{1}))
+	_, err := rdb.Get([]byte("a"))
+	require.NoError(t, err)
+
+	batch := rdb.NewBatch()
+	require.NoError(t, batch.Set([]byte("d"), []byte{4}))
+	require.NoError(t, batch.Delete([]byte("a")))
+	require.NoError(t, batch.Write())
+	require.NoError(t, batch.Close())
+	require.NoError(t, batch.Close())
+
+	itr, err := rdb.ReverseIterator(nil, []byte("d"))
+	require.NoError(t, err)
+	itr.Next()
+	require.NoError(t, itr.Close())
+
+	// A batch that is never written has no effect on replay either.
+	batch = rdb.NewBatch()
+	require.NoError(t, batch.Set([]byte("e"), []byte{5}))
+
+	require.NoError(t, rdb.Close())
+
+	target := NewMemDB()
+	require.NoError(t, Replay(bytes.NewReader(log.Bytes()), target, ReplayOptions{}))
+	assertKeyValues(t, target, map[string][]byte{"b": {}, "d": {4}})
+}
+
+func TestRecordDBReplayTiming(t *testing.T) {
+	var log bytes.Buffer
+	rdb := NewRecordDB(NewMemDB(), &log)
+	require.NoError(t, rdb.Set([]byte("a"), []byte{1}))
+	time.Sleep(100 * time.Millisecond)
+	require.NoError(t, rdb.Set([]byte("b"), []byte{2}))
+	require.NoError(t, rdb.Flush())
+
+	start := time.Now()
+	require.NoError(t, Replay(bytes.NewReader(log.Bytes()), NewMemDB(), ReplayOptions{Speed: 1}))
+	require.GreaterOrEqual(t, time.Since(start), 100*time.Millisecond)
+
+	start = time.Now()
+	require.NoError(t, Replay(bytes.NewReader(log.Bytes()), NewMemDB(), ReplayOptions{Speed: 10}))
+	require.Less(t, time.Since(start), 100*time.Millisecond)
+}
+
+func TestRecordDBReplayInvalid(t *testing.T) {
+	err := Replay(bytes.NewReader([]byte("garbage")), NewMemDB(), ReplayOptions{})
+	require.ErrorIs(t, err, errRecordInvalid)
+
+	err = Replay(bytes.NewReader([]byte(recordMagic+"\xff")), NewMemDB(), ReplayOptions{})
+	require.ErrorIs(t, err, errRecordInvalid)
+
+	// A truncated record is invalid too.
+	var log bytes.Buffer
+	rdb := NewRecordDB(NewMemDB(), &log)
+	require.NoError(t, rdb.Set([]byte("key"), []byte("value")))
+	require.NoError(t, rdb.Flush())
+	err = Replay(bytes.NewReader(log.Bytes()[:log.Len()-1]), NewMemDB(), ReplayOptions{})
+	require.ErrorIs(t, err, errRecordInvalid)
+}
+
+// replayEventDB logs the writes, iterator steps and batch sizes of a replay.
+type replayEventDB struct {
+	DB
+	events []string
+}
+
+func (db *replayEventDB) Set(key, value []byte) error {
+	db.events = append(db.events, "set "+string(key))
+	return db.DB.Set(key, value)
+}
+
+func (db *replayEventDB) Iterator(start, end []byte) (Iterator, error) {
+	itr, err := db.DB.Iterator(start, end)
+	if err != nil {
+		return nil, err
+	}
+	return &replayEventIterator{Iterator: itr, db: db}, nil
+}
+
+func (db *replayEventDB) NewBatchWithSize(size int) Batch {
+	db.events = append(db.events, fmt.Sprintf("batch %d", size))
+	return db.DB.NewBatchWithSize(size)
+}
+
+type replayEventIterator struct {
+	Iterator
+	db *replayEventDB
+}
+
+func (itr *replayEventIterator) Next() {
+	itr.db.events = append(itr.db.events, "next "+string(itr.Key()))
+	itr.Iterator.Next()
+}
+
+func TestRecordDBReplayInterleaving(t *testing.T) {
+	// MemDB iterators block writes, so use in-memory pebble databases.
+	var log bytes.Buffer
+	source, err := NewDB("source", PebbleDBMemBackend, "")
+	require.NoError(t, err)
+	rdb := NewRecordDB(source, &log)
+	require.NoError(t, rdb.Set([]byte("a"), []byte{1}))
+	require.NoError(t, rdb.Set([]byte("b"), []byte{2}))
+
+	// Iterator steps are replayed between the writes they were made between.
+	itr, err := rdb.Iterator(nil, nil)
+	require.NoError(t, err)
+	itr.Next()
+	require.NoError(t, rdb.Set([]byte("c"), []byte{3}))
+	itr.Next()
+	require.NoError(t, itr.Close())
+
+	batch := rdb.NewBatchWithSize(64)
+	require.NoError(t, batch.Set([]byte("d"), []byte{4}))
+	require.NoError(t, batch.Write())
+	require.NoError(t, batch.Close())
+	require.NoError(t, rdb.Close())
+
+	targetDB, err := NewDB("target", PebbleDBMemBackend, "")
+	require.NoError(t, err)
+	target := &replayEventDB{DB: targetDB}
+	defer target.Close()
+	require.NoError(t, Replay(bytes.NewReader(log.Bytes()), target, ReplayOptions{}))
+	require.Equal(t, []string{"set a", "set b", "next a", "set c", "next b", "batch 64"}, target.events)
+	checkValue(t, target, []byte("d"), []byte{4})
+}
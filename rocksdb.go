@@ -5,6 +5,7 @@ package db
 
 import (
 	"fmt"
+	"io"
 	"path/filepath"
 	"runtime"
 
@@ -25,9 +26,23 @@ type RocksDB struct {
 	ro     *grocksdb.ReadOptions
 	wo     *grocksdb.WriteOptions
 	woSync *grocksdb.WriteOptions
+
+	// Conditional writes are emulated with a read-modify-write under the write lock of their key,
+	// while other writes take the read locks of their keys.
+	locks keyLocks
 }
 
-var _ DB = (*RocksDB)(nil)
+var (
+	_ DB                  = (*RocksDB)(nil)
+	_ Merger              = (*RocksDB)(nil)
+	_ ConditionalWriter   = (*RocksDB)(nil)
+	_ MultiGetter         = (*RocksDB)(nil)
+	_ UnsafeReader        = (*RocksDB)(nil)
+	_ IterableWithOptions = (*RocksDB)(nil)
+	_ SizeEstimator       = (*RocksDB)(nil)
+	_ RangeSplitter       = (*RocksDB)(nil)
+	_ Ingester            = (*RocksDB)(nil)
+)
 
 // defaultRocksdbOptions, good enough for most cases, including heavy workloads.
 // 1GB table cache, 512MB write buffer (may use 50% more on heavy workloads).
@@ -56,6 +71,9 @@ func NewRocksDB(name, dir string, opts Options) (*RocksDB, error) {
 		if files > 0 {
 			defaultOpts.SetMaxOpenFiles(files)
 		}
+		if mergeOp := mergeOperatorFromOptions(opts); mergeOp != nil {
+			defaultOpts.SetMergeOperator(rocksDBMergeOperator{mergeOp: mergeOp})
+		}
 	}
 
 	return NewRocksDBWithOptions(name, dir, defaultOpts)
@@ -100,6 +118,44 @@ func NewRocksDBWithRaw(
 	}
 }
 
+// rocksDBMergeOperator wraps a MergeOperator as a RocksDB merge operator. Failed merges are
+// reported by RocksDB as corruption errors.
+type rocksDBMergeOperator struct {
+	mergeOp MergeOperator
+}
+
+var (
+	_ grocksdb.MergeOperator = rocksDBMergeOperator{}
+	_ grocksdb.PartialMerger = rocksDBMergeOperator{}
+)
+
+// Name implements grocksdb.MergeOperator.
+func (m rocksDBMergeOperator) Name() string {
+	return m.mergeOp.Name()
+}
+
+// FullMerge implements grocksdb.MergeOperator.
+func (m rocksDBMergeOperator) FullMerge(key, existingValue []byte, operands [][]byte) ([]byte, bool) {
+	value := existingValue
+	for _, operand := range operands {
+		merged, err := m.mergeOp.Merge(key, value, operand)
+		if err != nil {
+			return nil, false
+		}
+		value = merged
+	}
+	return cp(value), true
+}
+
+// PartialMerge implements grocksdb.PartialMerger.
+func (m rocksDBMergeOperator) PartialMerge(key, leftOperand, rightOperand []byte) ([]byte, bool) {
+	merged, err := m.mergeOp.Merge(key, leftOperand, rightOperand)
+	if err != nil {
+		return nil, false
+	}
+	return cp(merged), true
+}
+
 // Get implements DB.
 func (db *RocksDB) Get(key []byte) ([]byte, error) {
 	if len(key) == 0 {
@@ -112,6 +168,53 @@ func (db *RocksDB) Get(key []byte) ([]byte, error) {
 	return moveSliceToBytes(res), nil
 }
 
+// GetUnsafe implements UnsafeReader.
+func (db *RocksDB) GetUnsafe(key []byte) ([]byte, io.Closer, error) {
+	if len(key) == 0 {
+		return nil, nil, errKeyEmpty
+	}
+	res, err := db.db.Get(db.ro, key)
+	if err != nil {
+		return nil, nil, err
+	}
+	if !res.Exists() {
+		res.Free()
+		return nil, nopCloser{}, nil
+	}
+	value := res.Data()
+	if value == nil {
+		value = []byte{}
+	}
+	return value, rocksDBSliceCloser{res}, nil
+}
+
+// rocksDBSliceCloser frees a slice returned by GetUnsafe.
+type rocksDBSliceCloser struct {
+	slice *grocksdb.Slice
+}
+
+// Close implements io.Closer.
+func (c rocksDBSliceCloser) Close() error {
+	c.slice.Free()
+	return nil
+}
+
+// MultiGet implements MultiGetter.
+func (db *RocksDB) MultiGet(keys [][]byte) ([][]byte, error) {
+	if err := checkKeys(keys); err != nil {
+		return nil, err
+	}
+	res, err := db.db.MultiGet(db.ro, keys...)
+	if err != nil {
+		return nil, err
+	}
+	values := make([][]byte, len(res))
+	for i, s := range res {
+		values[i] = moveSliceToBytes(s)
+	}
+	return values, nil
+}
+
 // Has implements DB.
 func (db *RocksDB) Has(key []byte) (bool, error) {
 	bytes, err := db.Get(key)
@@ -129,6 +232,8 @@ func (db *RocksDB) Set(key, value []byte) error {
 	if value == nil {
 		return errValueNil
 	}
+	unlock := db.locks.rlock(key)
+	defer unlock()
 	return db.db.Put(db.wo, key, value)
 }
 
@@ -140,6 +245,8 @@ func (db *RocksDB) SetSync(key, value []byte) error {
 	if value == nil {
 		return errValueNil
 	}
+	unlock := db.locks.rlock(key)
+	defer unlock()
 	return db.db.Put(db.woSync, key, value)
 }
 
@@ -148,6 +255,8 @@ func (db *RocksDB) Delete(key []byte) error {
 	if len(key) == 0 {
 		return errKeyEmpty
 	}
+	unlock := db.locks.rlock(key)
+	defer unlock()
 	return db.db.Delete(db.wo, key)
 }
 
@@ -156,9 +265,112 @@ func (db *RocksDB) DeleteSync(key []byte) error {
 	if len(key) == 0 {
 		return errKeyEmpty
 	}
+	unlock := db.locks.rlock(key)
+	defer unlock()
 	return db.db.Delete(db.woSync, key)
 }
 
+// CompareAndSwap implements ConditionalWriter.
+func (db *RocksDB) CompareAndSwap(key, oldValue, newValue []byte) (bool, error) {
+	unlock := db.locks.lock(key)
+	defer unlock()
+
+	return compareAndSwap(key, oldValue, newValue, db.Get,
+		func(key, value []byte) error { return db.db.Put(db.wo, key, value) },
+		func(key []byte) error { return db.db.Delete(db.wo, key) },
+	)
+}
+
+// SetIfAbsent implements ConditionalWriter.
+func (db *RocksDB) SetIfAbsent(key, value []byte) (bool, error) {
+	if value == nil {
+		return false, errValueNil
+	}
+	return db.CompareAndSwap(key, nil, value)
+}
+
+// Merge implements Merger. RocksDB itself errors if it was opened without a merge operator.
+func (db *RocksDB) Merge(key, operand []byte) error {
+	if len(key) == 0 {
+		return errKeyEmpty
+	}
+	if operand == nil {
+		return errValueNil
+	}
+	unlock := db.locks.rlock(key)
+	defer unlock()
+	return db.db.Merge(db.wo, key, operand)
+}
+
+// EstimateSize implements SizeEstimator, using the approximate on-disk sizes of the files.
+func (db *RocksDB) EstimateSize(start, end []byte) (uint64, error) {
+	if (start != nil && len(start) == 0) || (end != nil && len(end) == 0) {
+		return 0, errKeyEmpty
+	}
+	end, err := estimateEnd(db, start, end)
+	if err != nil || end == nil {
+		return 0, err
+	}
+	sizes, err := db.db.GetApproximateSizes([]grocksdb.Range{{Start: start, Limit: end}})
+	if err != nil {
+		return 0, err
+	}
+	return sizes[0], nil
+}
+
+// EstimateKeyCount implements SizeEstimator, extrapolating from a sample of keys.
+func (db *RocksDB) EstimateKeyCount(start, end []byte) (uint64, error) {
+	if (start != nil && len(start) == 0) || (end != nil && len(end) == 0) {
+		return 0, errKeyEmpty
+	}
+	return estimateKeyCount(db, start, end, db.EstimateSize)
+}
+
+// SplitRange implements RangeSplitter, from the key ranges and sizes of the live files, or from
+// the estimated sizes of ranges if too few files overlap the range.
+func (db *RocksDB) SplitRange(start, end []byte, n int) ([]KeyRange, error) {
+	if err := checkSplitRange(start, end, n); err != nil {
+		return nil, err
+	}
+	files := db.db.GetLiveFilesMetaData()
+	tables := make([]tableRange, 0, len(files))
+	for _, file := range files {
+		tables = append(tables, tableRange{
+			smallest: file.SmallestKey,
+			largest:  file.LargestKey,
+			size:     uint64(file.Size),
+		})
+	}
+	return splitRangeByTables(db, start, end, n, tables)
+}
+
+// NewSSTWriter implements Ingester.
+func (db *RocksDB) NewSSTWriter(path string) (SSTWriter, error) {
+	envOpts := grocksdb.NewDefaultEnvOptions()
+	defer envOpts.Destroy()
+	opts := grocksdb.NewDefaultOptions()
+	defer opts.Destroy()
+
+	writer := grocksdb.NewSSTFileWriter(envOpts, opts)
+	if err := writer.Open(path); err != nil {
+		writer.Destroy()
+		return nil, err
+	}
+	return &rocksDBSSTWriter{writer: writer}, nil
+}
+
+// Ingest implements Ingester, moving the files into the database.
+func (db *RocksDB) Ingest(paths []string) error {
+	opts := grocksdb.NewDefaultIngestExternalFileOptions()
+	defer opts.Destroy()
+	opts.SetMoveFiles(true)
+
+	// The keys of the files are unknown, so lock all of them.
+	unlock := db.locks.rlockAll()
+	defer unlock()
+	return db.db.IngestExternalFile(paths, opts)
+}
+
 func (db *RocksDB) DB() *grocksdb.DB {
 	return db.db
 }
@@ -210,18 +422,78 @@ func (db *RocksDB) NewBatchWithSize(_ int) Batch {
 
 // Iterator implements DB.
 func (db *RocksDB) Iterator(start, end []byte) (Iterator, error) {
-	if (start != nil && len(start) == 0) || (end != nil && len(end) == 0) {
-		return nil, errKeyEmpty
-	}
-	itr := db.db.NewIterator(db.ro)
-	return newRocksDBIterator(itr, start, end, false), nil
+	return db.IteratorWithOptions(start, end, IteratorOptions{})
 }
 
 // ReverseIterator implements DB.
 func (db *RocksDB) ReverseIterator(start, end []byte) (Iterator, error) {
+	return db.IteratorWithOptions(start, end, IteratorOptions{Reverse: true})
+}
+
+// IteratorUnsafe implements UnsafeReader.
+func (db *RocksDB) IteratorUnsafe(start, end []byte) (Iterator, error) {
+	return db.IteratorWithOptions(start, end, IteratorOptions{Unsafe: true})
+}
+
+// ReverseIteratorUnsafe implements UnsafeReader.
+func (db *RocksDB) ReverseIteratorUnsafe(start, end []byte) (Iterator, error) {
+	return db.IteratorWithOptions(start, end, IteratorOptions{Reverse: true, Unsafe: true})
+}
+
+// IteratorWithOptions implements IterableWithOptions. Iterators with DontFillCache or
+// ReadaheadSize use their own read options, with the iterator bounds set, instead of the shared
+// read options of the database. KeyOnly only skips copying values, as RocksDB has no key-only
+// reads.
+func (db *RocksDB) IteratorWithOptions(start, end []byte, opts IteratorOptions) (Iterator, error) {
 	if (start != nil && len(start) == 0) || (end != nil && len(end) == 0) {
 		return nil, errKeyEmpty
 	}
-	itr := db.db.NewIterator(db.ro)
-	return newRocksDBIterator(itr, start, end, true), nil
+	end = opts.iteratorEnd(start, end)
+
+	ro := db.ro
+	var ownRO *grocksdb.ReadOptions
+	if opts.DontFillCache || opts.ReadaheadSize > 0 {
+		ownRO = grocksdb.NewDefaultReadOptions()
+		ownRO.SetFillCache(!opts.DontFillCache)
+		if opts.ReadaheadSize > 0 {
+			ownRO.SetReadaheadSize(uint64(opts.ReadaheadSize))
+		}
+		if start != nil {
+			ownRO.SetIterateLowerBound(start)
+		}
+		if end != nil {
+			ownRO.SetIterateUpperBound(end)
+		}
+		ro = ownRO
+	}
+	itr := db.db.NewIterator(ro)
+	ritr := newRocksDBIterator(itr, start, end, opts.Reverse)
+	ritr.ro = ownRO
+	ritr.noCopy = opts.Unsafe
+	ritr.keyOnly = opts.KeyOnly
+	return ritr, nil
+}
+
+// rocksDBSSTWriter is an SSTWriter for RocksDB.
+type rocksDBSSTWriter struct {
+	writer *grocksdb.SSTFileWriter
+}
+
+var _ SSTWriter = (*rocksDBSSTWriter)(nil)
+
+// Set implements SSTWriter.
+func (w *rocksDBSSTWriter) Set(key, value []byte) error {
+	if len(key) == 0 {
+		return errKeyEmpty
+	}
+	if value == nil {
+		return errValueNil
+	}
+	return w.writer.Put(key, value)
+}
+
+// Finish implements SSTWriter.
+func (w *rocksDBSSTWriter) Finish() error {
+	defer w.writer.Destroy()
+	return w.writer.Finish()
 }
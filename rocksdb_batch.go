@@ -3,14 +3,23 @@
 
 package db
 
-import "github.com/linxGnu/grocksdb"
+import (
+	"encoding/binary"
+
+	"github.com/linxGnu/grocksdb"
+)
 
 type rocksDBBatch struct {
 	db    *RocksDB
 	batch *grocksdb.WriteBatch
 }
 
-var _ Batch = (*rocksDBBatch)(nil)
+var (
+	_ Batch             = (*rocksDBBatch)(nil)
+	_ Merger            = (*rocksDBBatch)(nil)
+	_ SerializableBatch = (*rocksDBBatch)(nil)
+	_ ReusableBatch     = (*rocksDBBatch)(nil)
+)
 
 func newRocksDBBatch(db *RocksDB) *rocksDBBatch {
 	return &rocksDBBatch{
@@ -46,12 +55,32 @@ func (b *rocksDBBatch) Delete(key []byte) error {
 	return nil
 }
 
+// Merge implements Merger.
+func (b *rocksDBBatch) Merge(key, operand []byte) error {
+	if len(key) == 0 {
+		return errKeyEmpty
+	}
+	if operand == nil {
+		return errValueNil
+	}
+	if b.batch == nil {
+		return errBatchClosed
+	}
+	b.batch.Merge(key, operand)
+	return nil
+}
+
 // Write implements Batch.
 func (b *rocksDBBatch) Write() error {
 	if b.batch == nil {
 		return errBatchClosed
 	}
-	err := b.db.db.Write(b.db.wo, b.batch)
+	unlock, err := b.lock()
+	if err != nil {
+		return err
+	}
+	err = b.db.db.Write(b.db.wo, b.batch)
+	unlock()
 	if err != nil {
 		return err
 	}
@@ -65,7 +94,12 @@ func (b *rocksDBBatch) WriteSync() error {
 	if b.batch == nil {
 		return errBatchClosed
 	}
-	err := b.db.db.Write(b.db.woSync, b.batch)
+	unlock, err := b.lock()
+	if err != nil {
+		return err
+	}
+	err = b.db.db.Write(b.db.woSync, b.batch)
+	unlock()
 	if err != nil {
 		return err
 	}
@@ -73,6 +107,16 @@ func (b *rocksDBBatch) WriteSync() error {
 	return b.Close()
 }
 
+// lock locks the keys of the batch for reading, and returns a function unlocking them.
+func (b *rocksDBBatch) lock() (unlock func(), err error) {
+	return b.db.locks.lockCollected(func(stripes *keyStripes) error {
+		return ReplayBatchData(b.batch.Data(), func(op BatchOp) error {
+			stripes.read(op.Key)
+			return nil
+		})
+	})
+}
+
 // Close implements Batch.
 func (b *rocksDBBatch) Close() error {
 	if b.batch != nil {
@@ -89,3 +133,54 @@ func (b *rocksDBBatch) GetByteSize() (int, error) {
 	}
 	return len(b.batch.Data()), nil
 }
+
+// Count implements ReusableBatch.
+func (b *rocksDBBatch) Count() (int, error) {
+	if b.batch == nil {
+		return 0, errBatchClosed
+	}
+	return b.batch.Count(), nil
+}
+
+// Reset implements ReusableBatch. Written batches are destroyed, to not leak them if they are
+// not closed, so they are allocated again.
+func (b *rocksDBBatch) Reset() error {
+	if b.batch == nil {
+		b.batch = grocksdb.NewWriteBatch()
+		return nil
+	}
+	b.batch.Clear()
+	return nil
+}
+
+// Data implements SerializableBatch, with the representation of the RocksDB write batch.
+func (b *rocksDBBatch) Data() ([]byte, error) {
+	if b.batch == nil {
+		return nil, errBatchClosed
+	}
+	return b.batch.Data(), nil
+}
+
+// SetData implements SerializableBatch, using data as the representation of the RocksDB write
+// batch.
+func (b *rocksDBBatch) SetData(data []byte) error {
+	if b.batch == nil {
+		return errBatchClosed
+	}
+	if err := ReplayBatchData(data, func(BatchOp) error { return nil }); err != nil {
+		return err
+	}
+	data = cp(data)
+	binary.LittleEndian.PutUint64(data, 0)
+	b.batch.Destroy()
+	b.batch = grocksdb.WriteBatchFrom(data)
+	return nil
+}
+
+// Replay implements SerializableBatch.
+func (b *rocksDBBatch) Replay(fn func(op BatchOp) error) error {
+	if b.batch == nil {
+		return errBatchClosed
+	}
+	return ReplayBatchData(b.batch.Data(), fn)
+}
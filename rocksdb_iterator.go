@@ -14,9 +14,13 @@ type rocksDBIterator struct {
 	start, end []byte
 	isReverse  bool
 	isInvalid  bool
+	noCopy     bool // return borrowed keys and values, see UnsafeReader
+	keyOnly    bool // never read values, see IteratorOptions
+
+	ro *grocksdb.ReadOptions // read options owned by the iterator, if any
 }
 
-var _ Iterator = (*rocksDBIterator)(nil)
+var _ BidirectionalIterator = (*rocksDBIterator)(nil)
 
 func newRocksDBIterator(source *grocksdb.Iterator, start, end []byte, isReverse bool) *rocksDBIterator {
 	if isReverse {
@@ -73,20 +77,18 @@ func (itr *rocksDBIterator) Valid() bool {
 		return false
 	}
 
-	// If key is end or past it, invalid.
+	// If key is outside the domain, invalid. Both bounds are checked, since the iterator may move
+	// in both directions with Prev.
 	start := itr.start
 	end := itr.end
 	key := moveSliceToBytes(itr.source.Key())
-	if itr.isReverse {
-		if start != nil && bytes.Compare(key, start) < 0 {
-			itr.isInvalid = true
-			return false
-		}
-	} else {
-		if end != nil && bytes.Compare(end, key) <= 0 {
-			itr.isInvalid = true
-			return false
-		}
+	if start != nil && bytes.Compare(key, start) < 0 {
+		itr.isInvalid = true
+		return false
+	}
+	if end != nil && bytes.Compare(end, key) <= 0 {
+		itr.isInvalid = true
+		return false
 	}
 
 	// It's valid.
@@ -96,12 +98,21 @@ func (itr *rocksDBIterator) Valid() bool {
 // Key implements Iterator.
 func (itr *rocksDBIterator) Key() []byte {
 	itr.assertIsValid()
+	if itr.noCopy {
+		return itr.source.Key().Data()
+	}
 	return moveSliceToBytes(itr.source.Key())
 }
 
 // Value implements Iterator.
 func (itr *rocksDBIterator) Value() []byte {
 	itr.assertIsValid()
+	if itr.keyOnly {
+		return nil
+	}
+	if itr.noCopy {
+		return itr.source.Value().Data()
+	}
 	return moveSliceToBytes(itr.source.Value())
 }
 
@@ -115,6 +126,16 @@ func (itr rocksDBIterator) Next() {
 	}
 }
 
+// Prev implements BidirectionalIterator.
+func (itr *rocksDBIterator) Prev() {
+	itr.assertIsValid()
+	if itr.isReverse {
+		itr.source.Next()
+	} else {
+		itr.source.Prev()
+	}
+}
+
 // Error implements Iterator.
 func (itr *rocksDBIterator) Error() error {
 	return itr.source.Err()
@@ -123,6 +144,10 @@ func (itr *rocksDBIterator) Error() error {
 // Close implements Iterator.
 func (itr *rocksDBIterator) Close() error {
 	itr.source.Close()
+	if itr.ro != nil {
+		itr.ro.Destroy()
+		itr.ro = nil
+	}
 	return nil
 }
 
@@ -0,0 +1,281 @@
+package db
+
+import (
+	"bytes"
+	"math/big"
+	"sort"
+	"sync"
+)
+
+const (
+	// The number of bisection steps used to find each split point from the estimated sizes.
+	splitBisections = 64
+)
+
+// KeyRange is a range of keys [Start, End). A nil Start or End is unbounded.
+type KeyRange struct {
+	Start []byte
+	End   []byte
+}
+
+// RangeSplitter is implemented by databases which can split a range of keys into subranges of
+// roughly equal size, from their metadata.
+type RangeSplitter interface {
+	// SplitRange splits [start, end) into at most n contiguous subranges of roughly equal size, in
+	// ascending order. The first one starts at start and the last one ends at end. A nil start or
+	// end is unbounded.
+	// CONTRACT: start, end readonly []byte
+	SplitRange(start, end []byte, n int) ([]KeyRange, error)
+}
+
+// SplitRange splits [start, end) of db into at most n contiguous subranges of roughly equal size,
+// e.g. to scan them in parallel. If db does not implement RangeSplitter, it splits from the
+// estimated sizes of ranges if db implements SizeEstimator, or falls back to scanning the keys of
+// the range and splitting them evenly.
+func SplitRange(db DB, start, end []byte, n int) ([]KeyRange, error) {
+	if splitter, ok := db.(RangeSplitter); ok {
+		return splitter.SplitRange(start, end, n)
+	}
+	if err := checkSplitRange(start, end, n); err != nil {
+		return nil, err
+	}
+	if _, ok := db.(SizeEstimator); ok {
+		return splitRangeBySize(db, start, end, n)
+	}
+	return splitRangeByKeys(db, start, end, n)
+}
+
+// ParallelScan splits [start, end) of db into at most n subranges with SplitRange, and calls fn
+// concurrently with an iterator created with opts over each of them. The iterators are closed
+// when fn returns. It returns the first error returned by fn or the iterators, after all calls
+// have returned.
+func ParallelScan(db DB, start, end []byte, n int, opts IteratorOptions, fn func(itr Iterator) error) error {
+	ranges, err := SplitRange(db, start, end, n)
+	if err != nil {
+		return err
+	}
+
+	var (
+		wg       sync.WaitGroup
+		mtx      sync.Mutex
+		firstErr error
+	)
+	for _, r := range ranges {
+		r := r
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			err := scanRange(db, r, opts, fn)
+			if err != nil {
+				mtx.Lock()
+				if firstErr == nil {
+					firstErr = err
+				}
+				mtx.Unlock()
+			}
+		}()
+	}
+	wg.Wait()
+	return firstErr
+}
+
+// scanRange calls fn with an iterator over r.
+func scanRange(db DB, r KeyRange, opts IteratorOptions, fn func(itr Iterator) error) error {
+	itr, err := IteratorWithOptions(db, r.Start, r.End, opts)
+	if err != nil {
+		return err
+	}
+	err = fn(itr)
+	if closeErr := itr.Close(); err == nil {
+		err = closeErr
+	}
+	return err
+}
+
+// checkSplitRange checks the arguments of SplitRange.
+func checkSplitRange(start, end []byte, n int) error {
+	if (start != nil && len(start) == 0) || (end != nil && len(end) == 0) {
+		return errKeyEmpty
+	}
+	if n < 1 {
+		return errSplitCountInvalid
+	}
+	return nil
+}
+
+// splitRangeBySize splits [start, end) of db, which implements SizeEstimator, by bisecting the
+// key space until the estimated size of each subrange is close to its share of the total. If
+// the range has no estimated size, e.g. because it is not flushed to disk yet, it splits it by
+// keys instead.
+func splitRangeBySize(db DB, start, end []byte, n int) ([]KeyRange, error) {
+	if n == 1 {
+		return []KeyRange{{Start: start, End: end}}, nil
+	}
+	total, err := EstimateSize(db, start, end)
+	if err != nil {
+		return nil, err
+	}
+	if total == 0 {
+		return splitRangeByKeys(db, start, end, n)
+	}
+	limit, err := estimateEnd(db, start, end)
+	if err != nil {
+		return nil, err
+	}
+
+	splits := make([][]byte, 0, n-1)
+	lo := start
+	for i := 1; i < n; i++ {
+		target := total * uint64(i) / uint64(n)
+		hi := limit
+		for j := 0; j < splitBisections; j++ {
+			mid := midKey(lo, hi)
+			if bytes.Compare(mid, lo) <= 0 || bytes.Compare(mid, hi) >= 0 {
+				break
+			}
+			size, err := EstimateSize(db, start, mid)
+			if err != nil {
+				return nil, err
+			}
+			if size < target {
+				lo = mid
+			} else {
+				hi = mid
+			}
+		}
+		if bytes.Equal(hi, limit) {
+			break
+		}
+		if len(splits) == 0 || !bytes.Equal(hi, splits[len(splits)-1]) {
+			splits = append(splits, hi)
+		}
+		lo = hi
+	}
+	return keyRanges(start, end, splits), nil
+}
+
+// tableRange is the key range and on-disk size of a table of an engine, to split ranges from.
+type tableRange struct {
+	smallest []byte // the smallest key of the table
+	largest  []byte // the largest key of the table, inclusive
+	size     uint64
+}
+
+// splitRangeByTables splits [start, end) of db, which implements SizeEstimator, after the last
+// keys of the tables overlapping it, so that each subrange has roughly its share of their sizes.
+// Tables are counted whole even if they only partly overlap the range, and writes which are not
+// flushed to tables yet are ignored. If fewer than n tables overlap the range, it splits it by
+// bisecting instead.
+func splitRangeByTables(db DB, start, end []byte, n int, tables []tableRange) ([]KeyRange, error) {
+	if n == 1 {
+		return []KeyRange{{Start: start, End: end}}, nil
+	}
+	var (
+		overlapping []tableRange
+		total       uint64
+	)
+	for _, table := range tables {
+		if (start != nil && bytes.Compare(table.largest, start) < 0) ||
+			(end != nil && bytes.Compare(table.smallest, end) >= 0) {
+			continue
+		}
+		overlapping = append(overlapping, table)
+		total += table.size
+	}
+	if len(overlapping) < n || total == 0 {
+		return splitRangeBySize(db, start, end, n)
+	}
+	sort.Slice(overlapping, func(i, j int) bool {
+		return bytes.Compare(overlapping[i].largest, overlapping[j].largest) < 0
+	})
+
+	splits := make([][]byte, 0, n-1)
+	size := uint64(0)
+	for i, next := 0, 1; i < len(overlapping) && next < n; i++ {
+		size += overlapping[i].size
+		if size*uint64(n) < total*uint64(next) {
+			continue
+		}
+		for next < n && size*uint64(n) >= total*uint64(next) {
+			next++
+		}
+		split := append(cp(overlapping[i].largest), 0x00)
+		if (start != nil && bytes.Compare(split, start) <= 0) || (end != nil && bytes.Compare(split, end) >= 0) {
+			continue
+		}
+		if len(splits) == 0 || bytes.Compare(split, splits[len(splits)-1]) > 0 {
+			splits = append(splits, split)
+		}
+	}
+	if len(splits) == 0 {
+		return splitRangeBySize(db, start, end, n)
+	}
+	return keyRanges(start, end, splits), nil
+}
+
+// splitRangeByKeys splits [start, end) of db into subranges with the same number of keys, by
+// scanning the keys twice: once to count them, and once to find the split points.
+func splitRangeByKeys(db DB, start, end []byte, n int) ([]KeyRange, error) {
+	count, err := EstimateKeyCount(db, start, end)
+	if err != nil {
+		return nil, err
+	}
+	if n == 1 || count < 2 {
+		return []KeyRange{{Start: start, End: end}}, nil
+	}
+	itr, err := IteratorWithOptions(db, start, end, IteratorOptions{KeyOnly: true, Unsafe: true})
+	if err != nil {
+		return nil, err
+	}
+	defer itr.Close()
+
+	var (
+		splits [][]byte
+		i      uint64
+	)
+	for next := 1; itr.Valid() && next < n; itr.Next() {
+		if i > 0 && i >= count*uint64(next)/uint64(n) {
+			splits = append(splits, cp(itr.Key()))
+			for next < n && i >= count*uint64(next)/uint64(n) {
+				next++
+			}
+		}
+		i++
+	}
+	if err := itr.Error(); err != nil {
+		return nil, err
+	}
+	return keyRanges(start, end, splits), nil
+}
+
+// keyRanges returns the contiguous ranges of [start, end) separated by the ascending split keys.
+func keyRanges(start, end []byte, splits [][]byte) []KeyRange {
+	ranges := make([]KeyRange, 0, len(splits)+1)
+	for _, split := range splits {
+		ranges = append(ranges, KeyRange{Start: start, End: split})
+		start = split
+	}
+	return append(ranges, KeyRange{Start: start, End: end})
+}
+
+// midKey returns a key roughly halfway between lo and hi, reading keys as fractions in base 256.
+// A nil lo is the smallest key.
+func midKey(lo, hi []byte) []byte {
+	size := len(lo)
+	if len(hi) > size {
+		size = len(hi)
+	}
+	size++ // room for the halved last digit
+
+	a := new(big.Int).SetBytes(padKey(lo, size))
+	b := new(big.Int).SetBytes(padKey(hi, size))
+	a.Add(a, b).Rsh(a, 1)
+	return a.FillBytes(make([]byte, size))
+}
+
+// padKey pads key with zeros to size bytes, keeping its value as a fraction.
+func padKey(key []byte, size int) []byte {
+	padded := make([]byte, size)
+	copy(padded, key)
+	return padded
+}
@@ -0,0 +1,177 @@
+package db
+
+import (
+	"bytes"
+	"crypto/rand"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"sync/atomic"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestSplitRange(t *testing.T) {
+	for backend := range backends {
+		backend := backend
+		t.Run(string(backend), func(t *testing.T) {
+			db, dir := newTempDB(t, backend)
+			defer os.RemoveAll(dir)
+			defer db.Close()
+			_, ok := db.(RangeSplitter)
+			require.True(t, ok)
+			testSplitRange(t, db)
+		})
+	}
+}
+
+func TestSplitRangeFallback(t *testing.T) {
+	testSplitRange(t, NewTraceDB(NewMemDB(), io.Discard, TraceOptions{}))
+}
+
+func testSplitRange(t *testing.T, db DB) {
+	t.Helper()
+
+	ranges, err := SplitRange(db, nil, nil, 4)
+	require.NoError(t, err)
+	require.Equal(t, []KeyRange{{}}, ranges)
+
+	const count = 4000
+	batch := db.NewBatch()
+	for i := 0; i < count; i++ {
+		value := make([]byte, 200)
+		_, err := rand.Read(value)
+		require.NoError(t, err)
+		require.NoError(t, batch.Set([]byte(fmt.Sprintf("key%05d", i)), value))
+	}
+	require.NoError(t, batch.Write())
+
+	check := func(start, end []byte, n, keys int) {
+		t.Helper()
+
+		ranges, err := SplitRange(db, start, end, n)
+		require.NoError(t, err)
+		require.NotEmpty(t, ranges)
+		require.LessOrEqual(t, len(ranges), n)
+		require.Equal(t, start, ranges[0].Start)
+		require.Equal(t, end, ranges[len(ranges)-1].End)
+		for i := 1; i < len(ranges); i++ {
+			require.Equal(t, ranges[i-1].End, ranges[i].Start)
+			require.True(t, bytes.Compare(ranges[i].Start, ranges[i].End) < 0 || ranges[i].End == nil)
+		}
+		if n > 1 {
+			require.Greater(t, len(ranges), 1)
+		}
+
+		// Each subrange has roughly its share of the keys.
+		total := 0
+		for _, r := range ranges {
+			itr, err := db.Iterator(r.Start, r.End)
+			require.NoError(t, err)
+			rangeKeys := 0
+			for ; itr.Valid(); itr.Next() {
+				rangeKeys++
+			}
+			require.NoError(t, itr.Close())
+			require.InDelta(t, keys/len(ranges), rangeKeys, float64(keys/len(ranges))/2, "%x-%x", r.Start, r.End)
+			total += rangeKeys
+		}
+		require.Equal(t, keys, total)
+	}
+	checkAll := func() {
+		t.Helper()
+		check(nil, nil, 1, count)
+		check(nil, nil, 4, count)
+		check([]byte("key01000"), []byte("key03000"), 5, 2000)
+		check([]byte("key02000"), nil, 2, 2000)
+	}
+	checkAll()
+
+	// Flush the data to disk, for the backends which split from estimated sizes.
+	switch d := db.(type) {
+	case *GoLevelDB:
+		require.NoError(t, d.ForceCompact(nil, nil))
+	case *PebbleDB:
+		require.NoError(t, d.DB().Flush())
+	}
+	checkAll()
+
+	_, err = SplitRange(db, nil, nil, 0)
+	require.Equal(t, errSplitCountInvalid, err)
+	_, err = SplitRange(db, []byte{}, nil, 2)
+	require.Equal(t, errKeyEmpty, err)
+}
+
+func TestSplitRangeByTables(t *testing.T) {
+	db := NewMemDB()
+	tables := []tableRange{
+		{smallest: []byte("j"), largest: []byte("l"), size: 10},
+		{smallest: []byte("a"), largest: []byte("c"), size: 10},
+		{smallest: []byte("g"), largest: []byte("i"), size: 10},
+		{smallest: []byte("d"), largest: []byte("f"), size: 10},
+	}
+
+	// Ranges are split after the last keys of the tables.
+	ranges, err := splitRangeByTables(db, nil, nil, 2, tables)
+	require.NoError(t, err)
+	require.Equal(t, []KeyRange{{End: []byte("f\x00")}, {Start: []byte("f\x00")}}, ranges)
+
+	ranges, err = splitRangeByTables(db, []byte("e"), []byte("k"), 3, tables)
+	require.NoError(t, err)
+	require.Equal(t, []KeyRange{
+		{Start: []byte("e"), End: []byte("f\x00")},
+		{Start: []byte("f\x00"), End: []byte("i\x00")},
+		{Start: []byte("i\x00"), End: []byte("k")},
+	}, ranges)
+
+	// With fewer tables than subranges, the range is split by bisecting instead.
+	require.NoError(t, db.Set([]byte("b"), []byte{1}))
+	require.NoError(t, db.Set([]byte("h"), []byte{1}))
+	ranges, err = splitRangeByTables(db, nil, nil, 5, tables)
+	require.NoError(t, err)
+	bisected, err := splitRangeBySize(db, nil, nil, 5)
+	require.NoError(t, err)
+	require.Equal(t, bisected, ranges)
+}
+
+func TestParallelScan(t *testing.T) {
+	db := NewMemDB()
+	for i := 0; i < 1000; i++ {
+		require.NoError(t, db.Set([]byte(fmt.Sprintf("key%04d", i)), []byte{1}))
+	}
+
+	var keys, scans int64
+	err := ParallelScan(db, nil, nil, 4, IteratorOptions{KeyOnly: true}, func(itr Iterator) error {
+		atomic.AddInt64(&scans, 1)
+		start, end := itr.Domain()
+		for ; itr.Valid(); itr.Next() {
+			require.True(t, start == nil || bytes.Compare(itr.Key(), start) >= 0)
+			require.True(t, end == nil || bytes.Compare(itr.Key(), end) < 0)
+			require.Nil(t, itr.Value())
+			atomic.AddInt64(&keys, 1)
+		}
+		return itr.Error()
+	})
+	require.NoError(t, err)
+	require.EqualValues(t, 4, scans)
+	require.EqualValues(t, 1000, keys)
+
+	errScan := errors.New("scan failed")
+	err = ParallelScan(db, nil, nil, 4, IteratorOptions{}, func(itr Iterator) error {
+		if start, _ := itr.Domain(); start == nil {
+			return errScan
+		}
+		return nil
+	})
+	require.Equal(t, errScan, err)
+}
+
+func TestMidKey(t *testing.T) {
+	require.Equal(t, []byte{0x7f, 0x80}, midKey(nil, []byte{0xff}))
+	require.Equal(t, []byte{0x00, 0x80}, midKey(nil, []byte{0x01}))
+	require.Equal(t, []byte{0x01, 0x80}, midKey([]byte{0x01}, []byte{0x02}))
+	require.Equal(t, []byte("b\x00"), midKey([]byte("a"), []byte("c")))
+	require.Equal(t, []byte{0x7f, 0xff, 0x80}, midKey([]byte{0x7f, 0xff}, []byte{0x80}))
+}
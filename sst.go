@@ -0,0 +1,166 @@
+package db
+
+import (
+	"fmt"
+	"path/filepath"
+
+	"github.com/cockroachdb/pebble"
+	"github.com/cockroachdb/pebble/objstorage/objstorageprovider"
+	"github.com/cockroachdb/pebble/sstable"
+	"github.com/cockroachdb/pebble/vfs"
+)
+
+const (
+	// The size of the batches used by Ingest for databases without native ingestion.
+	ingestBatchSize = 32 << 20
+)
+
+// SSTWriter writes key/value pairs to an external SST file, to bulk load them into a database
+// with Ingest, bypassing its memtable and write-ahead log.
+type SSTWriter interface {
+	// Set adds a key/value pair to the file. Keys must be added in strictly increasing order.
+	// CONTRACT: key, value readonly []byte
+	Set(key, value []byte) error
+
+	// Finish completes the file and releases the resources of the writer, which can't be used
+	// afterwards. It must also be called after errors, to release the resources.
+	Finish() error
+}
+
+// Ingester is implemented by databases which can bulk load external SST files.
+type Ingester interface {
+	// NewSSTWriter creates an SST file at path, to ingest into the database.
+	NewSSTWriter(path string) (SSTWriter, error)
+
+	// Ingest atomically loads the SST files created with NewSSTWriter at paths into the
+	// database, overwriting existing values. The files must not overlap each other, and may be
+	// moved into the database, so they must not be used afterwards.
+	Ingest(paths []string) error
+}
+
+// NewSSTWriter creates an SST file at path, to ingest into db with Ingest. If db does not
+// implement Ingester, it writes a file in the pebble format.
+func NewSSTWriter(db DB, path string) (SSTWriter, error) {
+	if ingester, ok := db.(Ingester); ok {
+		return ingester.NewSSTWriter(path)
+	}
+	return newPebbleSSTWriter(vfs.Default, path, sstable.TableFormatRocksDBv2)
+}
+
+// Ingest loads the SST files created with NewSSTWriter at paths into db, overwriting existing
+// values. If db does not implement Ingester, it falls back to reading the files and writing their
+// pairs in large batches, which is not atomic and leaves the files in place.
+func Ingest(db DB, paths []string) error {
+	if ingester, ok := db.(Ingester); ok {
+		return ingester.Ingest(paths)
+	}
+	for _, path := range paths {
+		if err := ingestBatches(db, path); err != nil {
+			return fmt.Errorf("failed to ingest %v: %w", path, err)
+		}
+	}
+	return nil
+}
+
+// ingestBatches writes the pairs of the SST file at path to db in batches of ingestBatchSize.
+func ingestBatches(db DB, path string) error {
+	f, err := vfs.Default.Open(path)
+	if err != nil {
+		return err
+	}
+	readable, err := sstable.NewSimpleReadable(f)
+	if err != nil {
+		f.Close()
+		return err
+	}
+	reader, err := sstable.NewReader(readable, sstable.ReaderOptions{})
+	if err != nil {
+		readable.Close()
+		return err
+	}
+	defer reader.Close()
+	itr, err := reader.NewIter(nil, nil)
+	if err != nil {
+		return err
+	}
+	defer itr.Close()
+
+	batch := db.NewBatch()
+	defer func() {
+		batch.Close()
+	}()
+	for key, lazyValue := itr.First(); key != nil; key, lazyValue = itr.Next() {
+		switch key.Kind() {
+		case pebble.InternalKeyKindSet, pebble.InternalKeyKindSetWithDelete:
+			value, _, err := lazyValue.Value(nil)
+			if err != nil {
+				return err
+			}
+			// The iterator reuses its buffers, while batches may keep the slices.
+			err = batch.Set(cp(key.UserKey), cp(value))
+			if err != nil {
+				return err
+			}
+		case pebble.InternalKeyKindDelete, pebble.InternalKeyKindSingleDelete:
+			if err := batch.Delete(cp(key.UserKey)); err != nil {
+				return err
+			}
+		default:
+			return fmt.Errorf("unsupported key kind %v", key.Kind())
+		}
+
+		size, err := batch.GetByteSize()
+		if err != nil {
+			return err
+		}
+		if size >= ingestBatchSize {
+			if err := batch.Write(); err != nil {
+				return err
+			}
+			batch.Close()
+			batch = db.NewBatch()
+		}
+	}
+	if err := itr.Error(); err != nil {
+		return err
+	}
+	return batch.WriteSync()
+}
+
+// pebbleSSTWriter is an SSTWriter writing files in a pebble table format.
+type pebbleSSTWriter struct {
+	writer *sstable.Writer
+}
+
+var _ SSTWriter = (*pebbleSSTWriter)(nil)
+
+func newPebbleSSTWriter(fs vfs.FS, path string, format sstable.TableFormat) (*pebbleSSTWriter, error) {
+	// The directory may not exist on in-memory file systems, which callers can't access.
+	if err := fs.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return nil, err
+	}
+	f, err := fs.Create(path)
+	if err != nil {
+		return nil, err
+	}
+	writer := sstable.NewWriter(objstorageprovider.NewFileWritable(f), sstable.WriterOptions{
+		TableFormat: format,
+	})
+	return &pebbleSSTWriter{writer: writer}, nil
+}
+
+// Set implements SSTWriter.
+func (w *pebbleSSTWriter) Set(key, value []byte) error {
+	if len(key) == 0 {
+		return errKeyEmpty
+	}
+	if value == nil {
+		return errValueNil
+	}
+	return w.writer.Set(key, value)
+}
+
+// Finish implements SSTWriter.
+func (w *pebbleSSTWriter) Finish() error {
+	return w.writer.Close()
+}
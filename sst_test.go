@@ -0,0 +1,72 @@
+package db
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestIngest(t *testing.T) {
+	for backend := range backends {
+		backend := backend
+		t.Run(string(backend), func(t *testing.T) {
+			db, dir := newTempDB(t, backend)
+			defer os.RemoveAll(dir)
+			defer db.Close()
+			testIngest(t, db)
+		})
+	}
+}
+
+func TestIngestFallback(t *testing.T) {
+	testIngest(t, NewTraceDB(NewMemDB(), io.Discard, TraceOptions{}))
+}
+
+func testIngest(t *testing.T, db DB) {
+	t.Helper()
+
+	require.NoError(t, db.Set([]byte("a0001"), []byte("old")))
+	require.NoError(t, db.Set([]byte("c"), []byte("kept")))
+
+	// Write two files over disjoint ranges.
+	sstDir := t.TempDir()
+	var paths []string
+	for file, prefix := range []string{"a", "b"} {
+		path := filepath.Join(sstDir, fmt.Sprintf("%d.sst", file))
+		writer, err := NewSSTWriter(db, path)
+		require.NoError(t, err)
+		for i := 0; i < 1000; i++ {
+			key := []byte(fmt.Sprintf("%s%04d", prefix, i))
+			require.NoError(t, writer.Set(key, key))
+		}
+		require.NoError(t, writer.Finish())
+		paths = append(paths, path)
+	}
+
+	require.NoError(t, Ingest(db, paths))
+	checkValue(t, db, []byte("a0001"), []byte("a0001"))
+	checkValue(t, db, []byte("b0999"), []byte("b0999"))
+	checkValue(t, db, []byte("c"), []byte("kept"))
+
+	itr, err := db.Iterator(nil, nil)
+	require.NoError(t, err)
+	count := 0
+	for ; itr.Valid(); itr.Next() {
+		count++
+	}
+	require.NoError(t, itr.Close())
+	require.Equal(t, 2001, count)
+
+	// Keys must be added in increasing order.
+	writer, err := NewSSTWriter(db, filepath.Join(sstDir, "unordered.sst"))
+	require.NoError(t, err)
+	require.NoError(t, writer.Set([]byte("b"), []byte{1}))
+	require.Error(t, writer.Set([]byte("a"), []byte{1}))
+	require.Equal(t, errKeyEmpty, writer.Set(nil, []byte{1}))
+	require.Equal(t, errValueNil, writer.Set([]byte("c"), nil))
+	_ = writer.Finish()
+}
@@ -0,0 +1,308 @@
+package db
+
+import (
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"io"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// TraceEncoding selects how keys and values are encoded in a trace.
+type TraceEncoding int
+
+const (
+	// TraceEncodingHex encodes keys and values as lowercase hex strings.
+	TraceEncodingHex TraceEncoding = iota
+	// TraceEncodingBase64 encodes keys and values as standard base64 strings.
+	TraceEncodingBase64
+)
+
+// TraceOptions configures a TraceDB.
+type TraceOptions struct {
+	// Encoding selects how keys and values are written. Defaults to hex.
+	Encoding TraceEncoding
+
+	// SampleEvery traces only one out of every SampleEvery operations. Batches and iterators are
+	// sampled as a whole when they are created, so a traced batch always has all of its
+	// operations in the trace. Zero or one traces every operation.
+	SampleEvery uint64
+}
+
+// TraceDB wraps a database and writes every operation to an io.Writer as a JSON line, including
+// the operation type, keys, values, batch and iterator ids, iterator bounds and elapsed time.
+// It is meant for debugging, e.g. diffing the writes of two nodes that disagree on an app hash.
+//
+// Errors writing to the trace are ignored, so that tracing never affects the database itself.
+type TraceDB struct {
+	db   DB
+	opts TraceOptions
+
+	mtx sync.Mutex // guards w, so that concurrent records are not interleaved
+	w   io.Writer
+
+	ops     uint64 // operation counter used for sampling, accessed atomically
+	batches uint64 // last batch id, accessed atomically
+	iters   uint64 // last iterator id, accessed atomically
+}
+
+var _ DB = (*TraceDB)(nil)
+
+// traceRecord is a single line of a trace. Byte fields are pre-encoded according to the
+// TraceEncoding, and pointers distinguish nil from empty values.
+type traceRecord struct {
+	Time     time.Time `json:"time"`
+	Op       string    `json:"op"`
+	Key      *string   `json:"key,omitempty"`
+	Value    *string   `json:"value,omitempty"`
+	Start    *string   `json:"start,omitempty"`
+	End      *string   `json:"end,omitempty"`
+	Batch    uint64    `json:"batch,omitempty"`
+	Iterator uint64    `json:"iterator,omitempty"`
+	Count    int       `json:"count,omitempty"`
+	Found    *bool     `json:"found,omitempty"`
+	Elapsed  int64     `json:"elapsed_ns"`
+	Error    string    `json:"error,omitempty"`
+}
+
+// NewTraceDB wraps db, writing a trace of all operations to w.
+func NewTraceDB(db DB, w io.Writer, opts TraceOptions) *TraceDB {
+	return &TraceDB{
+		db:   db,
+		w:    w,
+		opts: opts,
+	}
+}
+
+// sample reports whether the next operation should be traced.
+func (tdb *TraceDB) sample() bool {
+	if tdb.opts.SampleEvery <= 1 {
+		return true
+	}
+	return (atomic.AddUint64(&tdb.ops, 1)-1)%tdb.opts.SampleEvery == 0
+}
+
+func (tdb *TraceDB) encode(bz []byte) *string {
+	if bz == nil {
+		return nil
+	}
+	var s string
+	switch tdb.opts.Encoding {
+	case TraceEncodingBase64:
+		s = base64.StdEncoding.EncodeToString(bz)
+	default:
+		s = hex.EncodeToString(bz)
+	}
+	return &s
+}
+
+func (tdb *TraceDB) write(rec traceRecord, start time.Time, err error) {
+	rec.Time = start
+	rec.Elapsed = time.Since(start).Nanoseconds()
+	if err != nil {
+		rec.Error = err.Error()
+	}
+	line, mErr := json.Marshal(rec)
+	if mErr != nil {
+		return
+	}
+	line = append(line, '\n')
+
+	tdb.mtx.Lock()
+	defer tdb.mtx.Unlock()
+	_, _ = tdb.w.Write(line)
+}
+
+// Get implements DB.
+func (tdb *TraceDB) Get(key []byte) ([]byte, error) {
+	if !tdb.sample() {
+		return tdb.db.Get(key)
+	}
+	start := time.Now()
+	value, err := tdb.db.Get(key)
+	tdb.write(traceRecord{Op: "get", Key: tdb.encode(key), Value: tdb.encode(value)}, start, err)
+	return value, err
+}
+
+// Has implements DB.
+func (tdb *TraceDB) Has(key []byte) (bool, error) {
+	if !tdb.sample() {
+		return tdb.db.Has(key)
+	}
+	start := time.Now()
+	ok, err := tdb.db.Has(key)
+	tdb.write(traceRecord{Op: "has", Key: tdb.encode(key), Found: &ok}, start, err)
+	return ok, err
+}
+
+// Set implements DB.
+func (tdb *TraceDB) Set(key, value []byte) error {
+	return tdb.traceWrite("set", key, value, tdb.db.Set)
+}
+
+// SetSync implements DB.
+func (tdb *TraceDB) SetSync(key, value []byte) error {
+	return tdb.traceWrite("set_sync", key, value, tdb.db.SetSync)
+}
+
+// Delete implements DB.
+func (tdb *TraceDB) Delete(key []byte) error {
+	return tdb.traceWrite("delete", key, nil, func(key, _ []byte) error { return tdb.db.Delete(key) })
+}
+
+// DeleteSync implements DB.
+func (tdb *TraceDB) DeleteSync(key []byte) error {
+	return tdb.traceWrite("delete_sync", key, nil, func(key, _ []byte) error { return tdb.db.DeleteSync(key) })
+}
+
+func (tdb *TraceDB) traceWrite(op string, key, value []byte, fn func(key, value []byte) error) error {
+	if !tdb.sample() {
+		return fn(key, value)
+	}
+	start := time.Now()
+	err := fn(key, value)
+	tdb.write(traceRecord{Op: op, Key: tdb.encode(key), Value: tdb.encode(value)}, start, err)
+	return err
+}
+
+// Iterator implements DB.
+func (tdb *TraceDB) Iterator(start, end []byte) (Iterator, error) {
+	return tdb.traceIterator("iterator", start, end, tdb.db.Iterator)
+}
+
+// ReverseIterator implements DB.
+func (tdb *TraceDB) ReverseIterator(start, end []byte) (Iterator, error) {
+	return tdb.traceIterator("reverse_iterator", start, end, tdb.db.ReverseIterator)
+}
+
+func (tdb *TraceDB) traceIterator(
+	op string,
+	start, end []byte,
+	fn func(start, end []byte) (Iterator, error),
+) (Iterator, error) {
+	if !tdb.sample() {
+		return fn(start, end)
+	}
+	now := time.Now()
+	itr, err := fn(start, end)
+	id := atomic.AddUint64(&tdb.iters, 1)
+	tdb.write(traceRecord{Op: op, Start: tdb.encode(start), End: tdb.encode(end), Iterator: id}, now, err)
+	if err != nil {
+		return nil, err
+	}
+	return &traceDBIterator{Iterator: itr, tdb: tdb, id: id, opened: now}, nil
+}
+
+// Close implements DB.
+func (tdb *TraceDB) Close() error {
+	start := time.Now()
+	err := tdb.db.Close()
+	tdb.write(traceRecord{Op: "close"}, start, err)
+	return err
+}
+
+// NewBatch implements DB.
+func (tdb *TraceDB) NewBatch() Batch {
+	return tdb.newTraceBatch(tdb.db.NewBatch())
+}
+
+// NewBatchWithSize implements DB.
+func (tdb *TraceDB) NewBatchWithSize(size int) Batch {
+	return tdb.newTraceBatch(tdb.db.NewBatchWithSize(size))
+}
+
+func (tdb *TraceDB) newTraceBatch(batch Batch) Batch {
+	if !tdb.sample() {
+		return batch
+	}
+	return &traceDBBatch{
+		Batch: batch,
+		tdb:   tdb,
+		id:    atomic.AddUint64(&tdb.batches, 1),
+	}
+}
+
+// Print implements DB.
+func (tdb *TraceDB) Print() error {
+	return tdb.db.Print()
+}
+
+// Stats implements DB.
+func (tdb *TraceDB) Stats() map[string]string {
+	return tdb.db.Stats()
+}
+
+// traceDBBatch traces the operations of a sampled batch, tagging them with the batch id.
+type traceDBBatch struct {
+	Batch
+	tdb   *TraceDB
+	id    uint64
+	count int
+}
+
+var _ Batch = (*traceDBBatch)(nil)
+
+// Set implements Batch.
+func (b *traceDBBatch) Set(key, value []byte) error {
+	start := time.Now()
+	err := b.Batch.Set(key, value)
+	b.tdb.write(traceRecord{Op: "batch_set", Key: b.tdb.encode(key), Value: b.tdb.encode(value), Batch: b.id},
+		start, err)
+	if err == nil {
+		b.count++
+	}
+	return err
+}
+
+// Delete implements Batch.
+func (b *traceDBBatch) Delete(key []byte) error {
+	start := time.Now()
+	err := b.Batch.Delete(key)
+	b.tdb.write(traceRecord{Op: "batch_delete", Key: b.tdb.encode(key), Batch: b.id}, start, err)
+	if err == nil {
+		b.count++
+	}
+	return err
+}
+
+// Write implements Batch.
+func (b *traceDBBatch) Write() error {
+	start := time.Now()
+	err := b.Batch.Write()
+	b.tdb.write(traceRecord{Op: "batch_write", Batch: b.id, Count: b.count}, start, err)
+	return err
+}
+
+// WriteSync implements Batch.
+func (b *traceDBBatch) WriteSync() error {
+	start := time.Now()
+	err := b.Batch.WriteSync()
+	b.tdb.write(traceRecord{Op: "batch_write_sync", Batch: b.id, Count: b.count}, start, err)
+	return err
+}
+
+// traceDBIterator counts the calls to Next on a sampled iterator, and records them when closed.
+type traceDBIterator struct {
+	Iterator
+	tdb    *TraceDB
+	id     uint64
+	opened time.Time
+	count  int
+}
+
+var _ Iterator = (*traceDBIterator)(nil)
+
+// Next implements Iterator.
+func (itr *traceDBIterator) Next() {
+	itr.Iterator.Next()
+	itr.count++
+}
+
+// Close implements Iterator.
+func (itr *traceDBIterator) Close() error {
+	err := itr.Iterator.Close()
+	itr.tdb.write(traceRecord{Op: "iterator_close", Iterator: itr.id, Count: itr.count}, itr.opened, err)
+	return err
+}
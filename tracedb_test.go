@@ -0,0 +1,99 @@
+package db
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func readTrace(t *testing.T, buf *bytes.Buffer) []map[string]interface{} {
+	t.Helper()
+
+	var records []map[string]interface{}
+	scanner := bufio.NewScanner(buf)
+	for scanner.Scan() {
+		var rec map[string]interface{}
+		require.NoError(t, json.Unmarshal(scanner.Bytes(), &rec))
+		records = append(records, rec)
+	}
+	require.NoError(t, scanner.Err())
+	return records
+}
+
+func TestTraceDB(t *testing.T) {
+	var buf bytes.Buffer
+	tdb := NewTraceDB(NewMemDB(), &buf, TraceOptions{})
+
+	require.NoError(t, tdb.Set([]byte{0x01}, []byte{0xAB}))
+	value, err := tdb.Get([]byte{0x01})
+	require.NoError(t, err)
+	require.Equal(t, []byte{0xAB}, value)
+	require.NoError(t, tdb.DeleteSync([]byte{0x02}))
+	require.Equal(t, errKeyEmpty, tdb.Set(nil, []byte{}))
+
+	batch := tdb.NewBatch()
+	require.NoError(t, batch.Set([]byte{0x02}, []byte{}))
+	require.NoError(t, batch.Delete([]byte{0x01}))
+	require.NoError(t, batch.WriteSync())
+	require.NoError(t, batch.Close())
+
+	itr, err := tdb.ReverseIterator([]byte{0x01}, nil)
+	require.NoError(t, err)
+	for ; itr.Valid(); itr.Next() {
+		require.Equal(t, []byte{0x02}, itr.Key())
+	}
+	require.NoError(t, itr.Close())
+
+	records := readTrace(t, &buf)
+	require.Len(t, records, 9)
+
+	ops := make([]string, 0, len(records))
+	for _, rec := range records {
+		ops = append(ops, rec["op"].(string))
+		require.Contains(t, rec, "time")
+		require.Contains(t, rec, "elapsed_ns")
+	}
+	require.Equal(t, []string{
+		"set", "get", "delete_sync", "set", "batch_set", "batch_delete", "batch_write_sync",
+		"reverse_iterator", "iterator_close",
+	}, ops)
+
+	require.Equal(t, "01", records[0]["key"])
+	require.Equal(t, "ab", records[0]["value"])
+	require.Equal(t, "ab", records[1]["value"])
+	require.NotContains(t, records[2], "value")
+	require.Equal(t, errKeyEmpty.Error(), records[3]["error"])
+
+	// Batch operations share the batch id, and an empty value is distinct from a nil one.
+	require.EqualValues(t, 1, records[4]["batch"])
+	require.Equal(t, "", records[4]["value"])
+	require.EqualValues(t, 1, records[6]["batch"])
+	require.EqualValues(t, 2, records[6]["count"])
+
+	require.Equal(t, "01", records[7]["start"])
+	require.NotContains(t, records[7], "end")
+	require.EqualValues(t, 1, records[8]["iterator"])
+	require.EqualValues(t, 1, records[8]["count"])
+}
+
+func TestTraceDBOptions(t *testing.T) {
+	var buf bytes.Buffer
+	tdb := NewTraceDB(NewMemDB(), &buf, TraceOptions{
+		Encoding:    TraceEncodingBase64,
+		SampleEvery: 3,
+	})
+
+	for i := 0; i < 9; i++ {
+		require.NoError(t, tdb.Set([]byte("key"), []byte{byte(i)}))
+	}
+
+	records := readTrace(t, &buf)
+	require.Len(t, records, 3)
+	for i, rec := range records {
+		require.Equal(t, "a2V5", rec["key"])
+		require.Equal(t, []string{"AA==", "Aw==", "Bg=="}[i], rec["value"])
+	}
+}
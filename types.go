@@ -13,6 +13,30 @@ var (
 
 	// errValueNil is returned when attempting to set a nil value.
 	errValueNil = errors.New("value cannot be nil")
+
+	// errMergeOperatorMissing is returned when merging on a database without a merge operator.
+	errMergeOperatorMissing = errors.New("no merge operator configured")
+
+	// errConditionalWritesUnsupported is returned when the underlying database of a wrapper does
+	// not support conditional writes.
+	errConditionalWritesUnsupported = errors.New("conditional writes are not supported")
+
+	// errSplitCountInvalid is returned when a range is split into less than one subrange.
+	errSplitCountInvalid = errors.New("split count must be positive")
+
+	// errBatchSerializationUnsupported is returned when serializing a batch over a batch which
+	// does not implement SerializableBatch.
+	errBatchSerializationUnsupported = errors.New("batch serialization is not supported")
+
+	// errBatchReuseUnsupported is returned when reusing a batch over a batch which does not
+	// implement ReusableBatch.
+	errBatchReuseUnsupported = errors.New("batch reuse is not supported")
+
+	// errBatchViewWrite is returned when writing a batch view, instead of its parent batch.
+	errBatchViewWrite = errors.New("batch views cannot be written, write the parent batch instead")
+
+	// errAtomicCommitIntentCorrupted is returned when decoding an invalid atomic commit intent.
+	errAtomicCommitIntentCorrupted = errors.New("atomic commit intent is corrupted")
 )
 
 // DB is the main interface for all database backends. DBs are concurrency-safe. Callers must call
@@ -107,6 +131,20 @@ type Batch = interface {
 	GetByteSize() (int, error)
 }
 
+// ReusableBatch is implemented by batches which can be reused, e.g. one batch per block instead of
+// allocating a new one for each.
+type ReusableBatch interface {
+	Batch
+
+	// Count returns the number of pending operations of the batch.
+	Count() (int, error)
+
+	// Reset discards the pending operations of the batch. It can also be called after Write,
+	// WriteSync or Close, to use the batch again, reusing its buffers when possible. The batch
+	// must still be closed when done.
+	Reset() error
+}
+
 // Iterator represents an iterator over a domain of keys. Callers must call Close when done.
 // No writes can happen to a domain while there exists an iterator over it, some backends may take
 // out database locks to ensure this will not happen.
@@ -157,3 +195,15 @@ type Iterator = interface {
 	// Close closes the iterator, relasing any allocated resources.
 	Close() error
 }
+
+// BidirectionalIterator is implemented by iterators which can also move backwards within their
+// domain, e.g. for pagination or nearest key lookups, without opening a second iterator in the
+// opposite direction. All backend iterators implement it.
+type BidirectionalIterator interface {
+	Iterator
+
+	// Prev moves the iterator to the previous key in the database, as defined by order of
+	// iteration, i.e. it undoes Next. If there is no previous key in the domain, the iterator
+	// becomes invalid. If Valid returns false, this method will panic.
+	Prev()
+}
@@ -0,0 +1,63 @@
+package db
+
+import "io"
+
+// UnsafeReader is implemented by databases which can read without copying keys and values, for
+// hot read paths where the copies made by Get and iterators are significant. The returned slices
+// are borrowed from the database and must not be modified, nor used after they are released.
+type UnsafeReader interface {
+	// GetUnsafe fetches the value of the given key, or nil if it does not exist. The value is
+	// only valid until the closer is called, which the caller must do, even if the key does not
+	// exist.
+	// CONTRACT: key, value readonly []byte
+	GetUnsafe(key []byte) (value []byte, closer io.Closer, err error)
+
+	// IteratorUnsafe is like Iterator, but the slices returned by Key and Value are only valid
+	// until the next call to Next or Close.
+	IteratorUnsafe(start, end []byte) (Iterator, error)
+
+	// ReverseIteratorUnsafe is like ReverseIterator, but the slices returned by Key and Value are
+	// only valid until the next call to Next or Close.
+	ReverseIteratorUnsafe(start, end []byte) (Iterator, error)
+}
+
+// GetUnsafe fetches the value of key from db without copying it if db implements UnsafeReader,
+// and with Get otherwise. The caller must call the closer once done with the value.
+func GetUnsafe(db DB, key []byte) ([]byte, io.Closer, error) {
+	if reader, ok := db.(UnsafeReader); ok {
+		return reader.GetUnsafe(key)
+	}
+	value, err := db.Get(key)
+	if err != nil {
+		return nil, nil, err
+	}
+	return value, nopCloser{}, nil
+}
+
+// IteratorUnsafe returns an iterator over db which does not copy keys and values if db implements
+// UnsafeReader, and a regular iterator otherwise. Either way, the keys and values must only be
+// used until the next call to Next or Close.
+func IteratorUnsafe(db DB, start, end []byte) (Iterator, error) {
+	if reader, ok := db.(UnsafeReader); ok {
+		return reader.IteratorUnsafe(start, end)
+	}
+	return db.Iterator(start, end)
+}
+
+// ReverseIteratorUnsafe returns a reverse iterator over db which does not copy keys and values if
+// db implements UnsafeReader, and a regular reverse iterator otherwise. Either way, the keys and
+// values must only be used until the next call to Next or Close.
+func ReverseIteratorUnsafe(db DB, start, end []byte) (Iterator, error) {
+	if reader, ok := db.(UnsafeReader); ok {
+		return reader.ReverseIteratorUnsafe(start, end)
+	}
+	return db.ReverseIterator(start, end)
+}
+
+// nopCloser is an io.Closer for values which do not need to be released.
+type nopCloser struct{}
+
+// Close implements io.Closer.
+func (nopCloser) Close() error {
+	return nil
+}
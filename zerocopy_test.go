@@ -0,0 +1,84 @@
+package db
+
+import (
+	"io"
+	"os"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestUnsafeReader(t *testing.T) {
+	for backend := range backends {
+		backend := backend
+		t.Run(string(backend), func(t *testing.T) {
+			db, dir := newTempDB(t, backend)
+			defer os.RemoveAll(dir)
+			defer db.Close()
+			reader, ok := db.(UnsafeReader)
+			require.True(t, ok)
+
+			require.NoError(t, db.Set([]byte("a"), []byte{1}))
+			require.NoError(t, db.Set([]byte("b"), []byte{}))
+			require.NoError(t, db.Set([]byte("c"), []byte{3}))
+
+			value, closer, err := reader.GetUnsafe([]byte("a"))
+			require.NoError(t, err)
+			require.Equal(t, []byte{1}, value)
+			require.NoError(t, closer.Close())
+
+			value, closer, err = reader.GetUnsafe([]byte("b"))
+			require.NoError(t, err)
+			require.Equal(t, []byte{}, value)
+			require.NoError(t, closer.Close())
+
+			value, closer, err = reader.GetUnsafe([]byte("x"))
+			require.NoError(t, err)
+			require.Nil(t, value)
+			require.NoError(t, closer.Close())
+
+			_, _, err = reader.GetUnsafe(nil)
+			require.Equal(t, errKeyEmpty, err)
+
+			itr, err := reader.IteratorUnsafe([]byte("a"), []byte("c"))
+			require.NoError(t, err)
+			require.Equal(t, []string{"a=\x01", "b="}, collectUnsafe(t, itr))
+
+			itr, err = reader.ReverseIteratorUnsafe(nil, nil)
+			require.NoError(t, err)
+			require.Equal(t, []string{"c=\x03", "b=", "a=\x01"}, collectUnsafe(t, itr))
+		})
+	}
+}
+
+func TestUnsafeReaderFallback(t *testing.T) {
+	mdb := NewMemDB()
+	require.NoError(t, mdb.Set([]byte("a"), []byte{1}))
+	tdb := NewTraceDB(mdb, io.Discard, TraceOptions{})
+
+	value, closer, err := GetUnsafe(tdb, []byte("a"))
+	require.NoError(t, err)
+	require.Equal(t, []byte{1}, value)
+	require.NoError(t, closer.Close())
+
+	itr, err := IteratorUnsafe(tdb, nil, nil)
+	require.NoError(t, err)
+	require.Equal(t, []string{"a=\x01"}, collectUnsafe(t, itr))
+
+	itr, err = ReverseIteratorUnsafe(tdb, nil, nil)
+	require.NoError(t, err)
+	require.Equal(t, []string{"a=\x01"}, collectUnsafe(t, itr))
+}
+
+// collectUnsafe copies the pairs of an unsafe iterator into "key=value" strings, and closes it.
+func collectUnsafe(t *testing.T, itr Iterator) []string {
+	t.Helper()
+
+	defer itr.Close()
+	var pairs []string
+	for ; itr.Valid(); itr.Next() {
+		pairs = append(pairs, string(itr.Key())+"="+string(itr.Value()))
+	}
+	require.NoError(t, itr.Error())
+	return pairs
+}